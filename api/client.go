@@ -0,0 +1,205 @@
+package api
+
+import (
+	"agent-farmer/session"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client talks to the control API of a running TUI or daemon.
+type Client struct {
+	http *http.Client
+}
+
+// Dial returns a client for the running agent-farmer process. It returns an error if no process is serving the
+// control API.
+func Dial() (*Client, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get socket path: %w", err)
+	}
+
+	c := &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+			// Creating a session starts tmux and the program, which can take a few seconds.
+			Timeout: 60 * time.Second,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.do(ctx, http.MethodGet, "/ping", nil, nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// List returns the live sessions.
+func (c *Client) List() ([]session.Summary, error) {
+	var summaries []session.Summary
+	err := c.do(context.Background(), http.MethodGet, "/sessions", nil, &summaries)
+	return summaries, err
+}
+
+// Create creates and starts a new session.
+func (c *Client) Create(req CreateRequest) (session.Summary, error) {
+	var summary session.Summary
+	err := c.do(context.Background(), http.MethodPost, "/sessions", req, &summary)
+	return summary, err
+}
+
+// SendPrompt sends a prompt to the session with the given title.
+func (c *Client) SendPrompt(title string, prompt string) error {
+	return c.do(context.Background(), http.MethodPost, sessionPath(title, "prompt"), PromptRequest{Prompt: prompt}, nil)
+}
+
+// Pause pauses the session with the given title.
+func (c *Client) Pause(title string) error {
+	return c.do(context.Background(), http.MethodPost, sessionPath(title, "pause"), nil, nil)
+}
+
+// Resume resumes the session with the given title.
+func (c *Client) Resume(title string) error {
+	return c.do(context.Background(), http.MethodPost, sessionPath(title, "resume"), nil, nil)
+}
+
+// Restart restarts the agent of the session with the given title.
+func (c *Client) Restart(title string) error {
+	return c.do(context.Background(), http.MethodPost, sessionPath(title, "restart"), nil, nil)
+}
+
+// Rebase rebases the branch of the session with the given title onto its base.
+func (c *Client) Rebase(title string) error {
+	return c.do(context.Background(), http.MethodPost, sessionPath(title, "rebase"), nil, nil)
+}
+
+// Kill kills the session with the given title, archiving it first if archive is true.
+func (c *Client) Kill(title string, archive bool) error {
+	path := sessionPath(title, "")
+	if archive {
+		path += "?archive=true"
+	}
+	return c.do(context.Background(), http.MethodDelete, path, nil, nil)
+}
+
+// Diff returns the diff of the session with the given title.
+func (c *Client) Diff(title string) (Diff, error) {
+	var diff Diff
+	err := c.do(context.Background(), http.MethodGet, sessionPath(title, "diff"), nil, &diff)
+	return diff, err
+}
+
+// Tag adds and removes tags of the session with the given title.
+func (c *Client) Tag(title string, req TagsRequest) (session.Summary, error) {
+	var summary session.Summary
+	err := c.do(context.Background(), http.MethodPost, sessionPath(title, "tags"), req, &summary)
+	return summary, err
+}
+
+// FanOut creates a group of sessions that all attempt the same prompt.
+func (c *Client) FanOut(req FanOutRequest) ([]session.Summary, error) {
+	var summaries []session.Summary
+	err := c.do(context.Background(), http.MethodPost, "/fanout", req, &summaries)
+	return summaries, err
+}
+
+// Keep keeps the given session of a fan-out and kills the other attempts.
+func (c *Client) Keep(title string) (KeepResult, error) {
+	var result KeepResult
+	err := c.do(context.Background(), http.MethodPost, sessionPath(title, "keep"), nil, &result)
+	return result, err
+}
+
+// Queue returns the queued prompts, oldest first.
+func (c *Client) Queue() ([]session.QueuedPrompt, error) {
+	var items []session.QueuedPrompt
+	err := c.do(context.Background(), http.MethodGet, "/queue", nil, &items)
+	return items, err
+}
+
+// Enqueue adds prompts to the queue and returns them with their final titles.
+func (c *Client) Enqueue(items []session.QueuedPrompt) ([]session.QueuedPrompt, error) {
+	var added []session.QueuedPrompt
+	err := c.do(context.Background(), http.MethodPost, "/queue", items, &added)
+	return added, err
+}
+
+// Dequeue removes the queued prompt with the given title.
+func (c *Client) Dequeue(title string) error {
+	return c.do(context.Background(), http.MethodDelete, "/queue/"+url.PathEscape(title), nil, nil)
+}
+
+// Restore brings the archived session with the given ID back as a paused session.
+func (c *Client) Restore(id string) (session.Summary, error) {
+	var summary session.Summary
+	err := c.do(context.Background(), http.MethodPost, "/archive/"+url.PathEscape(id)+"/restore", nil, &summary)
+	return summary, err
+}
+
+// Shutdown asks the process to save its state and exit. It returns once the state has been saved.
+func (c *Client) Shutdown() error {
+	return c.do(context.Background(), http.MethodPost, "/shutdown", nil, nil)
+}
+
+func sessionPath(title string, action string) string {
+	p := "/sessions/" + url.PathEscape(title)
+	if action != "" {
+		p += "/" + action
+	}
+	return p
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	// The host is ignored since we always dial the socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://agent-farmer"+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach agent-farmer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var errResp errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+			return fmt.Errorf("agent-farmer returned %s", resp.Status)
+		}
+		return errors.New(errResp.Error)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
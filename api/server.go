@@ -0,0 +1,400 @@
+package api
+
+import (
+	"agent-farmer/config"
+	"agent-farmer/log"
+	"agent-farmer/session"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const SocketFileName = "af.sock"
+
+// ErrNotFound is returned by a Backend when no session has the requested title.
+var ErrNotFound = errors.New("instance not found")
+
+// CreateRequest is the body of a request to create a new session.
+type CreateRequest struct {
+	// Title is the title of the new session.
+	Title string `json:"title"`
+	// Path is a path inside the repository to create the session's worktree from.
+	Path string `json:"path"`
+	// Program is the program to run. The backend's default program is used if empty.
+	Program string `json:"program,omitempty"`
+	// Prompt is sent to the session once the program has started, if set.
+	Prompt string `json:"prompt,omitempty"`
+	// Tags are the labels of the new session.
+	Tags []string `json:"tags,omitempty"`
+	// BaseRef is the branch, tag or commit to create the session's branch from. The configured default base ref, or
+	// the repo's HEAD, is used if empty.
+	BaseRef string `json:"base_ref,omitempty"`
+	// Adopt is an existing branch or pull request, e.g. "origin/feature" or "#42", for the session to work on
+	// instead of creating a branch.
+	Adopt string `json:"adopt,omitempty"`
+	// Sparse are directories, or names of the repo's sparse profiles, to check out instead of the whole repo.
+	Sparse []string `json:"sparse,omitempty"`
+}
+
+// TagsRequest is the body of a request to change the tags or the project of a session.
+type TagsRequest struct {
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+	// Project, if set, puts the session in this project. An empty one takes it out of its project.
+	Project *string `json:"project,omitempty"`
+}
+
+// FanOutRequest is the body of a request to run one prompt across several sessions.
+type FanOutRequest struct {
+	// Title is the title of the group. The sessions are titled Title-1..N.
+	Title string `json:"title"`
+	// Path is a path inside the repository to create the sessions' worktrees from.
+	Path string `json:"path"`
+	// Prompt is sent to every session once its program has started.
+	Prompt string `json:"prompt"`
+	// Programs are the programs to run, optionally with an " xN" suffix to run one N times. The backend's configured
+	// fan-out programs are used if empty.
+	Programs []string `json:"programs,omitempty"`
+}
+
+// KeepResult is the response to keeping the winner of a fan-out.
+type KeepResult struct {
+	// Killed are the titles of the other attempts, which were killed.
+	Killed []string `json:"killed"`
+}
+
+// PromptRequest is the body of a request to send a prompt to a session.
+type PromptRequest struct {
+	Prompt string `json:"prompt"`
+}
+
+// Diff is the diff of a session against its base commit.
+type Diff struct {
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Content string `json:"content"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Backend is implemented by the process that owns the live sessions, i.e. the TUI or the daemon. Implementations must
+// be safe to call from multiple goroutines.
+type Backend interface {
+	List() ([]session.Summary, error)
+	Create(req CreateRequest) (session.Summary, error)
+	SendPrompt(title string, prompt string) error
+	Pause(title string) error
+	Resume(title string) error
+	// Restart runs the agent of a session again in its worktree, e.g. after it exited or crashed.
+	Restart(title string) error
+	// Rebase rebases the branch of a session onto its base, after which its diff is taken against the new base.
+	Rebase(title string) error
+	// Kill kills a session. It's archived first if archive is true or archiving on kill is configured.
+	Kill(title string, archive bool) error
+	Diff(title string) (Diff, error)
+	// Tag adds and removes tags of a session, sets its project if asked to, and returns its updated summary.
+	Tag(title string, req TagsRequest) (session.Summary, error)
+	// FanOut creates a group of sessions that all attempt the same prompt.
+	FanOut(req FanOutRequest) ([]session.Summary, error)
+	// Keep keeps the given session of a fan-out and kills the other attempts.
+	Keep(title string) (KeepResult, error)
+	// Queue returns the queued prompts, oldest first.
+	Queue() ([]session.QueuedPrompt, error)
+	// Enqueue adds prompts to the queue and returns them with their final, unique titles.
+	Enqueue(items []session.QueuedPrompt) ([]session.QueuedPrompt, error)
+	// Dequeue removes the queued prompt with the given title.
+	Dequeue(title string) error
+	// Restore brings an archived session back as a paused session and returns its summary.
+	Restore(id string) (session.Summary, error)
+}
+
+// Shutdowner is implemented by backends that can be asked to save their state and exit. The daemon implements it so
+// that the TUI can take over its sessions without killing it mid-write.
+type Shutdowner interface {
+	Shutdown() error
+}
+
+// SocketPath returns the path of the control socket.
+func SocketPath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, SocketFileName), nil
+}
+
+// Server serves the control API for a Backend on a Unix domain socket.
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+	// requests is held for reading while a request is served, and for writing by Drain to wait for them.
+	requests sync.RWMutex
+	// draining is set by Drain, after which requests are refused. It's guarded by requests.
+	draining bool
+}
+
+// Listen starts serving the control API for backend. Only one process can serve the API at a time. If another process
+// is still listening, Listen waits briefly for it to go away (e.g. a daemon that is shutting down) before giving up.
+func Listen(backend Backend) (*Server, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get socket path: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	if err := clearSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		log.WarningLog.Printf("failed to restrict permissions of %s: %v", path, err)
+	}
+
+	s := &Server{listener: listener}
+	s.server = &http.Server{Handler: s.track(newHandler(backend))}
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			log.ErrorLog.Printf("control API server stopped: %v", err)
+		}
+	}()
+	log.InfoLog.Printf("control API listening on %s", path)
+	return s, nil
+}
+
+// clearSocket removes a stale socket left behind by a process that crashed. It returns an error if a live process is
+// still listening on it after a short grace period.
+func clearSocket(path string) error {
+	for attempt := 0; attempt < 20; attempt++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+		conn, err := net.DialTimeout("unix", path, 100*time.Millisecond)
+		if err != nil {
+			// Nobody is listening, the socket is stale.
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+			}
+			return nil
+		}
+		_ = conn.Close()
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("another agent-farmer process is already listening on %s", path)
+}
+
+// Close stops the server. Requests that are in flight are given a moment to finish. Closing the listener removes
+// the socket file.
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// Drain stops accepting requests, so that the backend can save its state knowing it won't change anymore. The socket
+// is closed and removed, and requests on connections that are still open are refused. Drain returns once the
+// requests that were being served are done, except shutdown requests, which may be the ones draining the server.
+func (s *Server) Drain() {
+	s.server.SetKeepAlivesEnabled(false)
+	if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.WarningLog.Printf("failed to close control API listener: %v", err)
+	}
+	s.requests.Lock()
+	defer s.requests.Unlock()
+	s.draining = true
+}
+
+// track keeps count of the requests being served, see Drain, and refuses them once the server is draining.
+func (s *Server) track(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/shutdown" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		s.requests.RLock()
+		defer s.requests.RUnlock()
+		if s.draining {
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "shutting down"})
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func newHandler(backend Backend) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /ping", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		summaries, err := backend.List()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, summaries)
+	})
+	mux.HandleFunc("POST /sessions", func(w http.ResponseWriter, r *http.Request) {
+		var req CreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+		summary, err := backend.Create(req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, summary)
+	})
+	mux.HandleFunc("POST /sessions/{title}/prompt", func(w http.ResponseWriter, r *http.Request) {
+		var req PromptRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+		writeResult(w, backend.SendPrompt(r.PathValue("title"), req.Prompt))
+	})
+	mux.HandleFunc("POST /sessions/{title}/pause", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, backend.Pause(r.PathValue("title")))
+	})
+	mux.HandleFunc("POST /sessions/{title}/resume", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, backend.Resume(r.PathValue("title")))
+	})
+	mux.HandleFunc("POST /sessions/{title}/restart", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, backend.Restart(r.PathValue("title")))
+	})
+	mux.HandleFunc("POST /sessions/{title}/rebase", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, backend.Rebase(r.PathValue("title")))
+	})
+	mux.HandleFunc("DELETE /sessions/{title}", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, backend.Kill(r.PathValue("title"), r.URL.Query().Get("archive") == "true"))
+	})
+	mux.HandleFunc("GET /sessions/{title}/diff", func(w http.ResponseWriter, r *http.Request) {
+		diff, err := backend.Diff(r.PathValue("title"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, diff)
+	})
+	mux.HandleFunc("POST /sessions/{title}/tags", func(w http.ResponseWriter, r *http.Request) {
+		var req TagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+		summary, err := backend.Tag(r.PathValue("title"), req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, summary)
+	})
+	mux.HandleFunc("POST /fanout", func(w http.ResponseWriter, r *http.Request) {
+		var req FanOutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+		summaries, err := backend.FanOut(req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, summaries)
+	})
+	mux.HandleFunc("POST /sessions/{title}/keep", func(w http.ResponseWriter, r *http.Request) {
+		result, err := backend.Keep(r.PathValue("title"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /queue", func(w http.ResponseWriter, r *http.Request) {
+		items, err := backend.Queue()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, items)
+	})
+	mux.HandleFunc("POST /queue", func(w http.ResponseWriter, r *http.Request) {
+		var items []session.QueuedPrompt
+		if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+		added, err := backend.Enqueue(items)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, added)
+	})
+	mux.HandleFunc("DELETE /queue/{title}", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, backend.Dequeue(r.PathValue("title")))
+	})
+	mux.HandleFunc("POST /archive/{id}/restore", func(w http.ResponseWriter, r *http.Request) {
+		summary, err := backend.Restore(r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, summary)
+	})
+	mux.HandleFunc("POST /shutdown", func(w http.ResponseWriter, r *http.Request) {
+		shutdowner, ok := backend.(Shutdowner)
+		if !ok {
+			writeJSON(w, http.StatusNotImplemented, errorResponse{Error: "this process can't be shut down remotely"})
+			return
+		}
+		writeResult(w, shutdowner.Shutdown())
+	})
+
+	return mux
+}
+
+func writeResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, ErrNotFound) || errors.Is(err, session.ErrNotQueued) || errors.Is(err, session.ErrNotArchived) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.ErrorLog.Printf("failed to write control API response: %v", err)
+	}
+}
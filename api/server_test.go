@@ -0,0 +1,228 @@
+package api
+
+import (
+	"agent-farmer/log"
+	"agent-farmer/session"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend records the calls it receives and knows about a single session named "known".
+type fakeBackend struct {
+	calls []string
+}
+
+func (f *fakeBackend) lookup(title string) error {
+	if title != "known" {
+		return fmt.Errorf("%w: %s", ErrNotFound, title)
+	}
+	return nil
+}
+
+func (f *fakeBackend) List() ([]session.Summary, error) {
+	f.calls = append(f.calls, "list")
+	return []session.Summary{{Title: "known", Status: "running"}}, nil
+}
+
+func (f *fakeBackend) Create(req CreateRequest) (session.Summary, error) {
+	f.calls = append(f.calls, "create "+req.Title+" "+req.Prompt)
+	return session.Summary{Title: req.Title}, nil
+}
+
+func (f *fakeBackend) SendPrompt(title string, prompt string) error {
+	f.calls = append(f.calls, "prompt "+title+" "+prompt)
+	return f.lookup(title)
+}
+
+func (f *fakeBackend) Pause(title string) error {
+	f.calls = append(f.calls, "pause "+title)
+	return f.lookup(title)
+}
+
+func (f *fakeBackend) Resume(title string) error {
+	f.calls = append(f.calls, "resume "+title)
+	return f.lookup(title)
+}
+
+func (f *fakeBackend) Restart(title string) error {
+	f.calls = append(f.calls, "restart "+title)
+	return f.lookup(title)
+}
+
+func (f *fakeBackend) Rebase(title string) error {
+	f.calls = append(f.calls, "rebase "+title)
+	return f.lookup(title)
+}
+
+func (f *fakeBackend) Kill(title string, archive bool) error {
+	f.calls = append(f.calls, fmt.Sprintf("kill %s %t", title, archive))
+	return f.lookup(title)
+}
+
+func (f *fakeBackend) Diff(title string) (Diff, error) {
+	f.calls = append(f.calls, "diff "+title)
+	return Diff{Added: 1}, f.lookup(title)
+}
+
+func (f *fakeBackend) Tag(title string, req TagsRequest) (session.Summary, error) {
+	f.calls = append(f.calls, fmt.Sprintf("tag %s %v %v", title, req.Add, req.Remove))
+	return session.Summary{Title: title, Tags: req.Add}, f.lookup(title)
+}
+
+func (f *fakeBackend) FanOut(req FanOutRequest) ([]session.Summary, error) {
+	f.calls = append(f.calls, fmt.Sprintf("fanout %s %d", req.Title, len(req.Programs)))
+	return []session.Summary{{Title: req.Title + "-1", Group: req.Title}}, nil
+}
+
+func (f *fakeBackend) Keep(title string) (KeepResult, error) {
+	f.calls = append(f.calls, "keep "+title)
+	return KeepResult{Killed: []string{"other"}}, f.lookup(title)
+}
+
+func (f *fakeBackend) Queue() ([]session.QueuedPrompt, error) {
+	f.calls = append(f.calls, "queue")
+	return []session.QueuedPrompt{{Title: "queued"}}, nil
+}
+
+func (f *fakeBackend) Enqueue(items []session.QueuedPrompt) ([]session.QueuedPrompt, error) {
+	f.calls = append(f.calls, fmt.Sprintf("enqueue %d", len(items)))
+	return items, nil
+}
+
+func (f *fakeBackend) Dequeue(title string) error {
+	f.calls = append(f.calls, "dequeue "+title)
+	if title != "queued" {
+		return fmt.Errorf("%w: %s", session.ErrNotQueued, title)
+	}
+	return nil
+}
+
+func (f *fakeBackend) Restore(id string) (session.Summary, error) {
+	f.calls = append(f.calls, "restore "+id)
+	if id != "archived" {
+		return session.Summary{}, fmt.Errorf("%w: %s", session.ErrNotArchived, id)
+	}
+	return session.Summary{Title: id, Status: "paused"}, nil
+}
+
+func TestHandler(t *testing.T) {
+	backend := &fakeBackend{}
+	handler := newHandler(backend)
+
+	testCases := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCall   string
+		wantBody   string
+	}{
+		{http.MethodGet, "/sessions", "", http.StatusOK, "list", `"title":"known"`},
+		{http.MethodPost, "/sessions", `{"title":"new","prompt":"do it"}`, http.StatusCreated, "create new do it", `"title":"new"`},
+		{http.MethodPost, "/sessions", `not json`, http.StatusBadRequest, "", "invalid request"},
+		{http.MethodPost, "/sessions/known/prompt", `{"prompt":"hello"}`, http.StatusOK, "prompt known hello", ""},
+		{http.MethodPost, "/sessions/known/pause", "", http.StatusOK, "pause known", ""},
+		{http.MethodPost, "/sessions/known/resume", "", http.StatusOK, "resume known", ""},
+		{http.MethodPost, "/sessions/known/restart", "", http.StatusOK, "restart known", ""},
+		{http.MethodPost, "/sessions/known/rebase", "", http.StatusOK, "rebase known", ""},
+		{http.MethodDelete, "/sessions/known", "", http.StatusOK, "kill known false", ""},
+		{http.MethodDelete, "/sessions/known?archive=true", "", http.StatusOK, "kill known true", ""},
+		{http.MethodGet, "/sessions/known/diff", "", http.StatusOK, "diff known", `"added":1`},
+		{http.MethodPost, "/sessions/missing/pause", "", http.StatusNotFound, "pause missing", "instance not found: missing"},
+		{http.MethodPost, "/sessions/with%20space/pause", "", http.StatusNotFound, "pause with space", ""},
+		{http.MethodPost, "/sessions/known/tags", `{"add":["ui"],"remove":["old"]}`, http.StatusOK, "tag known [ui] [old]", `"tags":["ui"]`},
+		{http.MethodPost, "/fanout", `{"title":"task","prompt":"x","programs":["claude","codex"]}`, http.StatusCreated, "fanout task 2", `"group":"task"`},
+		{http.MethodPost, "/sessions/known/keep", "", http.StatusOK, "keep known", `"killed":["other"]`},
+		{http.MethodGet, "/queue", "", http.StatusOK, "queue", `"title":"queued"`},
+		{http.MethodPost, "/queue", `[{"title":"a","prompt":"x"},{"title":"b","prompt":"y"}]`, http.StatusCreated, "enqueue 2", `"title":"b"`},
+		{http.MethodDelete, "/queue/queued", "", http.StatusOK, "dequeue queued", ""},
+		{http.MethodDelete, "/queue/missing", "", http.StatusNotFound, "dequeue missing", "queued prompt not found"},
+		{http.MethodPost, "/archive/archived/restore", "", http.StatusOK, "restore archived", `"status":"paused"`},
+		{http.MethodPost, "/archive/missing/restore", "", http.StatusNotFound, "restore missing", "archived session not found"},
+		{http.MethodPost, "/shutdown", "", http.StatusNotImplemented, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			backend.calls = nil
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			if tc.wantCall == "" {
+				require.Empty(t, backend.calls)
+			} else {
+				require.Equal(t, []string{tc.wantCall}, backend.calls)
+			}
+			assert.Contains(t, rec.Body.String(), tc.wantBody)
+		})
+	}
+}
+
+// slowBackend lists the sessions once it's released.
+type slowBackend struct {
+	fakeBackend
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *slowBackend) List() ([]session.Summary, error) {
+	close(b.started)
+	<-b.release
+	return b.fakeBackend.List()
+}
+
+func TestServerDrain(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+	t.Setenv("HOME", t.TempDir())
+
+	backend := &slowBackend{started: make(chan struct{}), release: make(chan struct{})}
+	server, err := Listen(backend)
+	require.NoError(t, err)
+	defer server.Close()
+	client, err := Dial()
+	require.NoError(t, err)
+
+	listed := make(chan error, 1)
+	go func() {
+		_, err := client.List()
+		listed <- err
+	}()
+	<-backend.started
+	drained := make(chan struct{})
+	go func() {
+		server.Drain()
+		close(drained)
+	}()
+
+	// The socket goes away right away, but Drain waits for the request being served.
+	path, err := SocketPath()
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+	_, err = Dial()
+	require.Error(t, err)
+	select {
+	case <-drained:
+		t.Fatal("Drain returned before the request was served")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(backend.release)
+	require.NoError(t, <-listed)
+	<-drained
+	_, err = client.Queue()
+	require.Error(t, err)
+}
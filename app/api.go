@@ -0,0 +1,404 @@
+package app
+
+import (
+	"agent-farmer/api"
+	"agent-farmer/session"
+	"agent-farmer/session/git"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// apiRequestTimeout bounds how long a control API request waits for the UI loop. The loop is blocked while the user
+// is attached to a session, so requests can't be served until they detach.
+const apiRequestTimeout = 10 * time.Second
+
+// apiRequestMsg asks the UI loop to run fn and send the result on reply. The control API is served from other
+// goroutines, but home is only safe to use from the loop, so every request is funneled through Update.
+type apiRequestMsg struct {
+	ctx   context.Context
+	fn    func(m *home) (any, tea.Cmd, error)
+	reply chan apiResult
+}
+
+type apiResult struct {
+	value any
+	err   error
+}
+
+// handleAPIRequest runs a control API request on the UI loop.
+func (m *home) handleAPIRequest(msg apiRequestMsg) (tea.Model, tea.Cmd) {
+	// The client gave up waiting, don't act on a request nobody will see the result of.
+	if msg.ctx.Err() != nil {
+		return m, nil
+	}
+	value, cmd, err := msg.fn(m)
+	msg.reply <- apiResult{value: value, err: err}
+	return m, tea.Batch(cmd, m.instanceChanged())
+}
+
+// tuiBackend serves the control API from the live instances in the TUI.
+type tuiBackend struct {
+	program *tea.Program
+}
+
+func (b *tuiBackend) do(fn func(m *home) (any, tea.Cmd, error)) (any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), apiRequestTimeout)
+	defer cancel()
+
+	reply := make(chan apiResult, 1)
+	// Send blocks until the loop picks up the message, which may be after we've given up.
+	go b.program.Send(apiRequestMsg{ctx: ctx, fn: fn, reply: reply})
+
+	select {
+	case res := <-reply:
+		return res.value, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("agent-farmer is busy (is a session attached?), try again later")
+	}
+}
+
+// findInstance returns the started instance with the given title.
+func (m *home) findInstance(title string) (*session.Instance, error) {
+	for _, instance := range m.list.GetInstances() {
+		if instance.Title == title && (instance.Started() || instance.Pending()) {
+			return instance, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", api.ErrNotFound, title)
+}
+
+func (b *tuiBackend) List() ([]session.Summary, error) {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		summaries := make([]session.Summary, 0, m.list.NumInstances())
+		for _, instance := range m.list.GetInstances() {
+			if instance.Started() || instance.Pending() {
+				summaries = append(summaries, instance.ToInstanceData().Summary())
+			}
+		}
+		return summaries, nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]session.Summary), nil
+}
+
+func (b *tuiBackend) Create(req api.CreateRequest) (session.Summary, error) {
+	if req.Title == "" {
+		return session.Summary{}, fmt.Errorf("title cannot be empty")
+	}
+
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		// The list ends with the unstarted instance while a name is being typed, so adding to it would confuse the
+		// new instance flow.
+		if m.state == stateNew {
+			return nil, nil, fmt.Errorf("a session is being created in the TUI, try again later")
+		}
+		if slices.Contains(m.titles(), req.Title) {
+			return nil, nil, fmt.Errorf("a session named '%s' already exists", req.Title)
+		}
+
+		program := req.Program
+		if program == "" {
+			program = m.program
+		}
+		instance, err := session.NewInstance(session.InstanceOptions{
+			Title:   req.Title,
+			Path:    req.Path,
+			Program: program,
+			BaseRef: req.BaseRef,
+			Adopt:   req.Adopt,
+			Sparse:  req.Sparse,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		instance.Prompt = req.Prompt
+		instance.SetTags(req.Tags)
+		pendingCmd, err := m.deferInstance(instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		if instance.Pending() {
+			return instance.ToInstanceData().Summary(), pendingCmd, nil
+		}
+		m.setStarting(instance)
+		return instance, nil, nil
+	})
+	if err != nil {
+		return session.Summary{}, err
+	}
+	if summary, ok := value.(session.Summary); ok {
+		return summary, nil
+	}
+
+	// Start the instance here rather than on the UI loop, like startInstance does. It's only handed to the loop once
+	// it's started, so the summary can be taken here.
+	instance := value.(*session.Instance)
+	startErr := instance.Start(true)
+	var summary session.Summary
+	if startErr == nil {
+		summary = instance.ToInstanceData().Summary()
+	}
+	// It's sent rather than done, which gives up if the loop is busy: the loop has to take the instance, or no other
+	// instance would be started.
+	go b.program.Send(instanceStartedMsg{instance: instance, err: startErr})
+	return summary, startErr
+}
+
+func (b *tuiBackend) SendPrompt(title string, prompt string) error {
+	_, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		if instance.Paused() {
+			return nil, nil, fmt.Errorf("session '%s' is paused", title)
+		}
+		if instance.Pending() {
+			return nil, nil, fmt.Errorf("session '%s' is pending", title)
+		}
+		if err := instance.SendPrompt(prompt); err != nil {
+			return nil, nil, err
+		}
+		return nil, m.instanceChanged(), m.storage.SaveInstances(m.list.GetInstances())
+	})
+	return err
+}
+
+func (b *tuiBackend) Pause(title string) error {
+	_, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := instance.Pause(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, m.storage.SaveInstances(m.list.GetInstances())
+	})
+	return err
+}
+
+func (b *tuiBackend) Resume(title string) error {
+	_, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := session.CheckLimits(m.appConfig.Limits, instance, m.list.GetInstances()); err != nil {
+			return nil, nil, fmt.Errorf("can't resume '%s': %w", title, err)
+		}
+		if err := instance.Resume(); err != nil {
+			return nil, nil, err
+		}
+		return nil, tea.WindowSize(), m.storage.SaveInstances(m.list.GetInstances())
+	})
+	return err
+}
+
+func (b *tuiBackend) Restart(title string) error {
+	_, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := instance.Restart(); err != nil {
+			return nil, nil, err
+		}
+		return nil, tea.WindowSize(), m.storage.SaveInstances(m.list.GetInstances())
+	})
+	return err
+}
+
+// Rebase rebases outside of the UI loop, as the rebase key does, since it fetches the base first. The new base is
+// saved on the loop afterwards.
+func (b *tuiBackend) Rebase(title string) error {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		if instance.Paused() {
+			return nil, nil, fmt.Errorf("session '%s' is paused", title)
+		}
+		if instance.Pending() {
+			return nil, nil, fmt.Errorf("session '%s' is pending", title)
+		}
+		worktree, err := instance.GetGitWorktree()
+		return worktree, nil, err
+	})
+	if err != nil {
+		return err
+	}
+	if err := value.(*git.GitWorktree).RebaseOntoBase(); err != nil {
+		return err
+	}
+	_, err = b.do(func(m *home) (any, tea.Cmd, error) {
+		return nil, m.instanceChanged(), m.storage.SaveInstances(m.list.GetInstances())
+	})
+	return err
+}
+
+func (b *tuiBackend) Kill(title string, archive bool) error {
+	_, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := instance.CheckKillable(); err != nil {
+			return nil, nil, err
+		}
+		if (archive || m.appConfig.ArchiveOnKill) && instance.Started() {
+			if _, err := instance.Archive(m.archive); err != nil {
+				return nil, nil, fmt.Errorf("failed to archive '%s': %w", title, err)
+			}
+		}
+
+		m.list.KillInstance(instance)
+		return nil, nil, m.storage.SaveInstances(m.list.GetInstances())
+	})
+	return err
+}
+
+func (b *tuiBackend) Tag(title string, req api.TagsRequest) (session.Summary, error) {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		instance.AddTags(req.Add)
+		instance.RemoveTags(req.Remove)
+		if req.Project != nil {
+			instance.SetProject(*req.Project)
+		}
+		if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+			return nil, nil, err
+		}
+		return instance.ToInstanceData().Summary(), nil, nil
+	})
+	if err != nil {
+		return session.Summary{}, err
+	}
+	return value.(session.Summary), nil
+}
+
+func (b *tuiBackend) FanOut(req api.FanOutRequest) ([]session.Summary, error) {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		// Same as Create, don't add to the list while a name is being typed.
+		if m.state == stateNew {
+			return nil, nil, fmt.Errorf("a session is being created in the TUI, try again later")
+		}
+		attempts, cmd, err := m.fanOut(req.Title, req.Path, req.Prompt, req.Programs)
+		if len(attempts) == 0 {
+			return nil, cmd, err
+		}
+		summaries := make([]session.Summary, 0, len(attempts))
+		for _, instance := range attempts {
+			summaries = append(summaries, instance.ToInstanceData().Summary())
+		}
+		return summaries, tea.Batch(tea.WindowSize(), cmd), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]session.Summary), nil
+}
+
+func (b *tuiBackend) Keep(title string) (api.KeepResult, error) {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		killed, err := m.keepWinner(instance)
+		if killed == nil {
+			return nil, nil, err
+		}
+		return api.KeepResult{Killed: killed}, tea.WindowSize(), err
+	})
+	if err != nil {
+		return api.KeepResult{}, err
+	}
+	return value.(api.KeepResult), nil
+}
+
+func (b *tuiBackend) Queue() ([]session.QueuedPrompt, error) {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		return append([]session.QueuedPrompt{}, m.queue.Items()...), nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]session.QueuedPrompt), nil
+}
+
+func (b *tuiBackend) Enqueue(items []session.QueuedPrompt) ([]session.QueuedPrompt, error) {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		added, err := m.queue.Add(items, m.titles())
+		if err != nil {
+			return nil, nil, err
+		}
+		m.list.SetQueue(m.queue.Items())
+		// Don't wait for the next check to start the prompts if there's room for them.
+		return added, m.drainQueue(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]session.QueuedPrompt), nil
+}
+
+func (b *tuiBackend) Dequeue(title string) error {
+	_, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		if err := m.queue.Remove(title); err != nil {
+			return nil, nil, err
+		}
+		m.list.SetQueue(m.queue.Items())
+		return nil, nil, nil
+	})
+	return err
+}
+
+func (b *tuiBackend) Restore(id string) (session.Summary, error) {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.archive.Restore(id, m.titles())
+		if err != nil {
+			return nil, nil, err
+		}
+		m.list.AddInstance(instance)()
+		if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+			return nil, nil, err
+		}
+		return instance.ToInstanceData().Summary(), tea.WindowSize(), nil
+	})
+	if err != nil {
+		return session.Summary{}, err
+	}
+	return value.(session.Summary), nil
+}
+
+func (b *tuiBackend) Diff(title string) (api.Diff, error) {
+	value, err := b.do(func(m *home) (any, tea.Cmd, error) {
+		instance, err := m.findInstance(title)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := instance.UpdateDiffStats(); err != nil {
+			return nil, nil, err
+		}
+		stats := instance.GetDiffStats()
+		if stats == nil {
+			return api.Diff{}, nil, nil
+		}
+		return api.Diff{Added: stats.Added, Removed: stats.Removed, Content: stats.Content}, nil, nil
+	})
+	if err != nil {
+		return api.Diff{}, err
+	}
+	return value.(api.Diff), nil
+}
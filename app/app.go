@@ -1,16 +1,22 @@
 package app
 
 import (
+	"agent-farmer/api"
 	"agent-farmer/config"
 	"agent-farmer/keys"
 	"agent-farmer/log"
 	"agent-farmer/session"
+	"agent-farmer/session/git"
 	"agent-farmer/session/tmux"
 	"agent-farmer/ui"
 	"agent-farmer/ui/overlay"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -18,8 +24,6 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
-const GlobalInstanceLimit = 10
-
 // Custom message types
 type pushCompleteMsg struct{}
 type rebaseCompleteMsg struct{}
@@ -27,15 +31,36 @@ type operationCompleteMsg struct{}
 
 // Run is the main entrypoint into the application.
 func Run(ctx context.Context, program string, autoYes bool) error {
+	// One control mode connection per tmux server carries the commands of its sessions and tells which panes have
+	// new output.
+	tmux.EnableControlMode()
+	defer tmux.CloseControl()
+
 	p := tea.NewProgram(
 		newHome(ctx, program, autoYes),
 		tea.WithAltScreen(),
 		tea.WithMouseCellMotion(), // Mouse scroll
 	)
-	_, err := p.Run()
+
+	// Serve the control API so that scripts and editors can drive the live sessions.
+	server, err := api.Listen(&tuiBackend{program: p})
+	if err != nil {
+		log.WarningLog.Printf("control API disabled: %v", err)
+	} else {
+		defer func() {
+			if err := server.Close(); err != nil {
+				log.WarningLog.Printf("failed to close control API: %v", err)
+			}
+		}()
+	}
+
+	_, err = p.Run()
 	return err
 }
 
+// maxTitleLength is the most characters the title of a new instance can have.
+const maxTitleLength = 32
+
 type state int
 
 const (
@@ -52,6 +77,30 @@ const (
 	stateConfirm
 	// stateLoading is the state when a loading indicator is displayed.
 	stateLoading
+	// stateFanOutPrompt is the state when collecting the prompt for a fan-out.
+	stateFanOutPrompt
+	// stateFanOutPrograms is the state when collecting the programs for a fan-out.
+	stateFanOutPrograms
+	// stateFilter is the state when the list filter is being typed.
+	stateFilter
+	// stateTag is the state when the tags of an instance are being edited.
+	stateTag
+	// stateProject is the state when the project of an instance is being edited.
+	stateProject
+	// stateSendPrompt is the state when a prompt for an existing instance is being entered.
+	stateSendPrompt
+	// stateTranscriptSearch is the state when a search of the transcript is being typed.
+	stateTranscriptSearch
+	// stateInteractive is the state when keys are typed into the selected instance from the preview.
+	stateInteractive
+	// stateInbox is the state when the sessions waiting for approval are listed.
+	stateInbox
+	// stateDenyMessage is the state when the message sent with a denied approval is being entered.
+	stateDenyMessage
+	// stateBaseRef is the state when the base ref of a new instance is being entered.
+	stateBaseRef
+	// stateAdopt is the state when the existing branch or pull request of a new instance is being entered.
+	stateAdopt
 )
 
 type home struct {
@@ -64,6 +113,10 @@ type home struct {
 
 	// storage is the interface for saving/loading data to/from the app's state
 	storage *session.Storage
+	// queue holds the prompts waiting for a free slot to be started
+	queue *session.Queue
+	// archive keeps killed sessions when archive_on_kill is set
+	archive *session.Archive
 	// appConfig stores persistent application configuration
 	appConfig *config.Config
 	// appState stores persistent application state like seen help screens
@@ -73,19 +126,40 @@ type home struct {
 
 	// state is the current discrete state of the application
 	state state
-	// newInstanceFinalizer is called when the state is stateNew and then you press enter.
-	// It registers the new instance in the list after the instance has been started.
-	newInstanceFinalizer func()
+	// namedInstance is the new instance that was named and waits in the list, unstarted, for its prompt. It's started
+	// with the prompt, see startNamed.
+	namedInstance *session.Instance
 
 	// promptAfterName tracks if we should enter prompt mode after naming
 	promptAfterName bool
 
+	// fanOutPrompt holds the prompt of a fan-out while its programs are collected
+	fanOutPrompt string
+
 	// keySent is used to manage underlining menu items
 	keySent bool
 
 	// quitConfirmed is set to true when user confirms quit
 	quitConfirmed bool
 
+	// windowWidth is the width of the terminal
+	windowWidth int
+	// sessionWidth and sessionHeight are the size the panes of the instances were last set to, see setPreviewSizes.
+	sessionWidth, sessionHeight int
+
+	// lastPendingCheck is when we last tried to start pending instances and queued prompts.
+	lastPendingCheck time.Time
+	// starting is the instance being started off the UI loop, see startInstance. Instances are started one at a time,
+	// so that the limits count the one being started.
+	starting *session.Instance
+	// lastDiskUsage is when we last started measuring the worktrees for the disk limit, and measuringDisk is true until
+	// that's done. See measureDiskUsage.
+	lastDiskUsage time.Time
+	measuringDisk bool
+	// untrustedSettings are repo settings whose hooks, symlinks and window commands were skipped, to ask the user to trust them once
+	// no other dialog is shown. See confirmTrust.
+	untrustedSettings *session.UntrustedSettingsError
+
 	// -- UI Components --
 
 	// list displays the list of instances
@@ -96,6 +170,8 @@ type home struct {
 	tabbedWindow *ui.TabbedWindow
 	// errBox displays error messages
 	errBox *ui.ErrBox
+	// inbox lists the instances waiting for approval
+	inbox *ui.Inbox
 	// global spinner instance. we plumb this down to where it's needed
 	spinner spinner.Model
 	// textInputOverlay handles text input with state
@@ -116,6 +192,19 @@ func newHome(ctx context.Context, program string, autoYes bool) *home {
 	// Load application config
 	appConfig := config.LoadConfig()
 
+	if err := tmux.SetAgentProfiles(appConfig.AgentProfiles); err != nil {
+		fmt.Printf("Invalid agent profiles: %v\n", err)
+		os.Exit(1)
+	}
+	if err := tmux.SetServer(appConfig.TmuxSocket, appConfig.TmuxSocketPerRepo); err != nil {
+		fmt.Printf("Failed to set up the tmux server: %v\n", err)
+		os.Exit(1)
+	}
+	if err := tmux.ConfigureAttach(appConfig.DetachKey, appConfig.PaletteKey, appConfig.SavedPrompts); err != nil {
+		fmt.Printf("Invalid attach keys: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Load application state
 	appState := config.LoadState()
 
@@ -125,14 +214,27 @@ func newHome(ctx context.Context, program string, autoYes bool) *home {
 		fmt.Printf("Failed to initialize storage: %v\n", err)
 		os.Exit(1)
 	}
+	queue, err := session.NewQueue(appState)
+	if err != nil {
+		fmt.Printf("Failed to load queue: %v\n", err)
+		os.Exit(1)
+	}
+	archive, err := session.NewArchive()
+	if err != nil {
+		fmt.Printf("Failed to open archive: %v\n", err)
+		os.Exit(1)
+	}
 
 	h := &home{
 		ctx:          ctx,
 		spinner:      spinner.New(spinner.WithSpinner(spinner.MiniDot)),
 		menu:         ui.NewMenu(),
-		tabbedWindow: ui.NewTabbedWindow(ui.NewPreviewPane(), ui.NewDiffPane()),
+		tabbedWindow: ui.NewTabbedWindow(ui.NewPreviewPane(), ui.NewGridPane(), ui.NewDiffPane(), ui.NewHistoryPane(), ui.NewTranscriptPane()),
 		errBox:       ui.NewErrBox(),
+		inbox:        ui.NewInbox(),
 		storage:      storage,
+		queue:        queue,
+		archive:      archive,
 		appConfig:    appConfig,
 		program:      program,
 		autoYes:      autoYes,
@@ -140,6 +242,8 @@ func newHome(ctx context.Context, program string, autoYes bool) *home {
 		appState:     appState,
 	}
 	h.list = ui.NewList(&h.spinner, autoYes)
+	h.list.SetQueue(queue.Items())
+	h.list.SetGroupBy(ui.GroupBy(appState.GetListGroupBy()))
 
 	// Load saved instances
 	instances, err := storage.LoadInstances()
@@ -163,6 +267,8 @@ func newHome(ctx context.Context, program string, autoYes bool) *home {
 // updateHandleWindowSizeEvent sets the sizes of the components.
 // The components will try to render inside their bounds.
 func (m *home) updateHandleWindowSizeEvent(msg tea.WindowSizeMsg) {
+	m.windowWidth = msg.Width
+
 	// List takes 30% of width, preview takes 70%
 	listWidth := int(float32(msg.Width) * 0.3)
 	tabsWidth := msg.Width - listWidth
@@ -181,12 +287,24 @@ func (m *home) updateHandleWindowSizeEvent(msg tea.WindowSizeMsg) {
 	if m.textOverlay != nil {
 		m.textOverlay.SetWidth(int(float32(msg.Width) * 0.6))
 	}
+	m.inbox.SetSize(int(float32(msg.Width)*0.7), int(float32(msg.Height)*0.8))
 
-	previewWidth, previewHeight := m.tabbedWindow.GetPreviewSize()
-	if err := m.list.SetSessionPreviewSize(previewWidth, previewHeight); err != nil {
+	m.setPreviewSizes()
+	m.menu.SetSize(msg.Width, menuHeight)
+}
+
+// setPreviewSizes sizes the panes of the instances like the preview shows them: the size of the preview, or of the
+// tiles when the grid is shown.
+func (m *home) setPreviewSizes() {
+	width, height := m.tabbedWindow.GetPreviewSize()
+	grid := m.tabbedWindow.GridLayout() != ui.GridOff
+	if grid {
+		width, height = m.tabbedWindow.GetGridTileSize()
+	}
+	m.sessionWidth, m.sessionHeight = width, height
+	if err := m.list.SetSessionPreviewSize(width, height, !grid); err != nil {
 		log.ErrorLog.Print(err)
 	}
-	m.menu.SetSize(msg.Width, menuHeight)
 }
 
 func (m *home) Init() tea.Cmd {
@@ -222,6 +340,13 @@ func (m *home) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case hideErrMsg:
 		m.errBox.Clear()
+	case instanceStartedMsg:
+		return m, m.handleInstanceStarted(msg)
+	case diskUsageMeasuredMsg:
+		m.measuringDisk = false
+	case untrustedSettingsMsg:
+		// Asked once no other dialog is shown, see the metadata tick.
+		m.untrustedSettings = msg.err
 	case previewTickMsg:
 		cmd := m.instanceChanged()
 		return m, tea.Batch(
@@ -235,28 +360,39 @@ func (m *home) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.menu.ClearKeydown()
 		return m, nil
 	case tickUpdateMetadataMessage:
+		notify := false
 		for _, instance := range m.list.GetInstances() {
 			if !instance.Started() || instance.Paused() {
 				continue
 			}
-			updated, prompt := instance.HasUpdated()
-			if updated {
-				instance.SetStatus(session.Running)
-			} else {
-				if prompt {
-					instance.TapEnter()
-				} else {
-					instance.SetStatus(session.Ready)
-				}
+			if instance.UpdateStatus() && instance.Status.NeedsAttention() {
+				notify = true
 			}
 			if err := instance.UpdateDiffStats(); err != nil {
 				log.WarningLog.Printf("could not update diff stats: %v", err)
 			}
 		}
-		return m, tickUpdateMetadataCmd
+		diskCmd := m.measureDiskUsage()
+		if m.untrustedSettings != nil && m.state == stateDefault {
+			diskCmd = tea.Batch(diskCmd, m.confirmTrust(m.untrustedSettings))
+			m.untrustedSettings = nil
+		}
+		var startCmd tea.Cmd
+		if time.Since(m.lastPendingCheck) >= pendingCheckInterval {
+			m.lastPendingCheck = time.Now()
+			startCmd = m.startNext()
+		}
+		if m.state == stateInbox {
+			m.inbox.Update(m.list.GetInstances())
+		}
+		var bellCmd tea.Cmd
+		if notify && m.appConfig.Notify {
+			bellCmd = ringBell
+		}
+		return m, tea.Batch(diskCmd, startCmd, bellCmd, tickUpdateMetadataCmd)
 	case tea.MouseMsg:
-		// Handle mouse wheel scrolling in the diff view
-		if m.tabbedWindow.IsInDiffTab() {
+		// Handle mouse wheel scrolling in the diff and history views
+		if m.tabbedWindow.IsScrollable() {
 			if msg.Action == tea.MouseActionPress {
 				switch msg.Button {
 				case tea.MouseButtonWheelUp:
@@ -286,6 +422,8 @@ func (m *home) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case instanceChangedMsg:
 		// Handle instance changed after confirmation action
 		return m, m.instanceChanged()
+	case apiRequestMsg:
+		return m.handleAPIRequest(msg)
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -328,7 +466,11 @@ func (m *home) handleMenuHighlighting(msg tea.KeyMsg) (cmd tea.Cmd, returnEarly
 		m.keySent = false
 		return nil, false
 	}
-	if m.state == statePrompt || m.state == statePromptForName || m.state == stateHelp || m.state == stateConfirm {
+	if m.state == statePrompt || m.state == statePromptForName || m.state == stateHelp || m.state == stateConfirm ||
+		m.state == stateFanOutPrompt || m.state == stateFanOutPrograms || m.state == stateFilter || m.state == stateTag ||
+		m.state == stateProject || m.state == stateSendPrompt || m.state == stateTranscriptSearch || m.state == stateInteractive ||
+		m.state == stateInbox || m.state == stateDenyMessage || m.state == stateBaseRef || m.state == stateAdopt ||
+		m.isTranscriptKey(msg) {
 		return nil, false
 	}
 	// If it's in the global keymap, we should try to highlight it.
@@ -370,6 +512,50 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		return m.handleHelpState(msg)
 	}
 
+	if m.state == stateFanOutPrompt || m.state == stateFanOutPrograms {
+		return m.handleFanOutState(msg)
+	}
+
+	if m.state == stateFilter {
+		return m.handleFilterState(msg)
+	}
+
+	if m.state == stateTag {
+		return m.handleTagState(msg)
+	}
+
+	if m.state == stateProject {
+		return m.handleProjectState(msg)
+	}
+
+	if m.state == stateSendPrompt {
+		return m.handleSendPromptState(msg)
+	}
+
+	if m.state == stateTranscriptSearch {
+		return m.handleTranscriptSearchState(msg)
+	}
+
+	if m.state == stateInteractive {
+		return m.handleInteractiveState(msg)
+	}
+
+	if m.state == stateInbox {
+		return m.handleInboxState(msg)
+	}
+
+	if m.state == stateDenyMessage {
+		return m.handleDenyMessageState(msg)
+	}
+
+	if m.state == stateBaseRef {
+		return m.handleBaseRefState(msg)
+	}
+
+	if m.state == stateAdopt {
+		return m.handleAdoptState(msg)
+	}
+
 	if m.state == stateNew {
 		// Handle quit commands first. Don't handle q because the user might want to type that.
 		if msg.String() == "ctrl+c" {
@@ -393,38 +579,23 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 				return m, m.handleError(fmt.Errorf("title cannot be empty"))
 			}
 
-			if err := instance.Start(true); err != nil {
-				m.list.Kill()
-				m.state = stateDefault
-				return m, m.handleError(err)
-			}
-			// Save after adding new instance
-			if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
-				return m, m.handleError(err)
-			}
-			// Instance added successfully, call the finalizer.
-			m.newInstanceFinalizer()
-			if m.autoYes {
-				instance.AutoYes = true
-			}
-
-			m.newInstanceFinalizer()
 			m.state = stateDefault
 			if m.promptAfterName {
+				// The instance is started once it has its prompt, see startNamed.
+				m.namedInstance = instance
 				m.state = statePrompt
 				m.menu.SetState(ui.StatePrompt)
 				// Initialize the text input overlay
 				m.textInputOverlay = overlay.NewTextInputOverlay("Enter prompt", "")
 				m.promptAfterName = false
-			} else {
-				m.menu.SetState(ui.StateDefault)
-				m.showHelpScreen(helpTypeInstanceStart, nil)
+				return m, tea.Batch(tea.WindowSize(), m.instanceChanged())
 			}
-
-			return m, tea.Batch(tea.WindowSize(), m.instanceChanged())
+			m.menu.SetState(ui.StateDefault)
+			m.showHelpScreen(helpTypeInstanceStart, nil)
+			return m, m.startNamed(instance)
 		case tea.KeyRunes:
-			if len(instance.Title) >= 32 {
-				return m, m.handleError(fmt.Errorf("title cannot be longer than 32 characters"))
+			if len(instance.Title) >= maxTitleLength {
+				return m, m.handleError(fmt.Errorf("title cannot be longer than %d characters", maxTitleLength))
 			}
 			if err := instance.SetTitle(instance.Title + string(msg.Runes)); err != nil {
 				return m, m.handleError(err)
@@ -461,13 +632,29 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 
 		// Check if the form was submitted or canceled
 		if shouldClose {
-			if m.textInputOverlay.IsSubmitted() {
+			var startCmd tea.Cmd
+			if instance := m.namedInstance; instance != nil {
+				// Start the instance that was just named, with the prompt unless it was canceled.
+				m.namedInstance = nil
+				if m.textInputOverlay.IsSubmitted() {
+					instance.Prompt = m.textInputOverlay.GetValue()
+				}
+				startCmd = m.startNamed(instance)
+			} else if m.textInputOverlay.IsSubmitted() {
 				// Form was submitted, process the input
 				selected := m.list.GetSelectedInstance()
 				if selected == nil {
 					return m, nil
 				}
-				if err := selected.SendPrompt(m.textInputOverlay.GetValue()); err != nil {
+				if selected.Pending() {
+					// Send the prompt once the instance starts.
+					selected.Prompt = m.textInputOverlay.GetValue()
+					if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+						return m, m.handleError(err)
+					}
+				} else if err := selected.SendPrompt(m.textInputOverlay.GetValue()); err != nil {
+					return m, m.handleError(err)
+				} else if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
 					return m, m.handleError(err)
 				}
 			}
@@ -475,14 +662,14 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 			// Close the overlay and reset state
 			m.textInputOverlay = nil
 			m.state = stateDefault
-			return m, tea.Sequence(
+			return m, tea.Batch(startCmd, tea.Sequence(
 				tea.WindowSize(),
 				func() tea.Msg {
 					m.menu.SetState(ui.StateDefault)
 					m.showHelpScreen(helpTypeInstanceStart, nil)
 					return nil
 				},
-			)
+			))
 		}
 
 		return m, nil
@@ -515,41 +702,18 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 					return m, m.handleError(err)
 				}
 
-				// Start the instance
-				if err := instance.Start(true); err != nil {
-					return m, m.handleError(err)
-				}
-
-				// Add to list and save
-				m.newInstanceFinalizer = m.list.AddInstance(instance)
-				m.list.SetSelectedInstance(m.list.NumInstances() - 1)
-				if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+				// Start the instance with its prompt, or keep it pending if we're at a limit
+				instance.Prompt = prompt
+				startCmd, err := m.startOrDefer(instance)
+				if err != nil {
 					return m, m.handleError(err)
 				}
 
-				// Call the finalizer and set autoyes if needed
-				m.newInstanceFinalizer()
-				if m.autoYes {
-					instance.AutoYes = true
-				}
-
-				// Close the overlay and reset state first
+				// Close the overlay and reset state
 				m.textInputOverlay = nil
 				m.state = stateDefault
 				m.menu.SetState(ui.StateDefault)
-
-				// Send the prompt after a brief delay to allow Claude to initialize
-				return m, tea.Sequence(
-					tea.WindowSize(),
-					m.instanceChanged(),
-					func() tea.Msg {
-						time.Sleep(1000 * time.Millisecond) // Give Claude time to start
-						if err := instance.SendPrompt(prompt); err != nil {
-							log.ErrorLog.Printf("Failed to send prompt: %v", err)
-						}
-						return nil
-					},
-				)
+				return m, tea.Batch(tea.WindowSize(), m.instanceChanged(), startCmd)
 			}
 
 			// Close the overlay and reset state
@@ -616,6 +780,10 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		return m.handleQuitConfirmation()
 	}
 
+	if m.isTranscriptKey(msg) {
+		return m.handleTranscriptKey(msg)
+	}
+
 	name, ok := keys.GlobalKeyStringsMap[msg.String()]
 	if !ok {
 		return m, nil
@@ -625,32 +793,22 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 	case keys.KeyHelp:
 		return m.showHelpScreen(helpTypeGeneral, nil)
 	case keys.KeyPrompt:
-		if m.list.NumInstances() >= GlobalInstanceLimit {
-			return m, m.handleError(
-				fmt.Errorf("you can't create more than %d instances", GlobalInstanceLimit))
-		}
-		instance, err := session.NewInstance(session.InstanceOptions{
-			Title:   "",
-			Path:    ".",
-			Program: m.program,
-		})
-		if err != nil {
-			return m, m.handleError(err)
-		}
-
-		m.newInstanceFinalizer = m.list.AddInstance(instance)
-		m.list.SetSelectedInstance(m.list.NumInstances() - 1)
-		m.state = stateNew
-		m.menu.SetState(ui.StateNewInstance)
-		m.promptAfterName = true
-
-		return m, nil
+		return m, m.newInstance(session.InstanceOptions{})
+	case keys.KeyNewFromBase:
+		m.state = stateBaseRef
+		m.menu.SetState(ui.StatePrompt)
+		suggestions := m.baseRefSuggestions()
+		m.textInputOverlay = overlay.NewTextInputOverlay(
+			"Base for the new session: branch, tag, commit or origin/<branch> (ctrl-p/ctrl-n for suggestions)", suggestions[0])
+		m.textInputOverlay.SetHistory(suggestions[1:])
+		return m, tea.WindowSize()
+	case keys.KeyAdopt:
+		m.state = stateAdopt
+		m.menu.SetState(ui.StatePrompt)
+		m.textInputOverlay = overlay.NewTextInputOverlay(
+			"Branch, remote branch or pull request (#42) to continue in a new session", "")
+		return m, tea.WindowSize()
 	case keys.KeyNew:
-		if m.list.NumInstances() >= GlobalInstanceLimit {
-			return m, m.handleError(
-				fmt.Errorf("you can't create more than %d instances", GlobalInstanceLimit))
-		}
-
 		// Go to prompt collection state for name generation
 		m.state = statePromptForName
 		m.menu.SetState(ui.StatePrompt)
@@ -658,6 +816,86 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		m.textInputOverlay = overlay.NewTextInputOverlay("Enter prompt for new session", "")
 
 		return m, tea.WindowSize()
+	case keys.KeyFanOut:
+		m.state = stateFanOutPrompt
+		m.menu.SetState(ui.StatePrompt)
+		m.textInputOverlay = overlay.NewTextInputOverlay("Enter prompt to fan out", "")
+
+		return m, tea.WindowSize()
+	case keys.KeyFilter:
+		m.state = stateFilter
+		m.list.SetFilter(m.list.Filter(), true)
+		return m, m.instanceChanged()
+	case keys.KeyGroupBy:
+		groupBy := m.list.CycleGroupBy()
+		if err := m.appState.SetListGroupBy(string(groupBy)); err != nil {
+			log.WarningLog.Printf("Failed to save list grouping: %v", err)
+		}
+		return m, m.instanceChanged()
+	case keys.KeyTag:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil {
+			return m, nil
+		}
+		m.state = stateTag
+		m.menu.SetState(ui.StatePrompt)
+		m.textInputOverlay = overlay.NewTextInputOverlay(
+			fmt.Sprintf("Tags for '%s', comma separated", selected.Title), strings.Join(selected.Tags, ", "))
+		return m, tea.WindowSize()
+	case keys.KeyProject:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil {
+			return m, nil
+		}
+		m.state = stateProject
+		m.menu.SetState(ui.StatePrompt)
+		m.textInputOverlay = overlay.NewTextInputOverlay(
+			fmt.Sprintf("Project of '%s', empty for none", selected.Title), selected.Project)
+		return m, tea.WindowSize()
+	case keys.KeySendPrompt:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil || selected.Paused() || (!selected.Started() && !selected.Pending()) {
+			return m, nil
+		}
+		m.state = stateSendPrompt
+		m.menu.SetState(ui.StatePrompt)
+		if selected.Pending() {
+			// A pending instance hasn't been sent anything yet, so this edits the prompt it starts with.
+			m.textInputOverlay = overlay.NewTextInputOverlay(
+				fmt.Sprintf("Prompt to send when '%s' starts", selected.Title), selected.Prompt)
+		} else {
+			m.textInputOverlay = overlay.NewTextInputOverlay(fmt.Sprintf("Send prompt to '%s'", selected.Title), "")
+			m.textInputOverlay.SetHistory(selected.PromptHistory())
+		}
+		return m, tea.WindowSize()
+	case keys.KeyInbox:
+		return m, m.openInbox()
+	case keys.KeyCompare:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil || selected.Group == "" {
+			return m, nil
+		}
+		attempts := session.GroupMembers(m.list.GetInstances(), selected.Group)
+		// The comparison is read-only, so show it like a help screen that any key dismisses.
+		m.textOverlay = overlay.NewTextOverlay(ui.RenderComparison(selected.Group, attempts, int(float32(m.windowWidth)*0.8)))
+		m.state = stateHelp
+		return m, nil
+	case keys.KeyKeepWinner:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil || selected.Group == "" {
+			return m, nil
+		}
+		others := len(session.GroupMembers(m.list.GetInstances(), selected.Group)) - 1
+
+		keepAction := func() tea.Msg {
+			if _, err := m.keepWinner(selected); err != nil {
+				return err
+			}
+			return instanceChangedMsg{}
+		}
+
+		message := fmt.Sprintf("[!] Keep '%s' and kill the %d other attempts?", selected.Title, others)
+		return m, m.confirmAction(message, keepAction)
 	case keys.KeyUp:
 		m.list.Up()
 		return m, m.instanceChanged()
@@ -665,18 +903,18 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		m.list.Down()
 		return m, m.instanceChanged()
 	case keys.KeyShiftUp:
-		if m.tabbedWindow.IsInDiffTab() {
+		if m.tabbedWindow.IsScrollable() {
 			m.tabbedWindow.ScrollUp()
 		}
 		return m, m.instanceChanged()
 	case keys.KeyShiftDown:
-		if m.tabbedWindow.IsInDiffTab() {
+		if m.tabbedWindow.IsScrollable() {
 			m.tabbedWindow.ScrollDown()
 		}
 		return m, m.instanceChanged()
 	case keys.KeyTab:
 		m.tabbedWindow.Toggle()
-		m.menu.SetInDiffTab(m.tabbedWindow.IsInDiffTab())
+		m.menu.SetScrollable(m.tabbedWindow.IsScrollable())
 		return m, m.instanceChanged()
 	case keys.KeyKill:
 		selected := m.list.GetSelectedInstance()
@@ -686,19 +924,13 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 
 		// Create the kill action as a tea.Cmd
 		killAction := func() tea.Msg {
-			// Get worktree and check if branch is checked out
-			worktree, err := selected.GetGitWorktree()
-			if err != nil {
+			if err := selected.CheckKillable(); err != nil {
 				return err
 			}
-
-			checkedOut, err := worktree.IsBranchCheckedOut()
-			if err != nil {
-				return err
-			}
-
-			if checkedOut {
-				return fmt.Errorf("instance %s is currently checked out", selected.Title)
+			if m.appConfig.ArchiveOnKill && selected.Started() {
+				if _, err := selected.Archive(m.archive); err != nil {
+					return err
+				}
 			}
 
 			// Delete from storage first
@@ -708,11 +940,17 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 
 			// Then kill the instance
 			m.list.Kill()
+			if err := selected.HookError(); err != nil {
+				return fmt.Errorf("%s: %w", selected.Title, err)
+			}
 			return instanceChangedMsg{}
 		}
 
 		// Show confirmation modal
 		message := fmt.Sprintf("[!] Kill session '%s'?", selected.Title)
+		if m.appConfig.ArchiveOnKill {
+			message = fmt.Sprintf("[!] Archive and kill session '%s'?", selected.Title)
+		}
 		return m, m.confirmAction(message, killAction)
 	case keys.KeySubmit:
 		selected := m.list.GetSelectedInstance()
@@ -747,6 +985,8 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		m.showHelpScreen(helpTypeInstanceCheckout, func() {
 			if err := selected.Pause(); err != nil {
 				m.handleError(err)
+			} else {
+				m.handleHookError(selected)
 			}
 			m.instanceChanged()
 		})
@@ -756,75 +996,80 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		if selected == nil {
 			return m, nil
 		}
+		if err := session.CheckLimits(m.appConfig.Limits, selected, m.list.GetInstances()); err != nil {
+			return m, m.handleError(fmt.Errorf("can't resume '%s': %w", selected.Title, err))
+		}
 		if err := selected.Resume(); err != nil {
 			return m, m.handleError(err)
 		}
-		return m, tea.WindowSize()
+		return m, tea.Batch(tea.WindowSize(), m.handleHookError(selected))
+	case keys.KeyRestart:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil || selected.Paused() || !selected.Started() {
+			return m, nil
+		}
+		// There's nothing to lose when the agent already exited, otherwise ask first.
+		if selected.Status == session.Exited {
+			if err := selected.Restart(); err != nil {
+				return m, m.handleError(err)
+			}
+			return m, tea.WindowSize()
+		}
+		restartAction := func() tea.Msg {
+			if err := selected.Restart(); err != nil {
+				return err
+			}
+			return instanceChangedMsg{}
+		}
+		message := fmt.Sprintf("[!] Restart the agent in session '%s'?", selected.Title)
+		return m, m.confirmAction(message, tea.Sequence(restartAction, tea.WindowSize()))
 	case keys.KeyEnter:
 		if m.list.NumInstances() == 0 {
 			return m, nil
 		}
+		if _, ok := m.list.SelectedGroup(); ok {
+			m.list.ToggleCollapsed()
+			return m, m.instanceChanged()
+		}
 		selected := m.list.GetSelectedInstance()
-		if selected == nil || selected.Paused() || !selected.TmuxAlive() {
+		if selected == nil || selected.Paused() || !selected.Started() || !selected.TmuxAlive() {
 			return m, nil
 		}
 		// Show help screen before attaching
 		m.showHelpScreen(helpTypeInstanceAttach, func() {
-			ch, err := m.list.Attach()
-			if err != nil {
-				m.handleError(err)
-				return
-			}
-			<-ch
-			m.state = stateDefault
+			m.attach(m.tabbedWindow.PreviewWindow())
 		})
 		return m, nil
 	case keys.KeyOpenWorktree:
 		selected := m.list.GetSelectedInstance()
-		if selected == nil {
+		if selected == nil || selected.Paused() || !selected.Started() || !selected.TmuxAlive() {
 			return m, nil
 		}
-
-		// Get the worktree path
-		worktree, err := selected.GetGitWorktree()
+		window, err := selected.OpenShell()
 		if err != nil {
-			return m, m.handleError(fmt.Errorf("failed to get worktree: %v", err))
+			return m, m.handleError(err)
+		}
+		if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+			return m, m.handleError(err)
 		}
 
-		worktreePath := worktree.GetWorktreePath()
-		sessionName := fmt.Sprintf("%s-tree", selected.Title)
-
-		// Show help screen before attaching to worktree session (similar to 'o' key)
+		// Show help screen before attaching to the shell (similar to 'o' key)
 		m.showHelpScreen(helpTypeInstanceAttach, func() {
-			// Create a tmux session for the worktree using proper TmuxSession infrastructure
-			// Use shell as program to ensure it starts properly
-			tmuxSession := tmux.NewTmuxSession(sessionName, "$SHELL")
-
-			// Check if session already exists
-			if tmuxSession.DoesSessionExist() {
-				// Session exists, restore and attach to it
-				if err := tmuxSession.Restore(); err != nil {
-					m.handleError(fmt.Errorf("failed to restore worktree session: %v", err))
-					return
-				}
-			} else {
-				// Create new session in the worktree directory
-				if err := tmuxSession.Start(worktreePath); err != nil {
-					m.handleError(fmt.Errorf("failed to create worktree session: %v", err))
-					return
-				}
-			}
-
-			// Attach to the session using proper TmuxSession infrastructure
-			ch, err := tmuxSession.Attach()
-			if err != nil {
-				m.handleError(fmt.Errorf("failed to attach to worktree session: %v", err))
-				return
-			}
-			<-ch
-			m.state = stateDefault
+			m.attach(window)
 		})
-		return m, nil
+		// The pane is resized to make room for the window switcher in the preview.
+		return m, tea.WindowSize()
+	case keys.KeyInteractive:
+		return m, m.enterInteractive()
+	case keys.KeyGrid:
+		m.tabbedWindow.CycleGridLayout()
+		m.menu.SetScrollable(m.tabbedWindow.IsScrollable())
+		cmd := m.instanceChanged()
+		m.setPreviewSizes()
+		return m, cmd
+	case keys.KeyNextWindow:
+		m.tabbedWindow.NextPreviewWindow()
+		return m, m.instanceChanged()
 	case keys.KeyRebase:
 		selected := m.list.GetSelectedInstance()
 		if selected == nil {
@@ -839,7 +1084,7 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 				log.ErrorLog.Printf("failed to get git worktree for rebase: %v", err)
 				return err
 			}
-			if err = worktree.RebaseOntoDefault(); err != nil {
+			if err = worktree.RebaseOntoBase(); err != nil {
 				log.ErrorLog.Printf("rebase failed for session '%s': %v", selected.Title, err)
 				return err
 			}
@@ -848,13 +1093,649 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		}
 
 		// Show confirmation modal
-		message := fmt.Sprintf("[!] Rebase session '%s' onto default branch?", selected.Title)
-		return m, m.confirmActionWithLoading(message, rebaseAction, "Rebasing onto default branch...")
+		message := fmt.Sprintf("[!] Rebase session '%s' onto its base branch?", selected.Title)
+		return m, m.confirmActionWithLoading(message, rebaseAction, "Rebasing onto base branch...")
 	default:
 		return m, nil
 	}
 }
 
+// pendingCheckInterval is how often we try to start pending instances and queued prompts. Checking the disk usage limit walks every
+// worktree, so don't do it on every metadata tick.
+const pendingCheckInterval = 5 * time.Second
+
+// startOrDefer starts a new instance off the UI loop, see startInstance, or adds it to the list as pending, see
+// deferInstance. The returned Cmd starts it, or tells the user it's pending.
+func (m *home) startOrDefer(instance *session.Instance) (tea.Cmd, error) {
+	pendingCmd, err := m.deferInstance(instance)
+	if err != nil || instance.Pending() {
+		return pendingCmd, err
+	}
+	return m.startInstance(instance), nil
+}
+
+// deferInstance adds a new instance to the list as pending if starting it would exceed one of the configured limits,
+// or if another instance is being started. It returns a Cmd that tells the user so, or nil if the instance can be
+// started.
+func (m *home) deferInstance(instance *session.Instance) (tea.Cmd, error) {
+	var reason error
+	if m.starting != nil {
+		reason = fmt.Errorf("'%s' is being started", m.starting.Title)
+	} else if err := session.CheckLimits(m.appConfig.Limits, instance, m.list.GetInstances()); err != nil {
+		if !errors.Is(err, session.ErrLimitReached) {
+			return nil, err
+		}
+		reason = err
+	} else {
+		return nil, nil
+	}
+
+	instance.SetStatus(session.Pending)
+	m.list.AddInstance(instance)()
+	if m.autoYes {
+		instance.AutoYes = true
+	}
+	if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+		return nil, err
+	}
+	return m.handleError(fmt.Errorf("'%s' is pending and will start when there's room (%w)", instance.Title, reason)), nil
+}
+
+// startInstance starts an instance off the UI loop, since creating its worktree and running the repo's hooks can take
+// minutes. It isn't in the list until it's started, so nothing on the loop touches it meanwhile: it's shown as
+// starting, and joins the list in handleInstanceStarted.
+func (m *home) startInstance(instance *session.Instance) tea.Cmd {
+	m.setStarting(instance)
+	return func() tea.Msg {
+		return instanceStartedMsg{instance: instance, err: instance.Start(true)}
+	}
+}
+
+// setStarting sets the instance being started, or nil once it's done.
+func (m *home) setStarting(instance *session.Instance) {
+	m.starting = instance
+	if instance == nil {
+		m.list.SetStarting("")
+		return
+	}
+	instance.SetStatus(session.Loading)
+	m.list.SetStarting(instance.Title)
+}
+
+// startNamed starts the instance that was just named in the list, or leaves it there as pending. It's taken out of
+// the list while it starts.
+func (m *home) startNamed(instance *session.Instance) tea.Cmd {
+	// It isn't started, so this only removes it from the list.
+	m.list.KillInstance(instance)
+	startCmd, err := m.startOrDefer(instance)
+	if err != nil {
+		return tea.Batch(m.handleError(err), tea.WindowSize(), m.instanceChanged())
+	}
+	return tea.Batch(startCmd, tea.WindowSize(), m.instanceChanged())
+}
+
+// handleInstanceStarted adds an instance that was started off the UI loop to the list and sends it its prompt, then
+// starts the next pending instance or queued prompt.
+func (m *home) handleInstanceStarted(msg instanceStartedMsg) tea.Cmd {
+	m.setStarting(nil)
+	instance := msg.instance
+	if msg.err != nil {
+		// Start cleans up after itself, so the instance is dropped rather than retried forever.
+		cmds := []tea.Cmd{m.handleError(fmt.Errorf("failed to start %s: %w", instance.Title, msg.err))}
+		if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+			cmds = append(cmds, m.handleError(err))
+		}
+		return tea.Batch(append(cmds, m.startNext())...)
+	}
+	log.InfoLog.Printf("started instance %s", instance.Title)
+
+	m.list.AddInstance(instance)()
+	if m.autoYes {
+		instance.AutoYes = true
+	}
+	cmds := []tea.Cmd{m.handleHookError(instance)}
+	if prompt := instance.Prompt; prompt != "" {
+		cmds = append(cmds, func() tea.Msg {
+			time.Sleep(1000 * time.Millisecond) // Give the program time to start
+			if err := instance.SendPrompt(prompt); err != nil {
+				log.ErrorLog.Printf("Failed to send prompt: %v", err)
+			}
+			return nil
+		})
+	}
+	if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+		cmds = append(cmds, m.handleError(err))
+	}
+	return tea.Batch(append(cmds, tea.WindowSize(), m.instanceChanged(), m.startNext())...)
+}
+
+// startNext starts the oldest pending instance, or else a session for the oldest queued prompt, if there's room and
+// no other instance is being started.
+func (m *home) startNext() tea.Cmd {
+	cmd := m.startPendingInstance()
+	if m.starting != nil {
+		return cmd
+	}
+	return tea.Batch(cmd, m.drainQueue())
+}
+
+// titles returns the titles of the instances, including the one being started, for new ones not to reuse them.
+func (m *home) titles() []string {
+	titles := make([]string, 0, m.list.NumInstances()+1)
+	for _, instance := range m.list.GetInstances() {
+		titles = append(titles, instance.Title)
+	}
+	if m.starting != nil {
+		titles = append(titles, m.starting.Title)
+	}
+	return titles
+}
+
+// handleHookError shows why the repo's hooks last failed for the instance, if they did. The instance goes on
+// regardless.
+func (m *home) handleHookError(instance *session.Instance) tea.Cmd {
+	err := instance.HookError()
+	if err == nil {
+		return nil
+	}
+	cmd := m.handleError(fmt.Errorf("%s: %w", instance.Title, err))
+	var untrusted *session.UntrustedSettingsError
+	if errors.As(err, &untrusted) {
+		return tea.Batch(cmd, func() tea.Msg { return untrustedSettingsMsg{untrusted} })
+	}
+	return cmd
+}
+
+// confirmTrust asks the user to trust the hooks, symlinks and window commands of a repo's settings, which were skipped because they
+// weren't. Once trusted, they're made and run for every running instance of the repo that skipped them.
+func (m *home) confirmTrust(untrusted *session.UntrustedSettingsError) tea.Cmd {
+	var instances []*session.Instance
+	for _, instance := range m.list.GetInstances() {
+		var err *session.UntrustedSettingsError
+		if errors.As(instance.HookError(), &err) && err.RepoPath == untrusted.RepoPath {
+			instances = append(instances, instance)
+		}
+	}
+	trustAction := func() tea.Msg {
+		if err := config.TrustRepoSettings(untrusted.RepoPath, untrusted.Settings); err != nil {
+			return err
+		}
+		var errs []error
+		for _, instance := range instances {
+			if err := instance.TrustSettings(untrusted.Settings); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", instance.Title, err))
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+		return instanceChangedMsg{}
+	}
+	message := fmt.Sprintf("[!] Trust the hooks, symlinks and window commands of %s? They run on your machine:\n%s",
+		filepath.Base(untrusted.RepoPath), strings.Join(untrusted.Settings.TrustItems(), "\n"))
+	return m.confirmAction(message, trustAction)
+}
+
+// handleFilterState handles key events while the list filter is typed. The list narrows as you type, enter keeps the
+// filter and esc clears it.
+func (m *home) handleFilterState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	filter := m.list.Filter()
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.list.SetFilter(filter, false)
+		m.state = stateDefault
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.list.SetFilter("", false)
+		m.state = stateDefault
+	case tea.KeyBackspace:
+		if runes := []rune(filter); len(runes) > 0 {
+			m.list.SetFilter(string(runes[:len(runes)-1]), true)
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.list.SetFilter(filter+string(msg.Runes), true)
+	case tea.KeyUp:
+		m.list.Up()
+	case tea.KeyDown:
+		m.list.Down()
+	}
+	return m, m.instanceChanged()
+}
+
+// isTranscriptKey returns true if msg is a search key of the transcript tab. The search keys shadow the global keys
+// while the transcript tab is shown, and n, N and esc only do so while there is a search.
+func (m *home) isTranscriptKey(msg tea.KeyMsg) bool {
+	if m.state != stateDefault || !m.tabbedWindow.IsInTranscriptTab() {
+		return false
+	}
+	switch msg.String() {
+	case "/":
+		return true
+	case "n", "N", "esc":
+		return m.tabbedWindow.Transcript().Searching()
+	}
+	return false
+}
+
+// handleTranscriptKey handles the search keys of the transcript tab.
+func (m *home) handleTranscriptKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	transcript := m.tabbedWindow.Transcript()
+	switch msg.String() {
+	case "/":
+		m.state = stateTranscriptSearch
+		transcript.SetSearch("", true)
+	case "n":
+		transcript.NextMatch()
+	case "N":
+		transcript.PrevMatch()
+	case "esc":
+		transcript.SetSearch("", false)
+	}
+	return m, nil
+}
+
+// handleTranscriptSearchState handles key events while a search of the transcript is typed. The transcript jumps to
+// the first match as you type.
+func (m *home) handleTranscriptSearchState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	transcript := m.tabbedWindow.Transcript()
+	query := transcript.Query()
+	switch msg.Type {
+	case tea.KeyEnter:
+		transcript.SetSearch(query, false)
+		m.state = stateDefault
+	case tea.KeyEsc, tea.KeyCtrlC:
+		transcript.SetSearch("", false)
+		m.state = stateDefault
+	case tea.KeyBackspace:
+		if runes := []rune(query); len(runes) > 0 {
+			transcript.SetSearch(string(runes[:len(runes)-1]), true)
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		transcript.SetSearch(query+string(msg.Runes), true)
+	}
+	return m, nil
+}
+
+// newInstance adds an instance with the given base ref or branch to adopt to the list and starts naming it, starting
+// with opts.Title. It's prompted for once it's named.
+func (m *home) newInstance(opts session.InstanceOptions) tea.Cmd {
+	opts.Path = "."
+	opts.Program = m.program
+	instance, err := session.NewInstance(opts)
+	if err != nil {
+		return m.handleError(err)
+	}
+
+	m.list.AddInstance(instance)
+	m.list.SetSelectedInstance(m.list.NumInstances() - 1)
+	m.state = stateNew
+	m.menu.SetState(ui.StateNewInstance)
+	m.promptAfterName = true
+	return nil
+}
+
+// baseRefSuggestions returns the refs a new instance is likely to branch from: the default branch, the default
+// branch of origin and the branches of the other instances, starting with the selected one's for stacked work.
+func (m *home) baseRefSuggestions() []string {
+	var suggestions []string
+	if defaultBranch, err := config.GetDefaultBranch("."); err != nil {
+		log.WarningLog.Printf("could not get the default branch to suggest it: %v", err)
+	} else {
+		suggestions = append(suggestions, defaultBranch, "origin/"+defaultBranch)
+	}
+	if selected := m.list.GetSelectedInstance(); selected != nil && selected.Started() {
+		suggestions = append(suggestions, selected.Branch)
+	}
+	for _, instance := range m.list.GetInstances() {
+		if instance.Started() && !slices.Contains(suggestions, instance.Branch) {
+			suggestions = append(suggestions, instance.Branch)
+		}
+	}
+	// The first suggestion is the initial value, an empty one branches from HEAD.
+	if len(suggestions) == 0 {
+		suggestions = append(suggestions, "")
+	}
+	return suggestions
+}
+
+// handleBaseRefState handles key events while the base ref of a new instance is entered. The instance is named next.
+func (m *home) handleBaseRefState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if !m.textInputOverlay.HandleKeyPress(msg) {
+		return m, nil
+	}
+	submitted := m.textInputOverlay.IsSubmitted()
+	value := strings.TrimSpace(m.textInputOverlay.GetValue())
+	m.textInputOverlay = nil
+	m.state = stateDefault
+	m.menu.SetState(ui.StateDefault)
+	if !submitted {
+		return m, tea.WindowSize()
+	}
+	return m, tea.Batch(tea.WindowSize(), m.newInstance(session.InstanceOptions{BaseRef: value}))
+}
+
+// handleAdoptState handles key events while the branch or pull request a new instance continues is entered. The
+// instance is named next, after the branch.
+func (m *home) handleAdoptState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if !m.textInputOverlay.HandleKeyPress(msg) {
+		return m, nil
+	}
+	submitted := m.textInputOverlay.IsSubmitted()
+	value := strings.TrimSpace(m.textInputOverlay.GetValue())
+	m.textInputOverlay = nil
+	m.state = stateDefault
+	m.menu.SetState(ui.StateDefault)
+	if !submitted || value == "" {
+		return m, tea.WindowSize()
+	}
+	title := []rune(git.AdoptedBranchName(value))
+	if len(title) > maxTitleLength {
+		title = title[:maxTitleLength]
+	}
+	return m, tea.Batch(tea.WindowSize(), m.newInstance(session.InstanceOptions{Title: string(title), Adopt: value}))
+}
+
+// handleTagState handles key events while the tags of the selected instance are edited.
+func (m *home) handleTagState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if !m.textInputOverlay.HandleKeyPress(msg) {
+		return m, nil
+	}
+	submitted := m.textInputOverlay.IsSubmitted()
+	value := m.textInputOverlay.GetValue()
+	m.textInputOverlay = nil
+	m.state = stateDefault
+	m.menu.SetState(ui.StateDefault)
+
+	var cmd tea.Cmd
+	if selected := m.list.GetSelectedInstance(); submitted && selected != nil {
+		selected.SetTags(session.ParseTags(value))
+		if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+			cmd = m.handleError(err)
+		}
+	}
+	return m, tea.Batch(tea.WindowSize(), m.instanceChanged(), cmd)
+}
+
+// handleProjectState handles key events while the project of the selected instance is being edited.
+func (m *home) handleProjectState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if !m.textInputOverlay.HandleKeyPress(msg) {
+		return m, nil
+	}
+	submitted := m.textInputOverlay.IsSubmitted()
+	value := m.textInputOverlay.GetValue()
+	m.textInputOverlay = nil
+	m.state = stateDefault
+	m.menu.SetState(ui.StateDefault)
+
+	var cmd tea.Cmd
+	if selected := m.list.GetSelectedInstance(); submitted && selected != nil {
+		selected.SetProject(value)
+		if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+			cmd = m.handleError(err)
+		}
+	}
+	return m, tea.Batch(tea.WindowSize(), m.instanceChanged(), cmd)
+}
+
+// handleSendPromptState handles key events while a prompt for the selected instance is being entered.
+func (m *home) handleSendPromptState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if !m.textInputOverlay.HandleKeyPress(msg) {
+		return m, nil
+	}
+	submitted := m.textInputOverlay.IsSubmitted()
+	value := m.textInputOverlay.GetValue()
+	m.textInputOverlay = nil
+	m.state = stateDefault
+	m.menu.SetState(ui.StateDefault)
+
+	selected := m.list.GetSelectedInstance()
+	if !submitted || selected == nil || strings.TrimSpace(value) == "" {
+		return m, tea.WindowSize()
+	}
+	if selected.Pending() {
+		selected.Prompt = value
+	} else if err := selected.SendPrompt(value); err != nil {
+		return m, tea.Batch(tea.WindowSize(), m.handleError(err))
+	}
+	// Save right away so the history survives a crash.
+	var cmd tea.Cmd
+	if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+		cmd = m.handleError(err)
+	}
+	return m, tea.Batch(tea.WindowSize(), m.instanceChanged(), cmd)
+}
+
+// handleFanOutState handles key events while the prompt and then the programs of a fan-out are collected.
+func (m *home) handleFanOutState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if !m.textInputOverlay.HandleKeyPress(msg) {
+		return m, nil
+	}
+	submitted := m.textInputOverlay.IsSubmitted()
+	value := m.textInputOverlay.GetValue()
+	m.textInputOverlay = nil
+
+	if submitted && m.state == stateFanOutPrompt {
+		if strings.TrimSpace(value) != "" {
+			m.fanOutPrompt = value
+			m.state = stateFanOutPrograms
+			m.textInputOverlay = overlay.NewTextInputOverlay(
+				"Programs to run, e.g. claude x2, codex", strings.Join(m.fanOutSpecs(), ", "))
+			return m, tea.WindowSize()
+		}
+	}
+
+	prompt := m.fanOutPrompt
+	m.fanOutPrompt = ""
+	m.state = stateDefault
+	m.menu.SetState(ui.StateDefault)
+	if !submitted {
+		return m, tea.Sequence(tea.WindowSize(), m.instanceChanged())
+	}
+	if prompt == "" {
+		return m, m.handleError(fmt.Errorf("prompt cannot be empty"))
+	}
+
+	title, err := session.GenerateSessionName(prompt, nil)
+	if err != nil {
+		return m, m.handleError(fmt.Errorf("failed to generate session name: %w", err))
+	}
+	specs := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' })
+	_, cmd, err := m.fanOut(title, ".", prompt, specs)
+	if err != nil {
+		return m, tea.Batch(cmd, m.handleError(err))
+	}
+	return m, tea.Batch(tea.WindowSize(), m.instanceChanged(), cmd)
+}
+
+// fanOutSpecs returns the configured fan-out programs, or three runs of the default program.
+func (m *home) fanOutSpecs() []string {
+	if len(m.appConfig.FanOutPrograms) > 0 {
+		return m.appConfig.FanOutPrograms
+	}
+	return []string{fmt.Sprintf("%s x3", m.program)}
+}
+
+// fanOut creates a group of instances that attempt the same prompt, see startOrDefer. It returns the instances that
+// were created and a Cmd that starts them.
+func (m *home) fanOut(title string, path string, prompt string, specs []string) ([]*session.Instance, tea.Cmd, error) {
+	if len(specs) == 0 {
+		specs = m.fanOutSpecs()
+	}
+	programs, err := session.ParseFanOutPrograms(specs, m.program)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attempts, err := session.NewFanOut(session.FanOutOptions{
+		Title:    title,
+		Path:     path,
+		Prompt:   prompt,
+		Programs: programs,
+	}, m.titles())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The first attempt starts right away, the others wait as pending and start one after the other.
+	var added []*session.Instance
+	var cmds []tea.Cmd
+	for _, instance := range attempts {
+		startCmd, err := m.startOrDefer(instance)
+		if err != nil {
+			cmds = append(cmds, m.handleError(fmt.Errorf("failed to start %s: %w", instance.Title, err)))
+			continue
+		}
+		added = append(added, instance)
+		cmds = append(cmds, startCmd)
+	}
+	if len(added) == 0 {
+		return nil, tea.Batch(cmds...), fmt.Errorf("failed to start any attempt of %s", title)
+	}
+	return added, tea.Batch(cmds...), nil
+}
+
+// keepWinner keeps the given attempt of a fan-out and kills the others. It returns the titles of the killed attempts.
+func (m *home) keepWinner(winner *session.Instance) ([]string, error) {
+	losers, err := session.KeepWinner(m.list.GetInstances(), winner)
+	if err != nil {
+		return nil, err
+	}
+
+	killed := []string{}
+	var errs []error
+	for _, loser := range losers {
+		if err := loser.CheckKillable(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if m.appConfig.ArchiveOnKill && loser.Started() {
+			if _, err := loser.Archive(m.archive); err != nil {
+				errs = append(errs, fmt.Errorf("failed to archive '%s': %w", loser.Title, err))
+				continue
+			}
+		}
+		m.list.KillInstance(loser)
+		killed = append(killed, loser.Title)
+	}
+	if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+		errs = append(errs, err)
+	}
+	return killed, errors.Join(errs...)
+}
+
+// startPendingInstance starts the oldest pending instance if there's room for it under the limits and no other
+// instance is being started. It's taken out of the list while it starts.
+func (m *home) startPendingInstance() tea.Cmd {
+	if m.starting != nil {
+		return nil
+	}
+	for _, instance := range m.list.GetInstances() {
+		if !instance.Pending() {
+			continue
+		}
+		if err := session.CheckLimits(m.appConfig.Limits, instance, m.list.GetInstances()); err != nil {
+			if !errors.Is(err, session.ErrLimitReached) {
+				log.WarningLog.Printf("could not check limits for pending instance %s: %v", instance.Title, err)
+			}
+			// Start pending instances in order, don't let a later one jump the queue.
+			return nil
+		}
+		log.InfoLog.Printf("starting pending instance %s", instance.Title)
+		// It isn't started, so this only removes it from the list.
+		m.list.KillInstance(instance)
+		return tea.Batch(m.startInstance(instance), tea.WindowSize(), m.instanceChanged())
+	}
+	return nil
+}
+
+// measureDiskUsage measures the worktrees of the live instances for the disk limit every session.DiskUsageInterval,
+// so checking the limits doesn't have to. It walks every worktree, so it's done off the UI loop, and only if there's
+// a disk limit.
+func (m *home) measureDiskUsage() tea.Cmd {
+	if m.appConfig.Limits.MaxWorktreeDiskMB <= 0 || m.measuringDisk ||
+		time.Since(m.lastDiskUsage) < session.DiskUsageInterval {
+		return nil
+	}
+	var live []*session.Instance
+	for _, instance := range m.list.GetInstances() {
+		if instance.Started() && !instance.Paused() {
+			live = append(live, instance)
+		}
+	}
+	m.lastDiskUsage = time.Now()
+	m.measuringDisk = true
+	return func() tea.Msg {
+		for _, instance := range live {
+			instance.UpdateDiskUsage()
+		}
+		return diskUsageMeasuredMsg{}
+	}
+}
+
+// drainQueue starts a session for the oldest queued prompt if fewer than the configured number of instances are
+// live and no other instance is being started, see startInstance.
+func (m *home) drainQueue() tea.Cmd {
+	if m.starting != nil {
+		return nil
+	}
+	instance, err := m.queue.Next(m.appConfig.QueueConcurrency, m.appConfig.Limits, m.program, m.list.GetInstances())
+	m.list.SetQueue(m.queue.Items())
+
+	var cmds []tea.Cmd
+	if err != nil {
+		cmds = append(cmds, m.handleError(err))
+	}
+	if instance == nil {
+		return tea.Batch(cmds...)
+	}
+	log.InfoLog.Printf("starting queued prompt %s", instance.Title)
+	return tea.Batch(append(cmds, m.startInstance(instance))...)
+}
+
+// attach attaches to the window of the selected instance, or to its agent if window is empty, until the user detaches.
+// The actions chosen in the attach palette are done in between, e.g. switching to the next instance attaches to it.
+func (m *home) attach(window string) {
+	attachable := func(instance *session.Instance) bool {
+		return instance.Started() && !instance.Paused() && instance.TmuxAlive()
+	}
+	defer func() {
+		// Detaching gives the session a new PTY of the default size.
+		m.setPreviewSizes()
+		m.instanceChanged()
+	}()
+	for {
+		ch, err := m.list.Attach(window)
+		if err != nil {
+			m.handleError(fmt.Errorf("failed to attach: %w", err))
+			return
+		}
+		result := <-ch
+		selected := m.list.GetSelectedInstance()
+		switch result.Action {
+		case tmux.AttachDetach:
+			m.state = stateDefault
+			return
+		case tmux.AttachNext, tmux.AttachPrevious:
+			if m.list.SelectNextInstance(result.Action == tmux.AttachNext, attachable) {
+				window = ""
+			}
+		case tmux.AttachSendPrompt:
+			if err := selected.SendPrompt(m.appConfig.SavedPrompts[result.Prompt]); err != nil {
+				m.handleError(err)
+				m.state = stateDefault
+				return
+			}
+		case tmux.AttachToggleAutoYes:
+			selected.AutoYes = !selected.AutoYes
+		case tmux.AttachPause:
+			if err := selected.Pause(); err != nil {
+				m.handleError(err)
+			}
+			m.state = stateDefault
+			return
+		}
+	}
+}
+
 // instanceChanged updates the preview pane, menu, and diff pane based on the selected instance. It returns an error
 // Cmd if there was any error.
 func (m *home) instanceChanged() tea.Cmd {
@@ -862,11 +1743,21 @@ func (m *home) instanceChanged() tea.Cmd {
 	selected := m.list.GetSelectedInstance()
 
 	m.tabbedWindow.UpdateDiff(selected)
+	m.tabbedWindow.UpdateHistory(selected)
 	// Update menu with current instance
 	m.menu.SetInstance(selected)
 
 	// If there's no selected instance, we don't need to update the preview.
-	if err := m.tabbedWindow.UpdatePreview(selected); err != nil {
+	if err := m.tabbedWindow.UpdatePreview(selected, m.list.VisibleInstances()); err != nil {
+		return m.handleError(err)
+	}
+	// The tiles of the auto layout get smaller as instances are added to the grid.
+	if m.tabbedWindow.GridLayout() != ui.GridOff {
+		if width, height := m.tabbedWindow.GetGridTileSize(); width != m.sessionWidth || height != m.sessionHeight {
+			m.setPreviewSizes()
+		}
+	}
+	if err := m.tabbedWindow.UpdateTranscript(selected); err != nil {
 		return m.handleError(err)
 	}
 	return nil
@@ -897,6 +1788,21 @@ type tickUpdateMetadataMessage struct{}
 
 type instanceChangedMsg struct{}
 
+// untrustedSettingsMsg is sent when the hooks, symlinks and window commands of a repo's settings were skipped for an instance because
+// the user hasn't trusted them.
+type untrustedSettingsMsg struct {
+	err *session.UntrustedSettingsError
+}
+
+// diskUsageMeasuredMsg is sent when measureDiskUsage is done.
+type diskUsageMeasuredMsg struct{}
+
+// instanceStartedMsg is sent when an instance that was started off the UI loop was started, or failed to.
+type instanceStartedMsg struct {
+	instance *session.Instance
+	err      error
+}
+
 // tickUpdateMetadataCmd is the callback to update the metadata of the instances every 500ms. Note that we iterate
 // overall the instances and capture their output. It's a pretty expensive operation. Let's do it 2x a second only.
 var tickUpdateMetadataCmd = func() tea.Msg {
@@ -904,6 +1810,12 @@ var tickUpdateMetadataCmd = func() tea.Msg {
 	return tickUpdateMetadataMessage{}
 }
 
+// ringBell rings the terminal bell to tell the user that a session needs attention.
+func ringBell() tea.Msg {
+	fmt.Fprint(os.Stderr, "\a")
+	return nil
+}
+
 // handleError handles all errors which get bubbled up to the app. sets the error message. We return a callback tea.Cmd that returns a hideErrMsg message
 // which clears the error message after 3 seconds.
 func (m *home) handleError(err error) tea.Cmd {
@@ -992,7 +1904,9 @@ func (m *home) View() string {
 		m.errBox.String(),
 	)
 
-	if m.state == statePrompt || m.state == statePromptForName {
+	if m.state == statePrompt || m.state == statePromptForName || m.state == stateFanOutPrompt ||
+		m.state == stateFanOutPrograms || m.state == stateTag || m.state == stateProject ||
+		m.state == stateSendPrompt || m.state == stateDenyMessage || m.state == stateBaseRef || m.state == stateAdopt {
 		if m.textInputOverlay == nil {
 			log.ErrorLog.Printf("text input overlay is nil")
 		}
@@ -1007,6 +1921,8 @@ func (m *home) View() string {
 			log.ErrorLog.Printf("confirmation overlay is nil")
 		}
 		return overlay.PlaceOverlay(0, 0, m.confirmationOverlay.Render(), mainView, true, true)
+	} else if m.state == stateInbox {
+		return overlay.PlaceOverlay(0, 0, m.inbox.String(), mainView, true, true)
 	} else if m.state == stateLoading {
 		if m.loadingOverlay == nil {
 			log.ErrorLog.Printf("loading overlay is nil")
@@ -3,9 +3,11 @@ package app
 import (
 	"agent-farmer/log"
 	"agent-farmer/session"
+	"agent-farmer/session/tmux"
 	"agent-farmer/ui"
 	"agent-farmer/ui/overlay"
 	"fmt"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -47,21 +49,41 @@ func (h helpType) ToContent(instance *session.Instance) string {
 			headerStyle.Render("Managing:"),
 			keyStyle.Render("N")+descStyle.Render("         - Create a new session"),
 			keyStyle.Render("n")+descStyle.Render("         - Create a new session with a prompt"),
+			keyStyle.Render("B")+descStyle.Render("         - Create a new session from a base branch, tag or commit"),
+			keyStyle.Render("A")+descStyle.Render("         - Create a new session on an existing branch or pull request"),
 			keyStyle.Render("D")+descStyle.Render("         - Kill (delete) the selected session"),
 			keyStyle.Render("↑/j, ↓/k")+descStyle.Render("  - Navigate between sessions"),
 			keyStyle.Render("↵/o")+descStyle.Render("       - Attach to the selected session"),
-			keyStyle.Render("e")+descStyle.Render("         - Open worktree in new tmux window"),
-			keyStyle.Render("ctrl-q")+descStyle.Render("    - Detach from session"),
+			keyStyle.Render("s")+descStyle.Render("         - Send a prompt, ctrl-p/ctrl-n recall earlier ones"),
+			keyStyle.Render("i")+descStyle.Render("         - Type into the selected session from the preview, e.g. to answer an approval"),
+			keyStyle.Render("a")+descStyle.Render("         - List sessions waiting for approval to approve or deny them"),
+			keyStyle.Render("e")+descStyle.Render("         - Open a shell window in the worktree"),
+			keyStyle.Render("w")+descStyle.Render("         - Switch the preview between the agent and its windows"),
+			keyStyle.Render("v")+descStyle.Render("         - Show running sessions in a grid: auto, 2x2 or 3x1"),
+			helpKey(tmux.DetachKeyName(), "Detach from session"),
+			helpKey(tmux.PaletteKeyName(), "While attached, switch sessions, send a saved prompt, toggle auto-yes or pause"),
+			"",
+			headerStyle.Render("Fan-out:"),
+			keyStyle.Render("F")+descStyle.Render("         - Run one prompt in several sessions"),
+			keyStyle.Render("C")+descStyle.Render("         - Compare the attempts of the selected fan-out"),
+			keyStyle.Render("W")+descStyle.Render("         - Keep the selected attempt and kill the rest"),
 			"",
 			headerStyle.Render("Handoff:"),
 			keyStyle.Render("p")+descStyle.Render("         - Commit and push branch to github"),
-			keyStyle.Render("R")+descStyle.Render("         - Rebase session branch onto default branch"),
+			keyStyle.Render("R")+descStyle.Render("         - Rebase session branch onto its base branch"),
 			keyStyle.Render("c")+descStyle.Render("         - Checkout: commit changes and pause session"),
 			keyStyle.Render("r")+descStyle.Render("         - Resume a paused session"),
+			keyStyle.Render("X")+descStyle.Render("         - Restart the agent in the same worktree"),
 			"",
 			headerStyle.Render("Other:"),
-			keyStyle.Render("tab")+descStyle.Render("       - Switch between preview and diff tabs"),
-			keyStyle.Render("shift-↓/↑")+descStyle.Render(" - Scroll in diff view"),
+			keyStyle.Render("/")+descStyle.Render("         - Filter sessions by title, branch, tag or project"),
+			keyStyle.Render("g")+descStyle.Render("         - Group sessions by project, repo, tag, status or fan-out"),
+			keyStyle.Render("T")+descStyle.Render("         - Edit the tags of the selected session"),
+			keyStyle.Render("P")+descStyle.Render("         - Put the selected session in a project"),
+			keyStyle.Render("↵")+descStyle.Render("         - Collapse or expand the selected group"),
+			keyStyle.Render("tab")+descStyle.Render("       - Switch between preview, diff, history and transcript tabs"),
+			keyStyle.Render("shift-↓/↑")+descStyle.Render(" - Scroll in diff, history and transcript views"),
+			keyStyle.Render("/, n/N")+descStyle.Render("    - Search the transcript, next/previous match"),
 			keyStyle.Render("q")+descStyle.Render("         - Quit the application"),
 		)
 		return content
@@ -81,7 +103,7 @@ func (h helpType) ToContent(instance *session.Instance) string {
 			keyStyle.Render("D")+descStyle.Render("     - Kill (delete) the selected session"),
 			"",
 			headerStyle.Render("Handoff:"),
-			keyStyle.Render("R")+descStyle.Render("     - Rebase session branch onto default branch"),
+			keyStyle.Render("R")+descStyle.Render("     - Rebase session branch onto its base branch"),
 			keyStyle.Render("c")+descStyle.Render("     - Checkout this instance's branch"),
 			keyStyle.Render("p")+descStyle.Render("     - Push branch to GitHub to create a PR"),
 		)
@@ -91,7 +113,8 @@ func (h helpType) ToContent(instance *session.Instance) string {
 		content := lipgloss.JoinVertical(lipgloss.Left,
 			titleStyle.Render("Attaching to Instance"),
 			"",
-			descStyle.Render("To detach from a session, press ")+keyStyle.Render("ctrl-q"),
+			descStyle.Render("To detach from a session, press ")+keyStyle.Render(tmux.DetachKeyName()),
+			paletteHelp(),
 		)
 		return content
 
@@ -113,6 +136,24 @@ func (h helpType) ToContent(instance *session.Instance) string {
 }
 
 // showHelpScreen displays the help screen overlay if it hasn't been shown before
+// helpKey returns the help line of a configurable key, aligned with the others. It's empty if the key is disabled.
+func helpKey(key string, desc string) string {
+	if key == "" {
+		return ""
+	}
+	return keyStyle.Render(key) + descStyle.Render(strings.Repeat(" ", max(1, 10-len(key)))+"- "+desc)
+}
+
+// paletteHelp tells how to open the attach palette, if it's enabled.
+func paletteHelp() string {
+	key := tmux.PaletteKeyName()
+	if key == "" {
+		return ""
+	}
+	return descStyle.Render("Press ") + keyStyle.Render(key) +
+		descStyle.Render(" for the palette: next/previous session, saved prompts, auto-yes and pause")
+}
+
 func (m *home) showHelpScreen(helpType helpType, onDismiss func()) (tea.Model, tea.Cmd) {
 	// Get the flag for this help type
 	var helpFlag uint32
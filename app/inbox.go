@@ -0,0 +1,95 @@
+package app
+
+import (
+	"agent-farmer/ui"
+	"agent-farmer/ui/overlay"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// openInbox lists the instances waiting for approval.
+func (m *home) openInbox() tea.Cmd {
+	m.inbox.Update(m.list.GetInstances())
+	m.state = stateInbox
+	return nil
+}
+
+// closeInbox goes back to the list, with the last instance picked in the inbox selected.
+func (m *home) closeInbox() tea.Cmd {
+	m.state = stateDefault
+	if selected := m.inbox.Selected(); selected != nil {
+		for i, instance := range m.list.GetInstances() {
+			if instance == selected {
+				m.list.SetSelectedInstance(i)
+			}
+		}
+	}
+	return m.instanceChanged()
+}
+
+// handleInboxState handles key events while the instances waiting for approval are listed.
+func (m *home) handleInboxState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "a", "q", "ctrl+c":
+		return m, m.closeInbox()
+	case "up", "k":
+		m.inbox.Up()
+		return m, nil
+	case "down", "j":
+		m.inbox.Down()
+		return m, nil
+	}
+
+	selected := m.inbox.Selected()
+	if selected == nil {
+		return m, nil
+	}
+	var err error
+	switch msg.String() {
+	case "y":
+		err = selected.Approve()
+	case "n":
+		err = selected.Deny("")
+	case "m":
+		m.state = stateDenyMessage
+		m.menu.SetState(ui.StatePrompt)
+		m.textInputOverlay = overlay.NewTextInputOverlay(fmt.Sprintf("Tell '%s' what to do instead", selected.Title), "")
+		return m, tea.WindowSize()
+	default:
+		return m, nil
+	}
+	m.inbox.Update(m.list.GetInstances())
+	if err != nil {
+		return m, m.handleError(err)
+	}
+	return m, nil
+}
+
+// handleDenyMessageState handles key events while the message sent with a denied approval is entered. The inbox is
+// shown again afterwards.
+func (m *home) handleDenyMessageState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if !m.textInputOverlay.HandleKeyPress(msg) {
+		return m, nil
+	}
+	submitted := m.textInputOverlay.IsSubmitted()
+	value := strings.TrimSpace(m.textInputOverlay.GetValue())
+	m.textInputOverlay = nil
+	m.state = stateInbox
+	m.menu.SetState(ui.StateDefault)
+
+	selected := m.inbox.Selected()
+	if !submitted || selected == nil || value == "" {
+		return m, tea.WindowSize()
+	}
+	var cmd tea.Cmd
+	if err := selected.Deny(value); err != nil {
+		cmd = m.handleError(err)
+	} else if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+		// Save right away so the history survives a crash.
+		cmd = m.handleError(err)
+	}
+	m.inbox.Update(m.list.GetInstances())
+	return m, tea.Batch(tea.WindowSize(), cmd)
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"agent-farmer/session/tmux"
+	"agent-farmer/ui"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// keySequences are what a terminal sends for the keys Bubble Tea doesn't keep as bytes.
+var keySequences = map[tea.KeyType]string{
+	tea.KeySpace:      " ",
+	tea.KeyUp:         "\x1b[A",
+	tea.KeyDown:       "\x1b[B",
+	tea.KeyRight:      "\x1b[C",
+	tea.KeyLeft:       "\x1b[D",
+	tea.KeyShiftTab:   "\x1b[Z",
+	tea.KeyHome:       "\x1b[H",
+	tea.KeyEnd:        "\x1b[F",
+	tea.KeyPgUp:       "\x1b[5~",
+	tea.KeyPgDown:     "\x1b[6~",
+	tea.KeyDelete:     "\x1b[3~",
+	tea.KeyInsert:     "\x1b[2~",
+	tea.KeyCtrlUp:     "\x1b[1;5A",
+	tea.KeyCtrlDown:   "\x1b[1;5B",
+	tea.KeyCtrlRight:  "\x1b[1;5C",
+	tea.KeyCtrlLeft:   "\x1b[1;5D",
+	tea.KeyShiftUp:    "\x1b[1;2A",
+	tea.KeyShiftDown:  "\x1b[1;2B",
+	tea.KeyShiftRight: "\x1b[1;2C",
+	tea.KeyShiftLeft:  "\x1b[1;2D",
+}
+
+// keyBytes returns what the terminal sent for msg, to type it into a session. It's empty for keys that can't be typed.
+func keyBytes(msg tea.KeyMsg) string {
+	var keys string
+	switch {
+	case msg.Type == tea.KeyRunes:
+		keys = string(msg.Runes)
+		if msg.Paste {
+			// Bracketed paste, so the agent takes newlines in the paste as text rather than submitting it.
+			return "\x1b[200~" + keys + "\x1b[201~"
+		}
+	case msg.Type >= 0:
+		// Control keys, including enter, tab, escape and backspace, are the byte the terminal sends.
+		keys = string(rune(msg.Type))
+	default:
+		keys = keySequences[msg.Type]
+	}
+	if msg.Alt && keys != "" {
+		keys = "\x1b" + keys
+	}
+	return keys
+}
+
+// enterInteractive starts typing into the agent of the selected instance from the preview.
+func (m *home) enterInteractive() tea.Cmd {
+	selected := m.list.GetSelectedInstance()
+	if selected == nil || selected.Paused() || !selected.Started() || !selected.TmuxAlive() {
+		return nil
+	}
+	if m.tabbedWindow.PreviewWindow() != "" {
+		return m.handleError(fmt.Errorf("keys are typed into the agent, press w to show it"))
+	}
+	m.tabbedWindow.SetInteractive(true)
+	m.menu.SetState(ui.StateInteractive)
+	m.state = stateInteractive
+	return m.instanceChanged()
+}
+
+// leaveInteractive stops typing into the selected instance.
+func (m *home) leaveInteractive() {
+	m.tabbedWindow.SetInteractive(false)
+	m.menu.SetState(ui.StateDefault)
+	m.state = stateDefault
+}
+
+// handleInteractiveState types the keys into the agent of the selected instance, until the detach key is pressed.
+func (m *home) handleInteractiveState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.Type == tea.KeyType(tmux.DetachKey()) {
+		m.leaveInteractive()
+		return m, m.instanceChanged()
+	}
+	selected := m.list.GetSelectedInstance()
+	if selected == nil || selected.Paused() {
+		m.leaveInteractive()
+		return m, m.instanceChanged()
+	}
+	keys := keyBytes(msg)
+	if keys == "" {
+		return m, nil
+	}
+	if err := selected.SendKeys(keys); err != nil {
+		m.leaveInteractive()
+		return m, m.handleError(err)
+	}
+	return m, nil
+}
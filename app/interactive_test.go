@@ -0,0 +1,20 @@
+package app
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyBytes(t *testing.T) {
+	require.Equal(t, "y", keyBytes(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")}))
+	require.Equal(t, "\r", keyBytes(tea.KeyMsg{Type: tea.KeyEnter}))
+	require.Equal(t, "\x1b", keyBytes(tea.KeyMsg{Type: tea.KeyEsc}))
+	require.Equal(t, "\x7f", keyBytes(tea.KeyMsg{Type: tea.KeyBackspace}))
+	require.Equal(t, "\x03", keyBytes(tea.KeyMsg{Type: tea.KeyCtrlC}))
+	require.Equal(t, "\x1b[B", keyBytes(tea.KeyMsg{Type: tea.KeyDown}))
+	require.Equal(t, "\x1bb", keyBytes(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("b"), Alt: true}))
+	require.Equal(t, "\x1b[200~a\nb\x1b[201~", keyBytes(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a\nb"), Paste: true}))
+	require.Empty(t, keyBytes(tea.KeyMsg{Type: tea.KeyF5}))
+}
@@ -18,6 +18,8 @@ const (
 	ConfigFileName     = "config.json"
 	RepoConfigFileName = "repo-config.json"
 	defaultProgram     = "claude"
+
+	defaultQueueConcurrency = 2
 )
 
 // GetConfigDir returns the path to the application's configuration directory
@@ -54,6 +56,55 @@ type Config struct {
 	DaemonPollInterval int `json:"daemon_poll_interval"`
 	// BranchPrefix is the prefix used for git branches created by the application.
 	BranchPrefix string `json:"branch_prefix"`
+	// DefaultBaseRef is the ref new sessions branch from when none is given, e.g. "origin/main". New sessions branch
+	// from the repo's current HEAD if it's empty.
+	DefaultBaseRef string `json:"default_base_ref,omitempty"`
+	// Limits caps the number of sessions. New sessions beyond a limit wait as pending until there is room.
+	Limits InstanceLimits `json:"limits"`
+	// QueueConcurrency is the number of live sessions, i.e. neither paused nor exited, below which queued prompts are
+	// started.
+	QueueConcurrency int `json:"queue_concurrency"`
+	// FanOutPrograms are the programs a fan-out runs when none are given, e.g. ["claude x2", "codex"]. Defaults to
+	// three runs of the default program.
+	FanOutPrograms []string `json:"fan_out_programs,omitempty"`
+	// ArchiveOnKill archives sessions when they're killed, so they can be restored later.
+	ArchiveOnKill bool `json:"archive_on_kill,omitempty"`
+	// Notify rings the terminal bell when a session needs attention: it's awaiting approval, rate limited, errored
+	// or its agent exited.
+	Notify bool `json:"notify,omitempty"`
+	// AgentProfiles add profiles for agent programs, or replace the built-in ones with the same name.
+	AgentProfiles []AgentProfile `json:"agent_profiles,omitempty"`
+	// TmuxSocket is the tmux server sessions run on: a socket name (tmux -L) or, if it contains a slash, a socket
+	// path (tmux -S). Defaults to "agentfarmer", a server of its own apart from the user's tmux server.
+	TmuxSocket string `json:"tmux_socket,omitempty"`
+	// TmuxSocketPerRepo runs the sessions of each repo on a server of their own, named after TmuxSocket and the repo.
+	TmuxSocketPerRepo bool `json:"tmux_socket_per_repo,omitempty"`
+	// DetachKey detaches from an attached session, e.g. "ctrl-q" (the default) or "ctrl-\".
+	DetachKey string `json:"detach_key,omitempty"`
+	// PaletteKey opens the palette while attached to a session, to switch agents, send a saved prompt, toggle
+	// auto-yes or pause without detaching. Defaults to "ctrl-]", "none" disables the palette.
+	PaletteKey string `json:"palette_key,omitempty"`
+	// SavedPrompts are the prompts the palette can send, by number.
+	SavedPrompts []string `json:"saved_prompts,omitempty"`
+}
+
+// InstanceLimits caps the resources used by sessions. A zero value disables the limit.
+type InstanceLimits struct {
+	// MaxInstances is the maximum number of sessions across all repos, including paused ones.
+	MaxInstances int `json:"max_instances"`
+	// MaxInstancesPerRepo is the maximum number of sessions in a single repo, including paused ones.
+	MaxInstancesPerRepo int `json:"max_instances_per_repo"`
+	// MaxRunning is the maximum number of sessions whose agent is running, i.e. sessions that aren't paused.
+	MaxRunning int `json:"max_running"`
+	// MaxWorktreeDiskMB is the maximum total size (MB) of the worktrees of sessions that aren't paused.
+	MaxWorktreeDiskMB int `json:"max_worktree_disk_mb"`
+}
+
+// DefaultLimits returns the default session limits.
+func DefaultLimits() InstanceLimits {
+	return InstanceLimits{
+		MaxInstances: 10,
+	}
 }
 
 // RepoConfig represents repository-specific cached settings
@@ -78,6 +129,8 @@ func DefaultConfig() *Config {
 		DefaultProgram:     program,
 		AutoYes:            false,
 		DaemonPollInterval: 1000,
+		Limits:             DefaultLimits(),
+		QueueConcurrency:   defaultQueueConcurrency,
 		BranchPrefix: func() string {
 			user, err := user.Current()
 			if err != nil || user == nil || user.Username == "" {
@@ -160,7 +213,8 @@ func LoadConfig() *Config {
 		return DefaultConfig()
 	}
 
-	var config Config
+	// Config files written before the limits and the queue were added don't have them, use the defaults in that case.
+	config := Config{Limits: DefaultLimits(), QueueConcurrency: defaultQueueConcurrency}
 	if err := json.Unmarshal(data, &config); err != nil {
 		log.ErrorLog.Printf("failed to parse config file: %v", err)
 		return DefaultConfig()
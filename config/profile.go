@@ -0,0 +1,41 @@
+package config
+
+// AgentProfile tells agent-farmer how to drive an agent program: which dialogs to answer while it starts, which
+// approval prompts to answer in autoyes mode, how to tell whether it's working, and how to submit a prompt.
+type AgentProfile struct {
+	// Name identifies the profile. A custom profile with the name of a built-in one replaces it.
+	Name string `json:"name"`
+	// Programs are the commands the profile applies to. They're compared with the base name of the first word of a
+	// session's program, so "claude" matches "/usr/local/bin/claude --model opus".
+	Programs []string `json:"programs"`
+	// StartupDialogs are answered once each if they show up while the program starts, e.g. a trust prompt.
+	StartupDialogs []AgentDialog `json:"startup_dialogs,omitempty"`
+	// StartupTimeoutMs is how long (ms) to watch for startup dialogs. Defaults to 1000.
+	StartupTimeoutMs int `json:"startup_timeout_ms,omitempty"`
+	// Approvals are prompts asking to approve an action. They're answered in autoyes mode.
+	Approvals []AgentDialog `json:"approvals,omitempty"`
+	// WorkingPatterns are regular expressions that match the pane while the program is working, even when its
+	// output hasn't changed since the last check.
+	WorkingPatterns []string `json:"working_patterns,omitempty"`
+	// IdlePatterns are regular expressions that match the pane while the program waits for input, even when its
+	// output keeps changing, e.g. because of a clock.
+	IdlePatterns []string `json:"idle_patterns,omitempty"`
+	// RateLimitPatterns are regular expressions that match the pane when the program hit a rate or usage limit.
+	RateLimitPatterns []string `json:"rate_limit_patterns,omitempty"`
+	// ErrorPatterns are regular expressions that match the pane when the program failed, e.g. on an API error.
+	ErrorPatterns []string `json:"error_patterns,omitempty"`
+	// SubmitKeys are typed after a prompt to submit it. Defaults to enter ("\r").
+	SubmitKeys string `json:"submit_keys,omitempty"`
+	// SubmitDelayMs is how long (ms) to wait between typing a prompt and submitting it, so the submit keys aren't
+	// taken as part of a pasted prompt. Defaults to 100.
+	SubmitDelayMs int `json:"submit_delay_ms,omitempty"`
+}
+
+// AgentDialog is a regular expression matched against the pane content, and the keys that answer it, e.g. "\r" for
+// enter or "y".
+type AgentDialog struct {
+	Pattern string `json:"pattern"`
+	Keys    string `json:"keys"`
+	// DenyKeys answer an approval with no, e.g. "n\r". Defaults to escape.
+	DenyKeys string `json:"deny_keys,omitempty"`
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// RepoSettingsFileName is the file in a repository's .agent-farmer directory that declares settings for its sessions.
+// Unlike the cached RepoConfig, it's meant to be checked in.
+const RepoSettingsFileName = "config.json"
+
+// RepoSettings are the settings a repository declares for its sessions.
+type RepoSettings struct {
+	// Windows are auxiliary tmux windows started next to the agent in every session of the repo, e.g. a dev server
+	// or a test runner.
+	Windows []WindowConfig `json:"windows,omitempty"`
+	// Copy are files, directories or globs, relative to the root of the repo, copied from the main checkout into every
+	// new worktree, e.g. ".env". They're typically untracked, so git doesn't put them there.
+	Copy []string `json:"copy,omitempty"`
+	// Symlink are like Copy, but linked rather than copied, e.g. "node_modules". Changes made through a link change
+	// the main checkout.
+	Symlink []string `json:"symlink,omitempty"`
+	// Hooks are commands run in the worktree of every session of the repo.
+	Hooks HooksConfig `json:"hooks,omitempty"`
+	// Worktree is how the worktrees of the repo's sessions are populated.
+	Worktree WorktreeConfig `json:"worktree,omitempty"`
+
+	// hash is the SHA-256 of the settings file, which the user's trust in the settings is tied to.
+	hash string
+}
+
+// Strategies to populate worktrees with, see WorktreeConfig.
+const (
+	WorktreeStrategyCheckout = "checkout"
+	WorktreeStrategyReflink  = "reflink"
+	WorktreeStrategySparse   = "sparse"
+)
+
+// WorktreeConfig is how the files of new worktrees are written, which matters in huge repos.
+type WorktreeConfig struct {
+	// Strategy is "checkout", the default, to check out every file, "reflink" to clone the files of the main checkout
+	// on filesystems that support it, e.g. btrfs, XFS or APFS, or "sparse" to check out only the Sparse directories.
+	// Reflink falls back to checkout where the filesystem doesn't support it.
+	Strategy string `json:"strategy,omitempty"`
+	// Sparse are the directories the sparse strategy checks out, as a sparse-checkout cone. Files at the root of the
+	// repo are always checked out.
+	Sparse []string `json:"sparse,omitempty"`
+	// Profiles name sets of directories that sessions can ask to check out instead of the whole repo, e.g.
+	// {"api": ["services/api", "libs/common"]}, whatever the strategy.
+	Profiles map[string][]string `json:"profiles,omitempty"`
+}
+
+// ResolveSparse returns the directories to check out for a session that asks for sparse, which mixes directories and
+// names of Profiles. A session that doesn't ask for any gets the Sparse directories if the strategy is sparse, and
+// the whole repo otherwise.
+func (w WorktreeConfig) ResolveSparse(sparse []string) ([]string, error) {
+	if len(sparse) == 0 {
+		if w.Strategy == WorktreeStrategySparse {
+			return w.Sparse, nil
+		}
+		return nil, nil
+	}
+
+	var dirs []string
+	for _, entry := range sparse {
+		if profile, ok := w.Profiles[entry]; ok {
+			dirs = append(dirs, profile...)
+			continue
+		}
+		if !filepath.IsLocal(entry) {
+			return nil, fmt.Errorf("%q is neither a sparse profile of the repo nor a directory inside it", entry)
+		}
+		dirs = append(dirs, entry)
+	}
+	return dirs, nil
+}
+
+// HooksConfig are the shell commands run at points of a session's life, in order. A failing command stops the ones
+// after it, but not what the session was doing.
+type HooksConfig struct {
+	// PostCreate run once the worktree is created, or recreated when the session is resumed, and its files are copied,
+	// before the agent starts. E.g. installing dependencies.
+	PostCreate []string `json:"post_create,omitempty"`
+	// PrePause run before the session is paused and its worktree removed.
+	PrePause []string `json:"pre_pause,omitempty"`
+	// PreKill run before the session is killed and its worktree removed.
+	PreKill []string `json:"pre_kill,omitempty"`
+}
+
+// WindowConfig is an auxiliary tmux window of a session.
+type WindowConfig struct {
+	// Name identifies the window in the preview and in tmux.
+	Name string `json:"name"`
+	// Command is run in the session's worktree. The window runs a shell if it's empty.
+	Command string `json:"command,omitempty"`
+}
+
+var windowNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LoadRepoSettings loads the settings of the repository at repoPath. A repository without settings has empty ones.
+func LoadRepoSettings(repoPath string) (*RepoSettings, error) {
+	repoConfigDir, err := GetRepoConfigDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repo config directory: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(repoConfigDir, RepoSettingsFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &RepoSettings{}, nil
+		}
+		return nil, fmt.Errorf("failed to read repo settings: %w", err)
+	}
+
+	var settings RepoSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse repo settings: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	settings.hash = hex.EncodeToString(sum[:])
+
+	names := make(map[string]bool)
+	for _, window := range settings.Windows {
+		if !windowNameRegex.MatchString(window.Name) {
+			return nil, fmt.Errorf("invalid window name %q: use letters, digits, '-' and '_'", window.Name)
+		}
+		if names[window.Name] {
+			return nil, fmt.Errorf("window %q is declared twice", window.Name)
+		}
+		names[window.Name] = true
+	}
+	for _, pattern := range append(append([]string{}, settings.Copy...), settings.Symlink...) {
+		if !filepath.IsLocal(pattern) {
+			return nil, fmt.Errorf("invalid path %q: use a path inside the repo, relative to its root", pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", pattern, err)
+		}
+	}
+	switch settings.Worktree.Strategy {
+	case "", WorktreeStrategyCheckout, WorktreeStrategyReflink:
+	case WorktreeStrategySparse:
+		if len(settings.Worktree.Sparse) == 0 {
+			return nil, fmt.Errorf("the sparse worktree strategy needs the directories to check out")
+		}
+	default:
+		return nil, fmt.Errorf("unknown worktree strategy %q: use %s, %s or %s", settings.Worktree.Strategy,
+			WorktreeStrategyCheckout, WorktreeStrategyReflink, WorktreeStrategySparse)
+	}
+	for _, dir := range settings.Worktree.Sparse {
+		if !filepath.IsLocal(dir) {
+			return nil, fmt.Errorf("invalid sparse directory %q: use a directory inside the repo, relative to its root", dir)
+		}
+	}
+	for name, dirs := range settings.Worktree.Profiles {
+		if len(dirs) == 0 {
+			return nil, fmt.Errorf("sparse profile %q has no directories", name)
+		}
+		for _, dir := range dirs {
+			if !filepath.IsLocal(dir) {
+				return nil, fmt.Errorf("invalid directory %q in sparse profile %q: use a directory inside the repo, relative to its root", dir, name)
+			}
+		}
+	}
+	return &settings, nil
+}
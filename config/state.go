@@ -23,17 +23,30 @@ type InstanceStorage interface {
 	DeleteAllInstances() error
 }
 
+// QueueStorage handles the queue of prompts waiting to be started
+type QueueStorage interface {
+	// SaveQueue saves the raw queue data
+	SaveQueue(queueJSON json.RawMessage) error
+	// GetQueue returns the raw queue data
+	GetQueue() json.RawMessage
+}
+
 // AppState handles application-level state
 type AppState interface {
 	// GetHelpScreensSeen returns the bitmask of seen help screens
 	GetHelpScreensSeen() uint32
 	// SetHelpScreensSeen updates the bitmask of seen help screens
 	SetHelpScreensSeen(seen uint32) error
+	// GetListGroupBy returns how the instance list is grouped
+	GetListGroupBy() string
+	// SetListGroupBy updates how the instance list is grouped
+	SetListGroupBy(groupBy string) error
 }
 
 // StateManager combines instance storage and app state management
 type StateManager interface {
 	InstanceStorage
+	QueueStorage
 	AppState
 }
 
@@ -43,6 +56,10 @@ type State struct {
 	HelpScreensSeen uint32 `json:"help_screens_seen"`
 	// Instances stores the serialized instance data as raw JSON
 	InstancesData json.RawMessage `json:"instances"`
+	// QueueData stores the serialized queue of prompts as raw JSON
+	QueueData json.RawMessage `json:"queue,omitempty"`
+	// ListGroupBy is how the instance list is grouped, e.g. "repo". Empty means not grouped.
+	ListGroupBy string `json:"list_group_by,omitempty"`
 }
 
 // DefaultState returns the default state
@@ -50,6 +67,7 @@ func DefaultState() *State {
 	return &State{
 		HelpScreensSeen: 0,
 		InstancesData:   json.RawMessage("[]"),
+		QueueData:       json.RawMessage("[]"),
 	}
 }
 
@@ -125,6 +143,22 @@ func (s *State) DeleteAllInstances() error {
 	return SaveState(s)
 }
 
+// QueueStorage interface implementation
+
+// SaveQueue saves the raw queue data
+func (s *State) SaveQueue(queueJSON json.RawMessage) error {
+	s.QueueData = queueJSON
+	return SaveState(s)
+}
+
+// GetQueue returns the raw queue data. State files written before the queue existed don't have one.
+func (s *State) GetQueue() json.RawMessage {
+	if len(s.QueueData) == 0 {
+		return json.RawMessage("[]")
+	}
+	return s.QueueData
+}
+
 // AppState interface implementation
 
 // GetHelpScreensSeen returns the bitmask of seen help screens
@@ -137,3 +171,14 @@ func (s *State) SetHelpScreensSeen(seen uint32) error {
 	s.HelpScreensSeen = seen
 	return SaveState(s)
 }
+
+// GetListGroupBy returns how the instance list is grouped
+func (s *State) GetListGroupBy() string {
+	return s.ListGroupBy
+}
+
+// SetListGroupBy updates how the instance list is grouped
+func (s *State) SetListGroupBy(groupBy string) error {
+	s.ListGroupBy = groupBy
+	return SaveState(s)
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// TrustedReposFileName is the file in the config dir that records the repo settings the user trusts, see
+// TrustRepoSettings.
+const TrustedReposFileName = "trusted_repos.json"
+
+// NeedsTrust returns true if the settings run commands or link files into the worktree. A checked-in file shouldn't
+// do that on the user's machine without their consent.
+func (s *RepoSettings) NeedsTrust() bool {
+	return len(s.Symlink) > 0 || len(s.Hooks.PostCreate) > 0 || len(s.Hooks.PrePause) > 0 ||
+		len(s.Hooks.PreKill) > 0 || slices.ContainsFunc(s.Windows, func(w WindowConfig) bool { return w.Command != "" })
+}
+
+// TrustItems describes what trusting the settings allows, one symlink, hook command or window command per line.
+func (s *RepoSettings) TrustItems() []string {
+	var items []string
+	for _, link := range s.Symlink {
+		items = append(items, "symlink: "+link)
+	}
+	for _, window := range s.Windows {
+		if window.Command != "" {
+			items = append(items, "window "+window.Name+": "+window.Command)
+		}
+	}
+	for _, hook := range []struct {
+		event    string
+		commands []string
+	}{{"post_create", s.Hooks.PostCreate}, {"pre_pause", s.Hooks.PrePause}, {"pre_kill", s.Hooks.PreKill}} {
+		for _, command := range hook.commands {
+			items = append(items, hook.event+": "+command)
+		}
+	}
+	return items
+}
+
+// RepoSettingsTrusted returns true if the settings don't need trust, or if the user trusted them for the repository at
+// repoPath as they are now. Any change to the settings file revokes the trust.
+func RepoSettingsTrusted(repoPath string, settings *RepoSettings) bool {
+	if !settings.NeedsTrust() {
+		return true
+	}
+	trusted, err := loadTrustedRepos()
+	if err != nil {
+		return false
+	}
+	absRepoPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return false
+	}
+	hash, ok := trusted[absRepoPath]
+	return ok && hash == settings.hash
+}
+
+// TrustRepoSettings records that the user trusts the settings of the repository at repoPath, as they are now.
+func TrustRepoSettings(repoPath string, settings *RepoSettings) error {
+	trusted, err := loadTrustedRepos()
+	if err != nil {
+		return err
+	}
+	absRepoPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for repo: %w", err)
+	}
+	trusted[absRepoPath] = settings.hash
+
+	path, err := trustedReposPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal trusted repos: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save trusted repos: %w", err)
+	}
+	return nil
+}
+
+// loadTrustedRepos returns the hash of the trusted settings file of each repo, by the absolute path of the repo.
+func loadTrustedRepos() (map[string]string, error) {
+	path, err := trustedReposPath()
+	if err != nil {
+		return nil, err
+	}
+	trusted := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return trusted, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted repos: %w", err)
+	}
+	if err := json.Unmarshal(data, &trusted); err != nil {
+		return nil, fmt.Errorf("failed to parse trusted repos: %w", err)
+	}
+	return trusted, nil
+}
+
+func trustedReposPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, TrustedReposFileName), nil
+}
@@ -0,0 +1,559 @@
+package daemon
+
+import (
+	"agent-farmer/api"
+	"agent-farmer/config"
+	"agent-farmer/log"
+	"agent-farmer/session"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sessions holds the instances managed by the daemon. The poll loop and the control API both use the instances, so
+// every access goes through mu.
+type sessions struct {
+	mu        sync.Mutex
+	instances []*session.Instance
+	storage   *session.Storage
+	queue     *session.Queue
+	archive   *session.Archive
+	// program is the default program for sessions created through the API.
+	program string
+	// limits are the configured session limits. Sessions created beyond them wait as pending.
+	limits config.InstanceLimits
+	// queueSlots is the number of running instances below which queued prompts are started.
+	queueSlots int
+	// fanOut are the configured programs for fan-outs that don't name any.
+	fanOut []string
+	// archiveOnKill archives every killed session, as if it was killed with archive set.
+	archiveOnKill bool
+	// server serves the control API, if it could listen. It's guarded by mu.
+	server *api.Server
+
+	// wg tracks the poll loop and the goroutines sending initial prompts.
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	// stopCh stops the poll loop. It's closed with mu held, so that goroutines added to wg under mu are added before
+	// stop waits for them.
+	stopCh chan struct{}
+	// shutdownCh is closed when the daemon is asked to exit over the API.
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+}
+
+// stop stops the control API and the poll loop, and saves the instances. It's safe to call more than once.
+func (s *sessions) stop() {
+	s.stopOnce.Do(func() {
+		// Refuse requests first, so that nothing changes the instances after they're saved.
+		s.mu.Lock()
+		server := s.server
+		s.mu.Unlock()
+		if server != nil {
+			server.Drain()
+		}
+
+		// Stop the goroutines so we don't race.
+		s.mu.Lock()
+		close(s.stopCh)
+		s.mu.Unlock()
+		s.wg.Wait()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := s.storage.SaveInstances(s.instances); err != nil {
+			log.ErrorLog.Printf("failed to save instances when terminating daemon: %v", err)
+		}
+	})
+}
+
+// Shutdown saves the instances and makes RunDaemon return. The state is saved before Shutdown returns so that the
+// caller can load it right away.
+func (s *sessions) Shutdown() error {
+	s.stop()
+	s.shutdownOnce.Do(func() {
+		close(s.shutdownCh)
+	})
+	return nil
+}
+
+// find returns the instance with the given title. s.mu must be held.
+func (s *sessions) find(title string) (*session.Instance, error) {
+	for _, instance := range s.instances {
+		if instance.Title == title {
+			return instance, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", api.ErrNotFound, title)
+}
+
+func (s *sessions) save() error {
+	if err := s.storage.SaveInstances(s.instances); err != nil {
+		return fmt.Errorf("failed to save instances: %w", err)
+	}
+	return nil
+}
+
+func (s *sessions) List() ([]session.Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summaries := make([]session.Summary, 0, len(s.instances))
+	for _, instance := range s.instances {
+		summaries = append(summaries, instance.ToInstanceData().Summary())
+	}
+	return summaries, nil
+}
+
+func (s *sessions) Create(req api.CreateRequest) (session.Summary, error) {
+	if req.Title == "" {
+		return session.Summary{}, fmt.Errorf("title cannot be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.find(req.Title); err == nil {
+		return session.Summary{}, fmt.Errorf("a session named '%s' already exists", req.Title)
+	}
+
+	program := req.Program
+	if program == "" {
+		program = s.program
+	}
+	instance, err := session.NewInstance(session.InstanceOptions{
+		Title:   req.Title,
+		Path:    req.Path,
+		Program: program,
+		BaseRef: req.BaseRef,
+		Adopt:   req.Adopt,
+		Sparse:  req.Sparse,
+	})
+	if err != nil {
+		return session.Summary{}, err
+	}
+	instance.Prompt = req.Prompt
+	instance.SetTags(req.Tags)
+
+	if err := s.startOrDefer(instance); err != nil {
+		return session.Summary{}, err
+	}
+	s.instances = append(s.instances, instance)
+	if err := s.save(); err != nil {
+		return session.Summary{}, err
+	}
+	return instance.ToInstanceData().Summary(), nil
+}
+
+// startOrDefer starts a new instance and sends its prompt, or marks it pending if starting it would exceed one of the
+// limits. s.mu must be held.
+func (s *sessions) startOrDefer(instance *session.Instance) error {
+	// Assume AutoYes is true if the daemon is running.
+	instance.AutoYes = true
+
+	if err := session.CheckLimits(s.limits, instance, s.instances); err != nil {
+		if !errors.Is(err, session.ErrLimitReached) {
+			return err
+		}
+		log.InfoLog.Printf("instance %s is pending: %v", instance.Title, err)
+		instance.SetStatus(session.Pending)
+		return nil
+	}
+	if err := instance.Start(true); err != nil {
+		return err
+	}
+	s.sendInitialPrompt(instance)
+	return nil
+}
+
+func (s *sessions) Tag(title string, req api.TagsRequest) (session.Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, err := s.find(title)
+	if err != nil {
+		return session.Summary{}, err
+	}
+	instance.AddTags(req.Add)
+	instance.RemoveTags(req.Remove)
+	if req.Project != nil {
+		instance.SetProject(*req.Project)
+	}
+	if err := s.save(); err != nil {
+		return session.Summary{}, err
+	}
+	return instance.ToInstanceData().Summary(), nil
+}
+
+func (s *sessions) FanOut(req api.FanOutRequest) ([]session.Summary, error) {
+	specs := req.Programs
+	if len(specs) == 0 {
+		specs = s.fanOut
+	}
+	programs, err := session.ParseFanOutPrograms(specs, s.program)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	titles := make([]string, 0, len(s.instances))
+	for _, instance := range s.instances {
+		titles = append(titles, instance.Title)
+	}
+	group, err := session.NewFanOut(session.FanOutOptions{
+		Title:    req.Title,
+		Path:     req.Path,
+		Prompt:   req.Prompt,
+		Programs: programs,
+	}, titles)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]session.Summary, 0, len(group))
+	var errs []error
+	for _, instance := range group {
+		if err := s.startOrDefer(instance); err != nil {
+			errs = append(errs, fmt.Errorf("failed to start %s: %w", instance.Title, err))
+			continue
+		}
+		s.instances = append(s.instances, instance)
+		summaries = append(summaries, instance.ToInstanceData().Summary())
+	}
+	if err := s.save(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(summaries) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		log.ErrorLog.Printf("%v", errors.Join(errs...))
+	}
+	return summaries, nil
+}
+
+func (s *sessions) Keep(title string) (api.KeepResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	winner, err := s.find(title)
+	if err != nil {
+		return api.KeepResult{}, err
+	}
+	losers, err := session.KeepWinner(s.instances, winner)
+	if err != nil {
+		return api.KeepResult{}, err
+	}
+
+	result := api.KeepResult{Killed: []string{}}
+	var errs []error
+	for _, loser := range losers {
+		if err := s.kill(loser, false); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result.Killed = append(result.Killed, loser.Title)
+	}
+	if err := s.save(); err != nil {
+		errs = append(errs, err)
+	}
+	return result, errors.Join(errs...)
+}
+
+// sendInitialPrompt sends the instance's prompt once its program has had time to start. stop waits for it, so that
+// the prompt is in the saved history. s.mu must be held.
+func (s *sessions) sendInitialPrompt(instance *session.Instance) {
+	if instance.Prompt == "" {
+		return
+	}
+	select {
+	case <-s.stopCh:
+		log.WarningLog.Printf("not sending the prompt to %s since the daemon is stopping", instance.Title)
+		return
+	default:
+	}
+	prompt := instance.Prompt
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		time.Sleep(1000 * time.Millisecond) // Give the program time to start
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := instance.SendPrompt(prompt); err != nil {
+			log.ErrorLog.Printf("failed to send prompt to %s: %v", instance.Title, err)
+			return
+		}
+		if err := s.save(); err != nil {
+			log.ErrorLog.Printf("failed to save prompt history of %s: %v", instance.Title, err)
+		}
+	}()
+}
+
+// startPending starts pending instances, oldest first, while there's room for them under the limits. s.mu must be
+// held.
+func (s *sessions) startPending() {
+	var pending []*session.Instance
+	for _, instance := range s.instances {
+		if instance.Pending() {
+			pending = append(pending, instance)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	for _, instance := range pending {
+		if err := session.CheckLimits(s.limits, instance, s.instances); err != nil {
+			if !errors.Is(err, session.ErrLimitReached) {
+				log.WarningLog.Printf("could not check limits for pending instance %s: %v", instance.Title, err)
+			}
+			break
+		}
+		if err := instance.Start(true); err != nil {
+			// Start cleans up after itself, so drop the instance rather than retrying it forever.
+			log.ErrorLog.Printf("failed to start pending instance %s: %v", instance.Title, err)
+			s.remove(instance)
+			continue
+		}
+		instance.AutoYes = true
+		log.InfoLog.Printf("started pending instance %s", instance.Title)
+		s.sendInitialPrompt(instance)
+	}
+
+	if err := s.save(); err != nil {
+		log.ErrorLog.Printf("%v", err)
+	}
+}
+
+// drainQueue starts sessions for queued prompts while there are free slots. s.mu must be held.
+func (s *sessions) drainQueue() {
+	started := false
+	for {
+		instance, err := s.queue.Next(s.queueSlots, s.limits, s.program, s.instances)
+		if err != nil {
+			log.ErrorLog.Printf("%v", err)
+		}
+		if instance == nil {
+			if err != nil {
+				// The prompt was dropped, try the next one.
+				continue
+			}
+			break
+		}
+		if err := instance.Start(true); err != nil {
+			log.ErrorLog.Printf("failed to start queued prompt %s: %v", instance.Title, err)
+			continue
+		}
+		log.InfoLog.Printf("started queued prompt %s", instance.Title)
+		instance.AutoYes = true
+		s.sendInitialPrompt(instance)
+		s.instances = append(s.instances, instance)
+		started = true
+	}
+	if !started {
+		return
+	}
+	if err := s.save(); err != nil {
+		log.ErrorLog.Printf("%v", err)
+	}
+}
+
+func (s *sessions) Queue() ([]session.QueuedPrompt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]session.QueuedPrompt{}, s.queue.Items()...), nil
+}
+
+func (s *sessions) Enqueue(items []session.QueuedPrompt) ([]session.QueuedPrompt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	titles := make([]string, 0, len(s.instances))
+	for _, instance := range s.instances {
+		titles = append(titles, instance.Title)
+	}
+	added, err := s.queue.Add(items, titles)
+	if err != nil {
+		return nil, err
+	}
+	s.drainQueue()
+	return added, nil
+}
+
+func (s *sessions) Dequeue(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queue.Remove(title)
+}
+
+// remove removes the instance from the managed instances. s.mu must be held.
+func (s *sessions) remove(instance *session.Instance) {
+	for i, other := range s.instances {
+		if other == instance {
+			s.instances = append(s.instances[:i], s.instances[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *sessions) SendPrompt(title string, prompt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, err := s.find(title)
+	if err != nil {
+		return err
+	}
+	if instance.Paused() {
+		return fmt.Errorf("session '%s' is paused", title)
+	}
+	if instance.Pending() {
+		return fmt.Errorf("session '%s' is pending", title)
+	}
+	if err := instance.SendPrompt(prompt); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *sessions) Pause(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, err := s.find(title)
+	if err != nil {
+		return err
+	}
+	if err := instance.Pause(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *sessions) Resume(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, err := s.find(title)
+	if err != nil {
+		return err
+	}
+	if err := session.CheckLimits(s.limits, instance, s.instances); err != nil {
+		return fmt.Errorf("can't resume '%s': %w", title, err)
+	}
+	if err := instance.Resume(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *sessions) Restart(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, err := s.find(title)
+	if err != nil {
+		return err
+	}
+	if err := instance.Restart(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *sessions) Rebase(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, err := s.find(title)
+	if err != nil {
+		return err
+	}
+	if instance.Paused() {
+		return fmt.Errorf("session '%s' is paused", title)
+	}
+	if instance.Pending() {
+		return fmt.Errorf("session '%s' is pending", title)
+	}
+	worktree, err := instance.GetGitWorktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.RebaseOntoBase(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *sessions) Kill(title string, archive bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, err := s.find(title)
+	if err != nil {
+		return err
+	}
+	if err := s.kill(instance, archive); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// kill kills the instance and removes it, unless its branch is checked out. The instance is archived first if
+// archive or archiveOnKill is set. s.mu must be held.
+func (s *sessions) kill(instance *session.Instance, archive bool) error {
+	if err := instance.CheckKillable(); err != nil {
+		return err
+	}
+	if (archive || s.archiveOnKill) && instance.Started() {
+		if _, err := instance.Archive(s.archive); err != nil {
+			return fmt.Errorf("failed to archive '%s': %w", instance.Title, err)
+		}
+	}
+
+	if err := instance.Kill(); err != nil {
+		log.ErrorLog.Printf("could not kill instance: %v", err)
+	}
+	s.remove(instance)
+	return nil
+}
+
+func (s *sessions) Restore(id string) (session.Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	titles := make([]string, 0, len(s.instances))
+	for _, instance := range s.instances {
+		titles = append(titles, instance.Title)
+	}
+	instance, err := s.archive.Restore(id, titles)
+	if err != nil {
+		return session.Summary{}, err
+	}
+	s.instances = append(s.instances, instance)
+	if err := s.save(); err != nil {
+		return session.Summary{}, err
+	}
+	return instance.ToInstanceData().Summary(), nil
+}
+
+func (s *sessions) Diff(title string) (api.Diff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, err := s.find(title)
+	if err != nil {
+		return api.Diff{}, err
+	}
+	if err := instance.UpdateDiffStats(); err != nil {
+		return api.Diff{}, err
+	}
+	stats := instance.GetDiffStats()
+	if stats == nil {
+		return api.Diff{}, nil
+	}
+	return api.Diff{Added: stats.Added, Removed: stats.Removed, Content: stats.Content}, nil
+}
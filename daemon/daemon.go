@@ -1,23 +1,32 @@
 package daemon
 
 import (
+	"agent-farmer/api"
 	"agent-farmer/config"
 	"agent-farmer/log"
 	"agent-farmer/session"
+	"agent-farmer/session/tmux"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"sync"
 	"syscall"
 	"time"
 )
 
 // RunDaemon runs the daemon process which iterates over all sessions and runs AutoYes mode on them.
-// It's expected that the main process kills the daemon when the main process starts.
+// It's expected that the main process stops the daemon when the main process starts.
 func RunDaemon(cfg *config.Config) error {
 	log.InfoLog.Printf("starting daemon")
+	if err := tmux.SetAgentProfiles(cfg.AgentProfiles); err != nil {
+		return fmt.Errorf("invalid agent profiles: %w", err)
+	}
+	if err := tmux.SetServer(cfg.TmuxSocket, cfg.TmuxSocketPerRepo); err != nil {
+		return fmt.Errorf("failed to set up the tmux server: %w", err)
+	}
+	tmux.EnableControlMode()
+	defer tmux.CloseControl()
 	state := config.LoadState()
 	storage, err := session.NewStorage(state)
 	if err != nil {
@@ -32,36 +41,97 @@ func RunDaemon(cfg *config.Config) error {
 		// Assume AutoYes is true if the daemon is running.
 		instance.AutoYes = true
 	}
+	queue, err := session.NewQueue(state)
+	if err != nil {
+		return fmt.Errorf("failed to load queue: %w", err)
+	}
+
+	archive, err := session.NewArchive()
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	s := &sessions{
+		instances:     instances,
+		storage:       storage,
+		queue:         queue,
+		program:       cfg.DefaultProgram,
+		limits:        cfg.Limits,
+		queueSlots:    cfg.QueueConcurrency,
+		fanOut:        cfg.FanOutPrograms,
+		archive:       archive,
+		archiveOnKill: cfg.ArchiveOnKill,
+		stopCh:        make(chan struct{}),
+		shutdownCh:    make(chan struct{}),
+	}
+
+	// Serve the control API so that the TUI can hand off gracefully and scripts can drive the sessions.
+	server, err := api.Listen(s)
+	if err != nil {
+		log.WarningLog.Printf("control API disabled: %v", err)
+	} else {
+		s.mu.Lock()
+		s.server = server
+		s.mu.Unlock()
+		defer func() {
+			if err := server.Close(); err != nil {
+				log.WarningLog.Printf("failed to close control API: %v", err)
+			}
+		}()
+	}
 
 	pollInterval := time.Duration(cfg.DaemonPollInterval) * time.Millisecond
 
 	// If we get an error for a session, it's likely that we'll keep getting the error. Log every 30 seconds.
 	everyN := log.NewEvery(60 * time.Second)
 
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	stopCh := make(chan struct{})
+	s.wg.Add(1)
 	go func() {
-		defer wg.Done()
+		defer s.wg.Done()
 		ticker := time.NewTimer(pollInterval)
+		var lastDiskUsage time.Time
 		for {
-			for _, instance := range instances {
+			if s.limits.MaxWorktreeDiskMB > 0 && time.Since(lastDiskUsage) >= session.DiskUsageInterval {
+				lastDiskUsage = time.Now()
+				var live []*session.Instance
+				s.mu.Lock()
+				for _, instance := range s.instances {
+					if instance.Started() && !instance.Paused() {
+						live = append(live, instance)
+					}
+				}
+				s.mu.Unlock()
+				// Walking the worktrees takes a while, so the API isn't held up meanwhile.
+				for _, instance := range live {
+					instance.UpdateDiskUsage()
+				}
+			}
+
+			s.mu.Lock()
+			s.startPending()
+			s.drainQueue()
+			for _, instance := range s.instances {
 				// We only store started instances, but check anyway.
 				if instance.Started() && !instance.Paused() {
-					if _, hasPrompt := instance.HasUpdated(); hasPrompt {
-						instance.TapEnter()
-						if err := instance.UpdateDiffStats(); err != nil {
-							if everyN.ShouldLog() {
-								log.WarningLog.Printf("could not update diff stats for %s: %v", instance.Title, err)
-							}
+					if !instance.UpdateStatus() {
+						continue
+					}
+					if instance.Status.NeedsAttention() {
+						log.InfoLog.Printf("session %s is %s", instance.Title, instance.Status)
+					}
+					// The agent started or stopped working, so its changes may have too.
+					if err := instance.UpdateDiffStats(); err != nil {
+						if everyN.ShouldLog() {
+							log.WarningLog.Printf("could not update diff stats for %s: %v", instance.Title, err)
 						}
 					}
 				}
 			}
+			s.mu.Unlock()
 
 			// Handle stop before ticker.
 			select {
-			case <-stopCh:
+			case <-s.stopCh:
 				return
 			default:
 			}
@@ -71,19 +141,17 @@ func RunDaemon(cfg *config.Config) error {
 		}
 	}()
 
-	// Notify on SIGINT (Ctrl+C) and SIGTERM. Save instances before
+	// Notify on SIGINT (Ctrl+C) and SIGTERM. Save instances before exiting.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-sigChan
-	log.InfoLog.Printf("received signal %s", sig.String())
-
-	// Stop the goroutine so we don't race.
-	close(stopCh)
-	wg.Wait()
-
-	if err := storage.SaveInstances(instances); err != nil {
-		log.ErrorLog.Printf("failed to save instances when terminating daemon: %v", err)
+	select {
+	case sig := <-sigChan:
+		log.InfoLog.Printf("received signal %s", sig.String())
+	case <-s.shutdownCh:
+		log.InfoLog.Printf("received shutdown request")
 	}
+
+	s.stop()
 	return nil
 }
 
@@ -148,6 +216,36 @@ func StopDaemon() error {
 		return fmt.Errorf("invalid PID file format: %w", err)
 	}
 
+	// Ask the daemon to save its state and exit. Fall back to killing it if it doesn't answer.
+	if client, err := api.Dial(); err == nil {
+		if err := client.Shutdown(); err == nil {
+			if err := os.Remove(pidFile); err != nil {
+				return fmt.Errorf("failed to remove PID file: %w", err)
+			}
+			log.InfoLog.Printf("daemon process (PID: %d) shut down gracefully", pid)
+			return nil
+		} else {
+			log.WarningLog.Printf("failed to shut down daemon gracefully, killing it: %v", err)
+		}
+	}
+
+	// The daemon may have exited long ago and its PID been reused, so make sure it's the daemon before killing it.
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+	isDaemon, err := isDaemonProcess(pid, execPath)
+	if err != nil {
+		return fmt.Errorf("failed to check daemon process: %w", err)
+	}
+	if !isDaemon {
+		log.WarningLog.Printf("process %d is not the daemon anymore, removing its stale PID file", pid)
+		if err := os.Remove(pidFile); err != nil {
+			return fmt.Errorf("failed to remove PID file: %w", err)
+		}
+		return nil
+	}
+
 	proc, err := os.FindProcess(pid)
 	if err != nil {
 		return fmt.Errorf("failed to find daemon process: %w", err)
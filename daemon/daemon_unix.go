@@ -3,6 +3,15 @@
 package daemon
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
@@ -12,3 +21,28 @@ func getSysProcAttr() *syscall.SysProcAttr {
 		Setsid: true, // Create a new session
 	}
 }
+
+// isDaemonProcess reports whether the process with the given PID runs execPath with the daemon flag. It reads the
+// command line from /proc where there is one, and from ps otherwise, e.g. on macOS.
+func isDaemonProcess(pid int, execPath string) (bool, error) {
+	var args []string
+	if data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline")); err == nil {
+		args = strings.Split(string(bytes.TrimSuffix(data, []byte{0})), "\x00")
+	} else if _, statErr := os.Stat("/proc/self"); statErr == nil {
+		// The process is gone.
+		return false, nil
+	} else {
+		output, err := exec.Command("ps", "-o", "args=", "-p", strconv.Itoa(pid)).Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// ps exits with an error when there's no such process.
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get command line of process %d: %w", pid, err)
+		}
+		args = strings.Fields(string(output))
+	}
+	return len(args) > 1 && filepath.Base(args[0]) == filepath.Base(execPath) && slices.Contains(args[1:], "--daemon"),
+		nil
+}
@@ -3,8 +3,13 @@
 package daemon
 
 import (
-	"golang.org/x/sys/windows"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"syscall"
+
+	"golang.org/x/sys/windows"
 )
 
 // getSysProcAttr returns platform-specific process attributes for detaching the child process
@@ -13,3 +18,24 @@ func getSysProcAttr() *syscall.SysProcAttr {
 		CreationFlags: windows.CREATE_NEW_PROCESS_GROUP | windows.DETACHED_PROCESS,
 	}
 }
+
+// isDaemonProcess reports whether the process with the given PID runs execPath. Windows doesn't expose the command
+// line of other processes, so the daemon flag isn't checked.
+func isDaemonProcess(pid int, execPath string) (bool, error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if errors.Is(err, windows.ERROR_INVALID_PARAMETER) {
+		// The process is gone.
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open process %d: %w", pid, err)
+	}
+	defer windows.CloseHandle(handle)
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(handle, 0, &buf[0], &size); err != nil {
+		return false, fmt.Errorf("failed to get executable of process %d: %w", pid, err)
+	}
+	return strings.EqualFold(filepath.Base(windows.UTF16ToString(buf[:size])), filepath.Base(execPath)), nil
+}
@@ -24,8 +24,23 @@ const (
 	KeyResume
 	KeyPrompt       // New key for entering a prompt
 	KeyHelp         // Key for showing help screen
-	KeyOpenWorktree // Key for opening worktree in new tmux window
+	KeyOpenWorktree // Key for opening a shell window in the worktree
 	KeyRebase       // Key for rebasing session branch onto default branch
+	KeyFanOut       // Key for running one prompt across several sessions
+	KeyCompare      // Key for comparing the attempts of a fan-out
+	KeyKeepWinner   // Key for keeping one attempt of a fan-out and killing the rest
+	KeyFilter       // Key for filtering the list
+	KeyGroupBy      // Key for switching how the list is grouped
+	KeyTag          // Key for editing the tags of a session
+	KeyProject      // Key for editing the project of a session
+	KeySendPrompt   // Key for sending a prompt to a running session
+	KeyRestart      // Key for restarting the agent of a session in its worktree
+	KeyNextWindow   // Key for switching the preview between the agent's window and the auxiliary ones
+	KeyGrid         // Key for switching the preview between the selected instance and the grid layouts
+	KeyInteractive  // Key for typing into the selected instance from the preview
+	KeyInbox        // Key for showing the sessions waiting for approval
+	KeyNewFromBase  // Key for creating a new session from a chosen base ref
+	KeyAdopt        // Key for creating a new session on an existing branch or pull request
 
 	// Diff keybindings
 	KeyShiftUp
@@ -53,6 +68,21 @@ var GlobalKeyStringsMap = map[string]KeyName{
 	"p":          KeySubmit,
 	"?":          KeyHelp,
 	"e":          KeyOpenWorktree,
+	"F":          KeyFanOut,
+	"C":          KeyCompare,
+	"W":          KeyKeepWinner,
+	"/":          KeyFilter,
+	"g":          KeyGroupBy,
+	"T":          KeyTag,
+	"P":          KeyProject,
+	"s":          KeySendPrompt,
+	"X":          KeyRestart,
+	"w":          KeyNextWindow,
+	"v":          KeyGrid,
+	"i":          KeyInteractive,
+	"a":          KeyInbox,
+	"B":          KeyNewFromBase,
+	"A":          KeyAdopt,
 }
 
 // GlobalkeyBindings is a global, immutable map of KeyName tot keybinding.
@@ -115,11 +145,71 @@ var GlobalkeyBindings = map[KeyName]key.Binding{
 	),
 	KeyOpenWorktree: key.NewBinding(
 		key.WithKeys("e"),
-		key.WithHelp("e", "open worktree"),
+		key.WithHelp("e", "shell"),
 	),
 	KeyRebase: key.NewBinding(
 		key.WithKeys("R"),
-		key.WithHelp("R", "rebase onto default"),
+		key.WithHelp("R", "rebase onto base"),
+	),
+	KeyFanOut: key.NewBinding(
+		key.WithKeys("F"),
+		key.WithHelp("F", "fan-out"),
+	),
+	KeyCompare: key.NewBinding(
+		key.WithKeys("C"),
+		key.WithHelp("C", "compare"),
+	),
+	KeyKeepWinner: key.NewBinding(
+		key.WithKeys("W"),
+		key.WithHelp("W", "keep winner"),
+	),
+	KeyFilter: key.NewBinding(
+		key.WithKeys("/"),
+		key.WithHelp("/", "filter"),
+	),
+	KeyGroupBy: key.NewBinding(
+		key.WithKeys("g"),
+		key.WithHelp("g", "group by"),
+	),
+	KeyTag: key.NewBinding(
+		key.WithKeys("T"),
+		key.WithHelp("T", "tags"),
+	),
+	KeyProject: key.NewBinding(
+		key.WithKeys("P"),
+		key.WithHelp("P", "project"),
+	),
+	KeySendPrompt: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "send prompt"),
+	),
+	KeyRestart: key.NewBinding(
+		key.WithKeys("X"),
+		key.WithHelp("X", "restart agent"),
+	),
+	KeyNextWindow: key.NewBinding(
+		key.WithKeys("w"),
+		key.WithHelp("w", "switch window"),
+	),
+	KeyGrid: key.NewBinding(
+		key.WithKeys("v"),
+		key.WithHelp("v", "grid"),
+	),
+	KeyInteractive: key.NewBinding(
+		key.WithKeys("i"),
+		key.WithHelp("i", "type into preview"),
+	),
+	KeyInbox: key.NewBinding(
+		key.WithKeys("a"),
+		key.WithHelp("a", "approvals"),
+	),
+	KeyNewFromBase: key.NewBinding(
+		key.WithKeys("B"),
+		key.WithHelp("B", "new from base"),
+	),
+	KeyAdopt: key.NewBinding(
+		key.WithKeys("A"),
+		key.WithHelp("A", "check out branch/PR"),
 	),
 
 	// -- Special keybindings --
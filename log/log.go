@@ -47,7 +47,8 @@ func Initialize(daemon bool) {
 func Close() {
 	_ = globalLogFile.Close()
 	// TODO: maybe only print if verbose flag is set?
-	fmt.Println("wrote logs to " + logFileName)
+	// Print to stderr so that it doesn't end up in machine-readable output on stdout.
+	fmt.Fprintln(os.Stderr, "wrote logs to "+logFileName)
 }
 
 // Every is used to log at most once every timeout duration.
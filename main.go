@@ -1,6 +1,7 @@
 package main
 
 import (
+	"agent-farmer/api"
 	"agent-farmer/app"
 	cmd2 "agent-farmer/cmd"
 	"agent-farmer/config"
@@ -11,8 +12,15 @@ import (
 	"agent-farmer/session/tmux"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -33,7 +41,9 @@ var (
 			if daemonFlag {
 				cfg := config.LoadConfig()
 				err := daemon.RunDaemon(cfg)
-				log.ErrorLog.Printf("failed to start daemon %v", err)
+				if err != nil {
+					log.ErrorLog.Printf("failed to start daemon %v", err)
+				}
 				return err
 			}
 
@@ -94,7 +104,11 @@ var (
 			}
 			fmt.Println("Storage has been reset successfully")
 
-			if err := tmux.CleanupSessions(cmd2.MakeExecutor()); err != nil {
+			cfg := config.LoadConfig()
+			if err := tmux.SetServer(cfg.TmuxSocket, cfg.TmuxSocketPerRepo); err != nil {
+				return fmt.Errorf("failed to set up the tmux server: %w", err)
+			}
+			if err := tmux.KillServers(cmd2.MakeExecutor()); err != nil {
 				return fmt.Errorf("failed to cleanup tmux sessions: %w", err)
 			}
 			fmt.Println("Tmux sessions have been cleaned up")
@@ -140,6 +154,985 @@ var (
 		},
 	}
 
+	newCmd = &cobra.Command{
+		Use:   "new",
+		Short: "Create a new session without starting the TUI",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			prompt, _ := cmd.Flags().GetString("prompt")
+			title, _ := cmd.Flags().GetString("title")
+			program, _ := cmd.Flags().GetString("program")
+			tags, _ := cmd.Flags().GetStringArray("tag")
+			baseRef, _ := cmd.Flags().GetString("base")
+			adopt, _ := cmd.Flags().GetString("adopt")
+			sparse, _ := cmd.Flags().GetStringArray("sparse")
+			if adopt != "" && baseRef != "" {
+				return fmt.Errorf("--adopt works on an existing branch, it can't be combined with --base")
+			}
+
+			currentDir, err := filepath.Abs(".")
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			if !git.IsGitRepo(currentDir) {
+				return fmt.Errorf("error: agent-farmer must be run from within a git repository")
+			}
+
+			if title == "" && adopt != "" {
+				title = git.AdoptedBranchName(adopt)
+			}
+			if title == "" {
+				if prompt == "" {
+					return fmt.Errorf("either --title or --prompt is required")
+				}
+				title, err = session.GenerateSessionName(prompt, nil)
+				if err != nil {
+					return fmt.Errorf("failed to generate session name: %w", err)
+				}
+			}
+
+			if client, ok := liveClient(); ok {
+				summary, err := client.Create(api.CreateRequest{
+					Title:   title,
+					Path:    currentDir,
+					Program: program,
+					Prompt:  prompt,
+					Tags:    tags,
+					BaseRef: baseRef,
+					Adopt:   adopt,
+					Sparse:  sparse,
+				})
+				if err != nil {
+					return err
+				}
+				if summary.Status == session.Pending.String() {
+					fmt.Printf("Session '%s' is pending and will start when there's room under the limits\n", summary.Title)
+					return nil
+				}
+				printCreated(summary)
+				return nil
+			}
+
+			cfg := config.LoadConfig()
+			if program == "" {
+				program = cfg.DefaultProgram
+			}
+			return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+				if _, err := findInstance(instances, title); err == nil {
+					return nil, fmt.Errorf("a session named '%s' already exists", title)
+				}
+
+				instance, err := session.NewInstance(session.InstanceOptions{
+					Title:   title,
+					Path:    ".",
+					Program: program,
+					BaseRef: baseRef,
+					Adopt:   adopt,
+					Sparse:  sparse,
+				})
+				if err != nil {
+					return nil, err
+				}
+				instance.SetTags(tags)
+				session.UpdateDiskUsage(cfg.Limits, instances)
+				if err := session.CheckLimits(cfg.Limits, instance, instances); err != nil {
+					if !errors.Is(err, session.ErrLimitReached) {
+						return nil, err
+					}
+					// Nothing is running to start it, so it waits for the next time the TUI or daemon runs.
+					instance.SetStatus(session.Pending)
+					instance.Prompt = prompt
+					fmt.Printf("Session '%s' is pending (%v), it will start when there's room once agent-farmer is running\n",
+						instance.Title, err)
+					return append(instances, instance), nil
+				}
+				if err := instance.Start(true); err != nil {
+					return nil, err
+				}
+				instances = append(instances, instance)
+
+				if prompt != "" {
+					// Give the program time to start before typing into it, same as the TUI.
+					time.Sleep(1000 * time.Millisecond)
+					if err := instance.SendPrompt(prompt); err != nil {
+						return instances, fmt.Errorf("session created but failed to send prompt: %w", err)
+					}
+					time.Sleep(headlessFlushDelay)
+				}
+
+				printCreated(instance.ToInstanceData().Summary())
+				if err := instance.HookError(); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+				return instances, nil
+			})
+		},
+	}
+
+	listCmd = &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List all sessions",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			asJSON, _ := cmd.Flags().GetBool("json")
+			tag, _ := cmd.Flags().GetString("tag")
+			project, _ := cmd.Flags().GetString("project")
+			summaries, err := loadSummaries()
+			if err != nil {
+				return err
+			}
+			if tag != "" || project != "" {
+				var matching []session.Summary
+				for _, s := range summaries {
+					if (tag == "" || slices.Contains(s.Tags, strings.ToLower(tag))) &&
+						(project == "" || s.Project == project) {
+						matching = append(matching, s)
+					}
+				}
+				summaries = matching
+			}
+			return printSessions(summaries, asJSON)
+		},
+	}
+
+	statusCmd = &cobra.Command{
+		Use:   "status [title]",
+		Short: "Print the status of one or all sessions without attaching to them",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			asJSON, _ := cmd.Flags().GetBool("json")
+			summaries, err := loadSummaries()
+			if err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				var found []session.Summary
+				for _, s := range summaries {
+					if s.Title == args[0] {
+						found = append(found, s)
+					}
+				}
+				if len(found) == 0 {
+					return fmt.Errorf("instance not found: %s", args[0])
+				}
+				summaries = found
+			}
+			return printSessions(summaries, asJSON)
+		},
+	}
+
+	sendCmd = &cobra.Command{
+		Use:   "send <title> <text>",
+		Short: "Send a prompt to a session",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if client, ok := liveClient(); ok {
+				if err := client.SendPrompt(args[0], args[1]); err != nil {
+					return err
+				}
+				fmt.Printf("Sent prompt to session '%s'\n", args[0])
+				return nil
+			}
+
+			return withSession(args[0], func(instance *session.Instance) error {
+				if instance.Paused() {
+					return fmt.Errorf("session '%s' is paused", instance.Title)
+				}
+				if err := instance.SendPrompt(args[1]); err != nil {
+					return err
+				}
+				time.Sleep(headlessFlushDelay)
+				fmt.Printf("Sent prompt to session '%s'\n", instance.Title)
+				return nil
+			})
+		},
+	}
+
+	pauseCmd = &cobra.Command{
+		Use:   "pause <title>",
+		Short: "Commit changes and pause a session, keeping its branch",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if client, ok := liveClient(); ok {
+				if err := client.Pause(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Paused session '%s'\n", args[0])
+				return nil
+			}
+
+			return withSession(args[0], func(instance *session.Instance) error {
+				if err := instance.Pause(); err != nil {
+					return err
+				}
+				fmt.Printf("Paused session '%s', branch '%s' can be checked out\n", instance.Title, instance.Branch)
+				return nil
+			})
+		},
+	}
+
+	resumeCmd = &cobra.Command{
+		Use:   "resume <title>",
+		Short: "Resume a paused session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if client, ok := liveClient(); ok {
+				if err := client.Resume(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Resumed session '%s'\n", args[0])
+				return nil
+			}
+
+			limits := config.LoadConfig().Limits
+			return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+				instance, err := findInstance(instances, args[0])
+				if err != nil {
+					return nil, err
+				}
+				session.UpdateDiskUsage(limits, instances)
+				if err := session.CheckLimits(limits, instance, instances); err != nil {
+					return nil, fmt.Errorf("can't resume '%s': %w", instance.Title, err)
+				}
+				if err := instance.Resume(); err != nil {
+					return instances, err
+				}
+				fmt.Printf("Resumed session '%s'\n", instance.Title)
+				return instances, nil
+			})
+		},
+	}
+
+	restartCmd = &cobra.Command{
+		Use:   "restart <title>",
+		Short: "Restart the agent of a session in its worktree, e.g. after it exited or crashed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if client, ok := liveClient(); ok {
+				if err := client.Restart(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Restarted the agent of session '%s'\n", args[0])
+				return nil
+			}
+
+			return withSession(args[0], func(instance *session.Instance) error {
+				if err := instance.Restart(); err != nil {
+					return err
+				}
+				fmt.Printf("Restarted the agent of session '%s'\n", instance.Title)
+				return nil
+			})
+		},
+	}
+
+	killCmd = &cobra.Command{
+		Use:   "kill <title>",
+		Short: "Kill a session and remove its worktree and branch, or keep them in the archive with --archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			archive, _ := cmd.Flags().GetBool("archive")
+			if client, ok := liveClient(); ok {
+				if err := client.Kill(args[0], archive); err != nil {
+					return err
+				}
+				fmt.Printf("Killed session '%s'\n", args[0])
+				return nil
+			}
+
+			archive = archive || config.LoadConfig().ArchiveOnKill
+			return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+				instance, err := findInstance(instances, args[0])
+				if err != nil {
+					return nil, err
+				}
+
+				if err := instance.CheckKillable(); err != nil {
+					return nil, err
+				}
+				if archive {
+					if err := archiveInstance(instance); err != nil {
+						return nil, err
+					}
+				}
+
+				remaining := make([]*session.Instance, 0, len(instances)-1)
+				for _, other := range instances {
+					if other != instance {
+						remaining = append(remaining, other)
+					}
+				}
+				if err := instance.Kill(); err != nil {
+					// The session is gone from storage either way, so just report the cleanup failure.
+					log.ErrorLog.Printf("could not kill instance: %v", err)
+				}
+				fmt.Printf("Killed session '%s'\n", instance.Title)
+				return remaining, nil
+			})
+		},
+	}
+
+	pushCmd = &cobra.Command{
+		Use:   "push <title>",
+		Short: "Commit and push a session's branch to github",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			return withStoredSession(args[0], func(instance *session.Instance) error {
+				worktree, err := instance.GetGitWorktree()
+				if err != nil {
+					return err
+				}
+				commitMsg := fmt.Sprintf("[agentfarmer] update from '%s' on %s", instance.Title, time.Now().Format(time.RFC822))
+				if err := worktree.PushChanges(commitMsg, false); err != nil {
+					return err
+				}
+				fmt.Printf("Pushed branch '%s'\n", instance.Branch)
+				return nil
+			})
+		},
+	}
+
+	rebaseCmd = &cobra.Command{
+		Use:   "rebase <title>",
+		Short: "Rebase a session's branch onto its base branch, the default branch unless it was started from another",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			// The rebase moves the commit the diff is taken against, so a running TUI or daemon does it to keep its
+			// sessions in sync.
+			if client, ok := liveClient(); ok {
+				if err := client.Rebase(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Rebased session '%s' onto its base\n", args[0])
+				return nil
+			}
+			return withSession(args[0], func(instance *session.Instance) error {
+				worktree, err := instance.GetGitWorktree()
+				if err != nil {
+					return err
+				}
+				if err := worktree.RebaseOntoBase(); err != nil {
+					return err
+				}
+				fmt.Printf("Rebased branch '%s' onto its base\n", instance.Branch)
+				return nil
+			})
+		},
+	}
+
+	fanOutCmd = &cobra.Command{
+		Use:   "fanout",
+		Short: "Run one prompt in several sessions, one per program, to compare the results",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			prompt, _ := cmd.Flags().GetString("prompt")
+			title, _ := cmd.Flags().GetString("title")
+			specs, _ := cmd.Flags().GetStringArray("program")
+			if prompt == "" {
+				return fmt.Errorf("--prompt is required")
+			}
+
+			currentDir, err := filepath.Abs(".")
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			if !git.IsGitRepo(currentDir) {
+				return fmt.Errorf("error: agent-farmer must be run from within a git repository")
+			}
+			if title == "" {
+				title, err = session.GenerateSessionName(prompt, nil)
+				if err != nil {
+					return fmt.Errorf("failed to generate session name: %w", err)
+				}
+			}
+
+			if client, ok := liveClient(); ok {
+				summaries, err := client.FanOut(api.FanOutRequest{
+					Title:    title,
+					Path:     currentDir,
+					Prompt:   prompt,
+					Programs: specs,
+				})
+				if err != nil {
+					return err
+				}
+				for _, summary := range summaries {
+					fmt.Printf("Created session '%s' (%s, %s)\n", summary.Title, summary.Program, summary.Status)
+				}
+				return nil
+			}
+
+			cfg := config.LoadConfig()
+			if len(specs) == 0 {
+				specs = cfg.FanOutPrograms
+			}
+			programs, err := session.ParseFanOutPrograms(specs, cfg.DefaultProgram)
+			if err != nil {
+				return err
+			}
+			return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+				titles := make([]string, 0, len(instances))
+				for _, instance := range instances {
+					titles = append(titles, instance.Title)
+				}
+				attempts, err := session.NewFanOut(session.FanOutOptions{
+					Title:    title,
+					Path:     currentDir,
+					Prompt:   prompt,
+					Programs: programs,
+				}, titles)
+				if err != nil {
+					return nil, err
+				}
+
+				var started []*session.Instance
+				var errs []error
+				session.UpdateDiskUsage(cfg.Limits, instances)
+				for _, instance := range attempts {
+					if err := session.CheckLimits(cfg.Limits, instance, instances); err != nil {
+						if !errors.Is(err, session.ErrLimitReached) {
+							errs = append(errs, err)
+							continue
+						}
+						// Nothing is running to start it, so it waits for the next time the TUI or daemon runs.
+						instance.SetStatus(session.Pending)
+						instances = append(instances, instance)
+						fmt.Printf("Session '%s' (%s) is pending (%v)\n", instance.Title, instance.Program, err)
+						continue
+					}
+					if err := instance.Start(true); err != nil {
+						errs = append(errs, fmt.Errorf("failed to start %s: %w", instance.Title, err))
+						continue
+					}
+					instances = append(instances, instance)
+					started = append(started, instance)
+					fmt.Printf("Created session '%s' (%s) on branch '%s'\n", instance.Title, instance.Program, instance.Branch)
+				}
+
+				if len(started) > 0 {
+					// Give the programs time to start before typing into them, same as the TUI.
+					time.Sleep(1000 * time.Millisecond)
+					for _, instance := range started {
+						if err := instance.SendPrompt(prompt); err != nil {
+							errs = append(errs, fmt.Errorf("failed to send prompt to %s: %w", instance.Title, err))
+						}
+					}
+					time.Sleep(headlessFlushDelay)
+				}
+				return instances, errors.Join(errs...)
+			})
+		},
+	}
+
+	keepCmd = &cobra.Command{
+		Use:   "keep <title>",
+		Short: "Keep one session of a fan-out and kill the other attempts",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if client, ok := liveClient(); ok {
+				result, err := client.Keep(args[0])
+				for _, title := range result.Killed {
+					fmt.Printf("Killed session '%s'\n", title)
+				}
+				return err
+			}
+
+			archive := config.LoadConfig().ArchiveOnKill
+			return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+				winner, err := findInstance(instances, args[0])
+				if err != nil {
+					return nil, err
+				}
+				losers, err := session.KeepWinner(instances, winner)
+				if err != nil {
+					return nil, err
+				}
+
+				var errs []error
+				for _, loser := range losers {
+					if err := loser.CheckKillable(); err != nil {
+						errs = append(errs, err)
+						continue
+					}
+					if archive {
+						if err := archiveInstance(loser); err != nil {
+							errs = append(errs, err)
+							continue
+						}
+					}
+					if err := loser.Kill(); err != nil {
+						log.ErrorLog.Printf("could not kill instance: %v", err)
+					}
+					for i, other := range instances {
+						if other == loser {
+							instances = append(instances[:i], instances[i+1:]...)
+							break
+						}
+					}
+					fmt.Printf("Killed session '%s'\n", loser.Title)
+				}
+				return instances, errors.Join(errs...)
+			})
+		},
+	}
+
+	tagCmd = &cobra.Command{
+		Use:   "tag <title> [tag]...",
+		Short: "Add tags to a session, or remove them with --remove, and put it in a project with --project",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			remove, _ := cmd.Flags().GetBool("remove")
+			var req api.TagsRequest
+			if remove {
+				req.Remove = args[1:]
+			} else {
+				req.Add = args[1:]
+			}
+			if cmd.Flags().Changed("project") {
+				project, _ := cmd.Flags().GetString("project")
+				req.Project = &project
+			} else if len(args) == 1 {
+				return fmt.Errorf("give the tags to add or remove, or a --project")
+			}
+
+			if client, ok := liveClient(); ok {
+				summary, err := client.Tag(args[0], req)
+				if err != nil {
+					return err
+				}
+				printTagged(summary.Title, summary.Tags, summary.Project)
+				return nil
+			}
+
+			return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+				instance, err := findInstance(instances, args[0])
+				if err != nil {
+					return nil, err
+				}
+				instance.AddTags(req.Add)
+				instance.RemoveTags(req.Remove)
+				if req.Project != nil {
+					instance.SetProject(*req.Project)
+				}
+				printTagged(instance.Title, instance.Tags, instance.Project)
+				return instances, nil
+			})
+		},
+	}
+
+	transcriptCmd = &cobra.Command{
+		Use:   "transcript <title>",
+		Short: "Print the scrollback of a session, including what was saved when it was paused or killed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			transcript, err := session.LoadTranscript(args[0])
+			if err != nil {
+				return err
+			}
+			// Killed sessions are gone from storage, only their saved transcript is left.
+			err = withStoredSession(args[0], func(instance *session.Instance) error {
+				live, err := instance.Transcript()
+				if live != "" && transcript != "" {
+					transcript += "\n\n"
+				}
+				transcript += live
+				return err
+			})
+			if err != nil {
+				if transcript == "" {
+					return err
+				}
+				log.WarningLog.Printf("failed to capture the scrollback of %s: %v", args[0], err)
+			}
+			if transcript == "" {
+				return fmt.Errorf("no transcript for session '%s'", args[0])
+			}
+			fmt.Println(transcript)
+			return nil
+		},
+	}
+
+	trustCmd = &cobra.Command{
+		Use:   "trust",
+		Short: "Allow the hooks, symlinks and window commands of the current repo's settings in its sessions",
+		Long: "Sessions only copy files into their worktrees, and start windows without their command, until you " +
+			"trust the hooks, symlinks and window commands that the repo's .agent-farmer/config.json declares. Any " +
+			"change to the file revokes the trust.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			currentDir, err := filepath.Abs(".")
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			repoPath, err := git.FindGitRepoRoot(currentDir)
+			if err != nil {
+				return fmt.Errorf("must be run from within a git repository: %w", err)
+			}
+			settings, err := config.LoadRepoSettings(repoPath)
+			if err != nil {
+				return err
+			}
+			if !settings.NeedsTrust() {
+				fmt.Printf("The settings of %s have no hooks, symlinks or window commands to trust\n", repoPath)
+				return nil
+			}
+			if err := config.TrustRepoSettings(repoPath, settings); err != nil {
+				return err
+			}
+			fmt.Printf("Trusted the hooks, symlinks and window commands of %s:\n", repoPath)
+			for _, item := range settings.TrustItems() {
+				fmt.Printf("  %s\n", item)
+			}
+			return nil
+		},
+	}
+
+	queueCmd = &cobra.Command{
+		Use:   "queue",
+		Short: "Queue prompts that start as sessions when slots free up",
+	}
+
+	queueAddCmd = &cobra.Command{
+		Use:   "add [prompt]",
+		Short: "Add a prompt to the queue, or one prompt per line from a file with --file",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			file, _ := cmd.Flags().GetString("file")
+			title, _ := cmd.Flags().GetString("title")
+			program, _ := cmd.Flags().GetString("program")
+
+			var prompts []string
+			switch {
+			case len(args) == 1 && file == "":
+				prompts = []string{args[0]}
+			case len(args) == 0 && file != "":
+				var err error
+				prompts, err = readPrompts(file)
+				if err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("pass either a prompt or --file")
+			}
+			if len(prompts) == 0 {
+				return fmt.Errorf("no prompts to queue")
+			}
+			if title != "" && len(prompts) > 1 {
+				return fmt.Errorf("--title can only be used when queueing a single prompt")
+			}
+
+			currentDir, err := filepath.Abs(".")
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			if !git.IsGitRepo(currentDir) {
+				return fmt.Errorf("error: agent-farmer must be run from within a git repository")
+			}
+
+			items := make([]session.QueuedPrompt, 0, len(prompts))
+			for _, prompt := range prompts {
+				itemTitle := title
+				if itemTitle == "" {
+					itemTitle, err = session.GenerateSessionName(prompt, nil)
+					if err != nil {
+						return fmt.Errorf("failed to generate session name: %w", err)
+					}
+				}
+				items = append(items, session.QueuedPrompt{
+					Title:   itemTitle,
+					Prompt:  prompt,
+					Path:    currentDir,
+					Program: program,
+				})
+			}
+
+			var added []session.QueuedPrompt
+			if client, ok := liveClient(); ok {
+				added, err = client.Enqueue(items)
+			} else {
+				added, err = enqueueStored(items)
+			}
+			if err != nil {
+				return err
+			}
+			for _, item := range added {
+				fmt.Printf("Queued '%s'\n", item.Title)
+			}
+			return nil
+		},
+	}
+
+	queueListCmd = &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the queued prompts",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			var items []session.QueuedPrompt
+			var err error
+			if client, ok := liveClient(); ok {
+				items, err = client.Queue()
+			} else {
+				var queue *session.Queue
+				queue, err = session.NewQueue(config.LoadState())
+				if queue != nil {
+					items = queue.Items()
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				out, err := json.MarshalIndent(items, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal queue: %w", err)
+				}
+				fmt.Println(string(out))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TITLE\tPROGRAM\tQUEUED\tPROMPT")
+			for _, item := range items {
+				prompt := strings.Join(strings.Fields(item.Prompt), " ")
+				if len(prompt) > 60 {
+					prompt = prompt[:57] + "..."
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.Title, item.Program, item.AddedAt.Format(time.DateTime), prompt)
+			}
+			return w.Flush()
+		},
+	}
+
+	queueRmCmd = &cobra.Command{
+		Use:   "rm <title>",
+		Short: "Remove a prompt from the queue",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if client, ok := liveClient(); ok {
+				if err := client.Dequeue(args[0]); err != nil {
+					return err
+				}
+			} else {
+				queue, err := session.NewQueue(config.LoadState())
+				if err != nil {
+					return err
+				}
+				if err := queue.Remove(args[0]); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("Removed '%s' from the queue\n", args[0])
+			return nil
+		},
+	}
+
+	archiveCmd = &cobra.Command{
+		Use:   "archive",
+		Short: "Browse and restore sessions that were archived when they were killed",
+	}
+
+	archiveListCmd = &cobra.Command{
+		Use:     "list [query]",
+		Aliases: []string{"ls"},
+		Short:   "List archived sessions, optionally only those matching query",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			archive, err := session.NewArchive()
+			if err != nil {
+				return err
+			}
+			archived, err := archive.List()
+			if err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				archived = slices.DeleteFunc(archived, func(a session.ArchivedSession) bool {
+					return !a.Matches(args[0])
+				})
+			}
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				if archived == nil {
+					archived = []session.ArchivedSession{}
+				}
+				out, err := json.MarshalIndent(archived, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal archive: %w", err)
+				}
+				fmt.Println(string(out))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tBRANCH\tPROGRAM\tTAGS\tDIFF\tARCHIVED")
+			for _, a := range archived {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t+%d,-%d\t%s\n", a.ID, a.Branch, a.Program, strings.Join(a.Tags, ","),
+					a.Added, a.Removed, a.ArchivedAt.Format(time.DateTime))
+			}
+			return w.Flush()
+		},
+	}
+
+	archiveShowCmd = &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print an archived session's details, prompts and final diff",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			archive, err := session.NewArchive()
+			if err != nil {
+				return err
+			}
+			a, err := archive.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Title:\t%s\n", a.Title)
+			fmt.Fprintf(w, "Program:\t%s\n", a.Program)
+			fmt.Fprintf(w, "Branch:\t%s (%s)\n", a.Branch, a.Ref())
+			fmt.Fprintf(w, "Tip:\t%s\n", a.TipSHA)
+			fmt.Fprintf(w, "Repository:\t%s\n", a.RepoPath)
+			fmt.Fprintf(w, "Tags:\t%s\n", strings.Join(a.Tags, ", "))
+			fmt.Fprintf(w, "Diff:\t+%d,-%d\n", a.Added, a.Removed)
+			fmt.Fprintf(w, "Created:\t%s\n", a.CreatedAt.Format(time.DateTime))
+			fmt.Fprintf(w, "Archived:\t%s\n", a.ArchivedAt.Format(time.DateTime))
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			for n, entry := range a.History {
+				fmt.Printf("\n--- Prompt #%d, %s ---\n%s\n", n+1, entry.SentAt.Format(time.DateTime), entry.Prompt)
+			}
+			if a.Diff != "" {
+				fmt.Printf("\n--- Diff ---\n%s\n", a.Diff)
+			}
+			if showTranscript, _ := cmd.Flags().GetBool("transcript"); showTranscript && a.Transcript != "" {
+				fmt.Printf("\n--- Transcript ---\n%s\n", a.Transcript)
+			}
+			return nil
+		},
+	}
+
+	archiveRestoreCmd = &cobra.Command{
+		Use:   "restore <id>",
+		Short: "Bring an archived session back as a paused session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			if client, ok := liveClient(); ok {
+				summary, err := client.Restore(args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Restored '%s' as paused session '%s'\n", args[0], summary.Title)
+				return nil
+			}
+
+			archive, err := session.NewArchive()
+			if err != nil {
+				return err
+			}
+			return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+				titles := make([]string, 0, len(instances))
+				for _, instance := range instances {
+					titles = append(titles, instance.Title)
+				}
+				instance, err := archive.Restore(args[0], titles)
+				if err != nil {
+					return nil, err
+				}
+				fmt.Printf("Restored '%s' as paused session '%s'\n", args[0], instance.Title)
+				return append(instances, instance), nil
+			})
+		},
+	}
+
+	archiveRmCmd = &cobra.Command{
+		Use:   "rm <id>",
+		Short: "Delete an archived session for good",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.Close()
+
+			archive, err := session.NewArchive()
+			if err != nil {
+				return err
+			}
+			if err := archive.Remove(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Removed '%s' from the archive\n", args[0])
+			return nil
+		},
+	}
+
 	versionCmd = &cobra.Command{
 		Use:   "version",
 		Short: "Print the version number of agent-farmer",
@@ -167,9 +1160,273 @@ func init() {
 	// Add force flag to reset command
 	resetCmd.Flags().BoolVarP(new(bool), "force", "f", false, "Also reset cached repository configurations")
 
+	listCmd.Flags().Bool("json", false, "Print sessions as JSON")
+	statusCmd.Flags().Bool("json", false, "Print sessions as JSON")
+
+	newCmd.Flags().String("prompt", "", "Prompt to send to the new session. Also used to generate the title")
+	newCmd.Flags().StringP("title", "t", "", "Title of the new session")
+	newCmd.Flags().StringP("program", "p", "", "Program to run in the new session (defaults to the configured program)")
+
 	rootCmd.AddCommand(debugCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(resetCmd)
+	rootCmd.AddCommand(newCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+	rootCmd.AddCommand(restartCmd)
+	rootCmd.AddCommand(killCmd)
+	rootCmd.AddCommand(pushCmd)
+	rootCmd.AddCommand(rebaseCmd)
+
+	newCmd.Flags().StringArray("tag", nil, "Tag the new session, repeat for more tags")
+	newCmd.Flags().StringP("base", "b", "", "Branch, tag or commit to start the session's branch from, e.g. main, "+
+		"origin/main (fetched first) or another session's branch (defaults to default_base_ref, or the current HEAD)")
+	newCmd.Flags().String("adopt", "", "Work on an existing branch instead of creating one: a local branch, a remote "+
+		"branch like origin/feature or a pull request like #42. The title defaults to the branch name")
+	newCmd.Flags().StringArray("sparse", nil, "Check out only this directory, or the directories of this sparse "+
+		"profile of the repo, instead of the whole repo. Repeat for more")
+	listCmd.Flags().String("tag", "", "Only list sessions with this tag")
+	listCmd.Flags().String("project", "", "Only list sessions in this project")
+	tagCmd.Flags().Bool("remove", false, "Remove the tags instead of adding them")
+	tagCmd.Flags().String("project", "", "Put the session in this project, or take it out of its project with \"\"")
+	rootCmd.AddCommand(tagCmd)
+	rootCmd.AddCommand(transcriptCmd)
+	rootCmd.AddCommand(trustCmd)
+
+	fanOutCmd.Flags().String("prompt", "", "Prompt to send to every session")
+	fanOutCmd.Flags().StringP("title", "t", "", "Title of the group, the sessions are titled <title>-1..N (defaults to one generated from the prompt)")
+	fanOutCmd.Flags().StringArrayP("program", "p", nil, "Program to run, repeat for each program. Add \" xN\" to run it N times, e.g. -p \"claude x2\" -p codex")
+	rootCmd.AddCommand(fanOutCmd)
+	rootCmd.AddCommand(keepCmd)
+
+	queueAddCmd.Flags().StringP("file", "f", "", "File with one prompt per line. Blank lines and lines starting with # are skipped")
+	queueAddCmd.Flags().StringP("title", "t", "", "Title of the session (defaults to one generated from the prompt)")
+	queueAddCmd.Flags().StringP("program", "p", "", "Program to run in the session (defaults to the configured program)")
+	queueListCmd.Flags().Bool("json", false, "Print the queue as JSON")
+	queueCmd.AddCommand(queueAddCmd)
+	queueCmd.AddCommand(queueListCmd)
+	queueCmd.AddCommand(queueRmCmd)
+	rootCmd.AddCommand(queueCmd)
+
+	killCmd.Flags().Bool("archive", false, "Keep the session's diff, transcript, prompts and branch in the archive")
+	archiveListCmd.Flags().Bool("json", false, "Print archived sessions as JSON")
+	archiveShowCmd.Flags().Bool("transcript", false, "Also print the transcript")
+	archiveCmd.AddCommand(archiveListCmd)
+	archiveCmd.AddCommand(archiveShowCmd)
+	archiveCmd.AddCommand(archiveRestoreCmd)
+	archiveCmd.AddCommand(archiveRmCmd)
+	rootCmd.AddCommand(archiveCmd)
+}
+
+// printTagged prints the tags and the project of a session after af tag changed them.
+func printTagged(title string, tags []string, project string) {
+	fmt.Printf("Session '%s' is tagged [%s]", title, strings.Join(tags, ", "))
+	if project != "" {
+		fmt.Printf(" in project '%s'", project)
+	}
+	fmt.Println()
+}
+
+// headlessFlushDelay is how long headless commands wait before exiting so that keys written to a session's PTY
+// reach tmux before the attached client is torn down with the process.
+const headlessFlushDelay = 500 * time.Millisecond
+
+// liveClient returns a client for the control API of a running TUI or daemon. Commands that change sessions must go
+// through it when it's available, since the running process owns the sessions and would overwrite our changes to the
+// stored state.
+func liveClient() (*api.Client, bool) {
+	client, err := api.Dial()
+	if err != nil {
+		return nil, false
+	}
+	return client, true
+}
+
+// withSessions loads all stored instances, runs fn and saves the instances it returns. Returning a nil slice skips
+// saving. Only use it when no process is serving the control API.
+func withSessions(fn func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error)) error {
+	// Loading the instances restores their tmux sessions, which need the custom agent profiles and the server.
+	cfg := config.LoadConfig()
+	if err := tmux.SetAgentProfiles(cfg.AgentProfiles); err != nil {
+		return fmt.Errorf("invalid agent profiles: %w", err)
+	}
+	if err := tmux.SetServer(cfg.TmuxSocket, cfg.TmuxSocketPerRepo); err != nil {
+		return fmt.Errorf("failed to set up the tmux server: %w", err)
+	}
+	state := config.LoadState()
+	storage, err := session.NewStorage(state)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	instances, err := storage.LoadInstances()
+	if err != nil {
+		return fmt.Errorf("failed to load instances: %w", err)
+	}
+
+	updated, fnErr := fn(storage, instances)
+	if updated != nil {
+		if err := storage.SaveInstances(updated); err != nil {
+			return errors.Join(fnErr, fmt.Errorf("failed to save instances: %w", err))
+		}
+	}
+	return fnErr
+}
+
+// withSession runs fn on the stored instance with the given title and saves the result.
+func withSession(title string, fn func(instance *session.Instance) error) error {
+	return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+		instance, err := findInstance(instances, title)
+		if err != nil {
+			return nil, err
+		}
+		return instances, fn(instance)
+	})
+}
+
+// withStoredSession runs fn on the stored instance with the given title without saving it afterwards. It's for
+// commands that only touch the instance's worktree, which is safe to do while another process owns the session.
+func withStoredSession(title string, fn func(instance *session.Instance) error) error {
+	return withSessions(func(storage *session.Storage, instances []*session.Instance) ([]*session.Instance, error) {
+		instance, err := findInstance(instances, title)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fn(instance)
+	})
+}
+
+// loadSummaries returns the sessions of the running TUI or daemon, or the stored sessions if neither is running. The
+// stored sessions are loaded read-only, without restoring their tmux sessions.
+func loadSummaries() ([]session.Summary, error) {
+	if client, ok := liveClient(); ok {
+		return client.List()
+	}
+
+	storage, err := session.NewStorage(config.LoadState())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	data, err := storage.LoadInstanceData()
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]session.Summary, 0, len(data))
+	for _, d := range data {
+		summaries = append(summaries, d.Summary())
+	}
+	return summaries, nil
+}
+
+// printSessions prints the sessions to stdout as a table, or as a JSON array if asJSON is set.
+func printSessions(summaries []session.Summary, asJSON bool) error {
+	if asJSON {
+		out, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal sessions: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TITLE\tSTATUS\tBRANCH\tPROGRAM\tTAGS\tDIFF\tUPDATED\tSETUP\tWORKTREE")
+	for _, s := range summaries {
+		setup := s.Setup()
+		if setup == "" {
+			setup = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t+%d,-%d\t%s\t%s\t%s\n", s.Title, s.Status, s.Branch, s.Program,
+			strings.Join(s.Tags, ","), s.Added, s.Removed, s.UpdatedAt.Format(time.DateTime), setup, s.WorktreePath)
+	}
+	return w.Flush()
+}
+
+// printCreated prints what af new created, and how long setting up its worktree took.
+func printCreated(summary session.Summary) {
+	fmt.Printf("Created session '%s' on branch '%s'", summary.Title, summary.Branch)
+	if setup := summary.Setup(); setup != "" {
+		fmt.Printf(", worktree set up with %s", setup)
+	}
+	fmt.Println()
+}
+
+// readPrompts reads one prompt per line from path, or from stdin if path is "-". Blank lines and lines starting with
+// # are skipped.
+func readPrompts(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompts: %w", err)
+	}
+
+	var prompts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prompts = append(prompts, line)
+	}
+	return prompts, nil
+}
+
+// enqueueStored adds prompts to the stored queue. Only use it when no process is serving the control API, the
+// prompts are started the next time the TUI or daemon runs.
+func enqueueStored(items []session.QueuedPrompt) ([]session.QueuedPrompt, error) {
+	state := config.LoadState()
+	storage, err := session.NewStorage(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	data, err := storage.LoadInstanceData()
+	if err != nil {
+		return nil, err
+	}
+	titles := make([]string, 0, len(data))
+	for _, d := range data {
+		titles = append(titles, d.Title)
+	}
+
+	queue, err := session.NewQueue(state)
+	if err != nil {
+		return nil, err
+	}
+	return queue.Add(items, titles)
+}
+
+// archiveInstance archives the instance before it's killed.
+func archiveInstance(instance *session.Instance) error {
+	if !instance.Started() {
+		return nil
+	}
+	archive, err := session.NewArchive()
+	if err != nil {
+		return err
+	}
+	archived, err := instance.Archive(archive)
+	if err != nil {
+		return fmt.Errorf("failed to archive '%s': %w", instance.Title, err)
+	}
+	fmt.Printf("Archived session '%s' as '%s'\n", instance.Title, archived.ID)
+	return nil
+}
+
+// findInstance returns the instance with the given title.
+func findInstance(instances []*session.Instance, title string) (*session.Instance, error) {
+	for _, instance := range instances {
+		if instance.Title == title {
+			return instance, nil
+		}
+	}
+	return nil, fmt.Errorf("instance not found: %s", title)
 }
 
 func main() {
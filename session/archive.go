@@ -0,0 +1,291 @@
+package session
+
+import (
+	"agent-farmer/config"
+	"agent-farmer/log"
+	"agent-farmer/session/git"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotArchived is returned when no archived session has the requested ID.
+var ErrNotArchived = errors.New("archived session not found")
+
+// archiveDirName is the directory in the config dir that archived sessions are saved to.
+const archiveDirName = "archive"
+
+// ArchivedSession is what's kept of a session that was archived instead of just killed.
+type ArchivedSession struct {
+	// ID identifies the archived session. It's the title as a slug, see git.ArchiveSlug, with a numeric suffix if the
+	// slug was taken. It names the hidden ref and the file of the archived session.
+	ID            string         `json:"id"`
+	Title         string         `json:"title"`
+	Path          string         `json:"path"`
+	Program       string         `json:"program"`
+	Branch        string         `json:"branch"`
+	RepoPath      string         `json:"repo_path"`
+	BaseCommitSHA string         `json:"base_commit_sha"`
+	BaseRef       string         `json:"base_ref,omitempty"`
+	Adopted       bool           `json:"adopted,omitempty"`
+	Sparse        []string       `json:"sparse,omitempty"`
+	TipSHA        string         `json:"tip_sha"`
+	Tags          []string       `json:"tags,omitempty"`
+	History       []HistoryEntry `json:"history,omitempty"`
+	Added         int            `json:"added"`
+	Removed       int            `json:"removed"`
+	// Diff is the final diff of the session against its base commit.
+	Diff string `json:"diff"`
+	// Transcript is the scrollback of the session, including what was saved when it was paused.
+	Transcript string    `json:"transcript"`
+	CreatedAt  time.Time `json:"created_at"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Ref returns the hidden ref that keeps the tip of the archived branch.
+func (a ArchivedSession) Ref() string {
+	return git.ArchiveRef(a.ID)
+}
+
+// Matches returns true if query is found, ignoring case, in the ID, title, branch, program, tags or prompts of the
+// archived session.
+func (a ArchivedSession) Matches(query string) bool {
+	fields := []string{a.ID, a.Title, a.Branch, a.Program}
+	fields = append(fields, a.Tags...)
+	for _, entry := range a.History {
+		fields = append(fields, entry.Prompt)
+	}
+	query = strings.ToLower(query)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a ArchivedSession) worktree() *git.GitWorktree {
+	return git.NewGitWorktreeFromStorage(a.RepoPath, "", a.Title, a.Branch, a.BaseCommitSHA, a.BaseRef, a.Adopted, a.Sparse)
+}
+
+// Archive stores archived sessions, one JSON file per session.
+type Archive struct {
+	dir string
+}
+
+// NewArchive returns the archive in the config directory.
+func NewArchive() (*Archive, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{dir: filepath.Join(configDir, archiveDirName)}, nil
+}
+
+// List returns the archived sessions, most recently archived first.
+func (a *Archive) List() ([]ArchivedSession, error) {
+	entries, err := os.ReadDir(a.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	var archived []ArchivedSession
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(a.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archived session: %w", err)
+		}
+		var one ArchivedSession
+		if err := json.Unmarshal(data, &one); err != nil {
+			log.WarningLog.Printf("skipping unreadable archived session %s: %v", entry.Name(), err)
+			continue
+		}
+		archived = append(archived, one)
+	}
+	sort.SliceStable(archived, func(i, j int) bool {
+		return archived[i].ArchivedAt.After(archived[j].ArchivedAt)
+	})
+	return archived, nil
+}
+
+// Get returns the archived session with the given ID.
+func (a *Archive) Get(id string) (ArchivedSession, error) {
+	archived, err := a.List()
+	if err != nil {
+		return ArchivedSession{}, err
+	}
+	for _, one := range archived {
+		if one.ID == id {
+			return one, nil
+		}
+	}
+	return ArchivedSession{}, fmt.Errorf("%w: %s", ErrNotArchived, id)
+}
+
+// Remove deletes the archived session with the given ID, along with the hidden ref of its branch.
+func (a *Archive) Remove(id string) error {
+	archived, err := a.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := archived.worktree().DeleteArchiveRef(archived.ID); err != nil {
+		// The repo may be gone, the archived session should still be removable.
+		log.WarningLog.Printf("failed to delete the archive ref of %s: %v", archived.ID, err)
+	}
+	if err := os.Remove(a.path(archived.ID)); err != nil {
+		return fmt.Errorf("failed to remove archived session: %w", err)
+	}
+	return nil
+}
+
+// Restore brings the archived session with the given ID back as a paused instance, and removes it from the
+// archive. taken are the titles already in use, the instance gets a unique title among them.
+func (a *Archive) Restore(id string, taken []string) (*Instance, error) {
+	archived, err := a.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	title := UniqueTitle(archived.Title, taken)
+	worktree, err := git.NewGitWorktreeFromBranch(archived.RepoPath, title, archived.Branch, archived.BaseCommitSHA, archived.BaseRef, archived.Adopted, archived.Sparse)
+	if err != nil {
+		return nil, err
+	}
+	if err := worktree.RestoreArchivedBranch(archived.ID); err != nil {
+		return nil, err
+	}
+
+	instance, err := FromInstanceData(InstanceData{
+		Title:     title,
+		Path:      archived.Path,
+		Branch:    archived.Branch,
+		Status:    Paused,
+		CreatedAt: archived.CreatedAt,
+		UpdatedAt: time.Now(),
+		Program:   archived.Program,
+		Tags:      archived.Tags,
+		History:   archived.History,
+		Worktree: GitWorktreeData{
+			RepoPath:      worktree.GetRepoPath(),
+			WorktreePath:  worktree.GetWorktreePath(),
+			SessionName:   title,
+			BranchName:    archived.Branch,
+			BaseCommitSHA: archived.BaseCommitSHA,
+			BaseRef:       archived.BaseRef,
+			Adopted:       archived.Adopted,
+			Sparse:        archived.Sparse,
+		},
+		DiffStats: DiffStatsData{
+			Added:   archived.Added,
+			Removed: archived.Removed,
+			Content: archived.Diff,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.Remove(archived.ID); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+func (a *Archive) save(archived ArchivedSession) error {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	data, err := json.MarshalIndent(archived, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal archived session: %w", err)
+	}
+	if err := os.WriteFile(a.path(archived.ID), data, 0644); err != nil {
+		return fmt.Errorf("failed to write archived session: %w", err)
+	}
+	return nil
+}
+
+func (a *Archive) path(id string) string {
+	return filepath.Join(a.dir, fileName(id)+".json")
+}
+
+// Archive records the instance in the archive: its final diff, transcript, prompt history and the tip of its
+// branch, which is kept in a hidden ref. Uncommitted changes are committed first. The instance is left as is, the
+// caller kills it afterwards.
+func (i *Instance) Archive(archive *Archive) (ArchivedSession, error) {
+	if !i.started {
+		return ArchivedSession{}, fmt.Errorf("session '%s' hasn't started, there's nothing to archive", i.Title)
+	}
+
+	existing, err := archive.List()
+	if err != nil {
+		return ArchivedSession{}, err
+	}
+	// IDs of sessions archived before they were slugs are compared as slugs, since their ref is the sanitized ID.
+	slugs := make([]string, 0, len(existing))
+	for _, archived := range existing {
+		slugs = append(slugs, git.ArchiveSlug(archived.ID))
+	}
+	id := UniqueTitle(git.ArchiveSlug(i.Title), slugs)
+
+	if err := i.UpdateDiffStats(); err != nil {
+		log.WarningLog.Printf("could not update diff stats of %s before archiving: %v", i.Title, err)
+	}
+	commitMsg := fmt.Sprintf("[agentfarmer] update from '%s' on %s (archived)", i.Title, time.Now().Format(time.RFC822))
+	tip, err := i.gitWorktree.Archive(id, commitMsg)
+	if err != nil {
+		return ArchivedSession{}, err
+	}
+
+	transcript, err := LoadTranscript(i.Title)
+	if err != nil {
+		log.WarningLog.Printf("could not load the saved transcript of %s: %v", i.Title, err)
+	}
+	if live, err := i.Transcript(); err != nil {
+		log.WarningLog.Printf("could not capture the transcript of %s: %v", i.Title, err)
+	} else if live != "" {
+		if transcript != "" {
+			transcript += "\n\n"
+		}
+		transcript += live
+	}
+
+	archived := ArchivedSession{
+		ID:            id,
+		Title:         i.Title,
+		Path:          i.Path,
+		Program:       i.Program,
+		Branch:        i.Branch,
+		RepoPath:      i.gitWorktree.GetRepoPath(),
+		BaseCommitSHA: i.gitWorktree.GetBaseCommitSHA(),
+		BaseRef:       i.gitWorktree.GetBaseRef(),
+		Adopted:       i.gitWorktree.IsAdopted(),
+		Sparse:        i.gitWorktree.GetSparse(),
+		TipSHA:        tip,
+		Tags:          i.Tags,
+		History:       i.History,
+		Transcript:    transcript,
+		CreatedAt:     i.CreatedAt,
+		ArchivedAt:    time.Now(),
+	}
+	if i.diffStats != nil {
+		archived.Added = i.diffStats.Added
+		archived.Removed = i.diffStats.Removed
+		archived.Diff = i.diffStats.Content
+	}
+	if err := archive.save(archived); err != nil {
+		return ArchivedSession{}, err
+	}
+	return archived, nil
+}
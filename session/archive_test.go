@@ -0,0 +1,123 @@
+package session
+
+import (
+	"agent-farmer/log"
+	"agent-farmer/session/git"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gitIn runs git in dir and returns its trimmed output.
+func gitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return strings.TrimSpace(string(output))
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	gitIn(t, repo, "init", "-q", "-b", "main")
+	gitIn(t, repo, "commit", "-q", "--allow-empty", "-m", "base")
+	base := gitIn(t, repo, "rev-parse", "HEAD")
+	gitIn(t, repo, "branch", "test/feature")
+	gitIn(t, repo, "checkout", "-q", "test/feature")
+	gitIn(t, repo, "commit", "-q", "--allow-empty", "-m", "work")
+	tip := gitIn(t, repo, "rev-parse", "HEAD")
+	gitIn(t, repo, "checkout", "-q", "main")
+
+	// A paused instance, so there's no worktree or tmux session to capture.
+	instance := &Instance{
+		Title:       "feature",
+		Program:     "claude",
+		Branch:      "test/feature",
+		Status:      Paused,
+		Tags:        []string{"ui"},
+		started:     true,
+		gitWorktree: git.NewGitWorktreeFromStorage(repo, "/nonexistent/feature", "feature", "test/feature", base, "", false, nil),
+	}
+	instance.recordPrompt("build the feature")
+
+	archive, err := NewArchive()
+	require.NoError(t, err)
+	archived, err := instance.Archive(archive)
+	require.NoError(t, err)
+	require.Equal(t, "feature", archived.ID)
+	require.Equal(t, tip, archived.TipSHA)
+	require.Equal(t, tip, gitIn(t, repo, "rev-parse", archived.Ref()))
+
+	// Killing the instance deletes its branch, the hidden ref keeps the work.
+	gitIn(t, repo, "branch", "-D", "test/feature")
+
+	listed, err := archive.List()
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	require.True(t, listed[0].Matches("BUILD"))
+	require.False(t, listed[0].Matches("unrelated"))
+
+	restored, err := archive.Restore("feature", []string{"feature"})
+	require.NoError(t, err)
+	require.Equal(t, "feature-2", restored.Title)
+	require.True(t, restored.Paused())
+	require.Equal(t, []string{"ui"}, restored.Tags)
+	require.Equal(t, "build the feature", restored.History[0].Prompt)
+	require.Equal(t, tip, gitIn(t, repo, "rev-parse", "refs/heads/test/feature"))
+
+	// Restoring takes the session out of the archive.
+	listed, err = archive.List()
+	require.NoError(t, err)
+	require.Empty(t, listed)
+	_, err = archive.Restore("feature", nil)
+	require.ErrorIs(t, err, ErrNotArchived)
+}
+
+func TestArchiveIDsDontCollide(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	gitIn(t, repo, "init", "-q", "-b", "main")
+	gitIn(t, repo, "commit", "-q", "--allow-empty", "-m", "base")
+	base := gitIn(t, repo, "rev-parse", "HEAD")
+
+	archive, err := NewArchive()
+	require.NoError(t, err)
+	// These titles only differ in case and punctuation, they'd share a ref and a file if used as they are.
+	var archived []ArchivedSession
+	for i, title := range []string{"Fix Bug", "fix-bug", "fix/bug"} {
+		branch := fmt.Sprintf("test/branch-%d", i)
+		gitIn(t, repo, "branch", branch)
+		instance := &Instance{
+			Title:       title,
+			Program:     "claude",
+			Branch:      branch,
+			Status:      Paused,
+			started:     true,
+			gitWorktree: git.NewGitWorktreeFromStorage(repo, "/nonexistent/"+branch, title, branch, base, "", false, nil),
+		}
+		one, err := instance.Archive(archive)
+		require.NoError(t, err)
+		archived = append(archived, one)
+	}
+	require.Equal(t, "fix-bug", archived[0].ID)
+	require.Equal(t, "fix-bug-2", archived[1].ID)
+	require.Equal(t, "fix-bug-3", archived[2].ID)
+	listed, err := archive.List()
+	require.NoError(t, err)
+	require.Len(t, listed, 3)
+
+	// Removing one keeps the refs of the others.
+	require.NoError(t, archive.Remove(archived[0].ID))
+	gitIn(t, repo, "rev-parse", "--verify", archived[1].Ref())
+	gitIn(t, repo, "rev-parse", "--verify", archived[2].Ref())
+}
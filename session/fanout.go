@@ -0,0 +1,140 @@
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultFanOut is the number of attempts a fan-out makes when no programs are given.
+const defaultFanOut = 3
+
+// maxFanOut caps the number of attempts in a single fan-out.
+const maxFanOut = 10
+
+// repeatSuffix matches the " xN" suffix used to repeat a program in a fan-out, e.g. "claude x3".
+var repeatSuffix = regexp.MustCompile(`(^|\s+)x(\d+)$`)
+
+// FanOutOptions describes a group of instances that attempt the same prompt.
+type FanOutOptions struct {
+	// Title is the title of the group. Attempts are titled Title-1..N, so their branches are prefix/Title-1..N.
+	Title string
+	// Path is the path to the workspace.
+	Path string
+	// Prompt is sent to every attempt once it starts.
+	Prompt string
+	// Programs has one program per attempt.
+	Programs []string
+}
+
+// ParseFanOutPrograms expands program specs into one program per attempt. A spec is a program, optionally followed
+// by " xN" to run it N times, e.g. "claude x2". With no specs, defaultProgram is run three times.
+func ParseFanOutPrograms(specs []string, defaultProgram string) ([]string, error) {
+	var programs []string
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		count := 1
+		if m := repeatSuffix.FindStringSubmatch(spec); m != nil {
+			count, _ = strconv.Atoi(m[2])
+			spec = strings.TrimSpace(strings.TrimSuffix(spec, m[0]))
+		}
+		if spec == "" {
+			spec = defaultProgram
+		}
+		for n := 0; n < count; n++ {
+			programs = append(programs, spec)
+		}
+	}
+	if len(programs) == 0 {
+		for n := 0; n < defaultFanOut; n++ {
+			programs = append(programs, defaultProgram)
+		}
+	}
+	if len(programs) < 2 {
+		return nil, fmt.Errorf("a fan-out needs at least 2 attempts")
+	}
+	if len(programs) > maxFanOut {
+		return nil, fmt.Errorf("a fan-out can have at most %d attempts, got %d", maxFanOut, len(programs))
+	}
+	return programs, nil
+}
+
+// NewFanOut creates one instance per program, all in the same group. The instances aren't started. taken are the
+// titles already in use, the group title is made unique among them.
+func NewFanOut(opts FanOutOptions, taken []string) ([]*Instance, error) {
+	if opts.Title == "" {
+		return nil, fmt.Errorf("title cannot be empty")
+	}
+	if len(opts.Programs) == 0 {
+		return nil, fmt.Errorf("a fan-out needs at least one program")
+	}
+
+	// Reserve the whole range of attempt titles, so the group doesn't collide with an earlier one.
+	group := opts.Title
+	for n := 2; groupTaken(group, len(opts.Programs), taken); n++ {
+		group = fmt.Sprintf("%s-%d", opts.Title, n)
+	}
+
+	instances := make([]*Instance, 0, len(opts.Programs))
+	for n, program := range opts.Programs {
+		instance, err := NewInstance(InstanceOptions{
+			Title:   fmt.Sprintf("%s-%d", group, n+1),
+			Path:    opts.Path,
+			Program: program,
+		})
+		if err != nil {
+			return nil, err
+		}
+		instance.Group = group
+		instance.Prompt = opts.Prompt
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+func groupTaken(group string, size int, taken []string) bool {
+	for _, title := range taken {
+		if title == group {
+			return true
+		}
+		for n := 1; n <= size; n++ {
+			if title == fmt.Sprintf("%s-%d", group, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GroupMembers returns the instances in the given group, in the order they appear in instances.
+func GroupMembers(instances []*Instance, group string) []*Instance {
+	if group == "" {
+		return nil
+	}
+	var members []*Instance
+	for _, instance := range instances {
+		if instance.Group == group {
+			members = append(members, instance)
+		}
+	}
+	return members
+}
+
+// KeepWinner removes winner from its group and returns the other attempts, which the caller should kill.
+func KeepWinner(instances []*Instance, winner *Instance) ([]*Instance, error) {
+	if winner.Group == "" {
+		return nil, fmt.Errorf("session '%s' is not part of a fan-out", winner.Title)
+	}
+	var losers []*Instance
+	for _, instance := range GroupMembers(instances, winner.Group) {
+		if instance != winner {
+			losers = append(losers, instance)
+		}
+	}
+	winner.Group = ""
+	return losers, nil
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFanOutPrograms(t *testing.T) {
+	testCases := []struct {
+		name    string
+		specs   []string
+		want    []string
+		wantErr bool
+	}{
+		{"defaults to three runs", nil, []string{"claude", "claude", "claude"}, false},
+		{"one of each", []string{"claude", "codex", "aider --model x"}, []string{"claude", "codex", "aider --model x"}, false},
+		{"repeat suffix", []string{"claude x2", " codex "}, []string{"claude", "claude", "codex"}, false},
+		{"repeat the default", []string{"x2"}, []string{"claude", "claude"}, false},
+		{"single attempt", []string{"codex"}, nil, true},
+		{"too many attempts", []string{"claude x11"}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			programs, err := ParseFanOutPrograms(tc.specs, "claude")
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, programs)
+		})
+	}
+}
+
+func TestFanOutAndKeepWinner(t *testing.T) {
+	attempts, err := NewFanOut(FanOutOptions{
+		Title:    "task",
+		Path:     t.TempDir(),
+		Prompt:   "fix it",
+		Programs: []string{"claude", "codex"},
+	}, []string{"task-1"})
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	// task-1 is taken, so the whole group moves to a new title.
+	require.Equal(t, "task-2-1", attempts[0].Title)
+	require.Equal(t, "task-2-2", attempts[1].Title)
+	require.Equal(t, "codex", attempts[1].Program)
+	require.Equal(t, "fix it", attempts[1].Prompt)
+
+	other := &Instance{Title: "other"}
+	instances := append([]*Instance{other}, attempts...)
+	require.Equal(t, attempts, GroupMembers(instances, "task-2"))
+
+	losers, err := KeepWinner(instances, attempts[1])
+	require.NoError(t, err)
+	require.Equal(t, []*Instance{attempts[0]}, losers)
+	require.Empty(t, attempts[1].Group)
+
+	_, err = KeepWinner(instances, other)
+	require.Error(t, err)
+}
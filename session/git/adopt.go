@@ -0,0 +1,140 @@
+package git
+
+import (
+	"agent-farmer/config"
+	"agent-farmer/log"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pullRequestRegex matches a pull request given by number, e.g. "42" or "#42", or by URL.
+var pullRequestRegex = regexp.MustCompile(`^(?:#?|https?://\S+/pull/)(\d+)/?$`)
+
+// NewGitWorktreeFromExisting creates a GitWorktree for a session that continues the work on an existing branch
+// instead of creating one. ref is a local branch, a remote branch like origin/feature, or a pull request like #42,
+// which are fetched into a local branch first. The diff of the session is taken against the merge-base of the branch
+// with the default branch. The branch is kept when the session is killed. The worktree isn't created until Setup is
+// called.
+func NewGitWorktreeFromExisting(repoPath string, sessionName string, ref string) (tree *GitWorktree, branchName string, err error) {
+	repoPath, err = repoRoot(repoPath)
+	if err != nil {
+		return nil, "", err
+	}
+	worktreePath, err := newWorktreePath(sessionName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	g := &GitWorktree{repoPath: repoPath, worktreePath: worktreePath, sessionName: sessionName, adopted: true}
+	if g.branchName, err = g.adoptBranch(strings.TrimSpace(ref)); err != nil {
+		return nil, "", err
+	}
+	if g.baseRef, g.baseCommitSHA, err = g.adoptedBase(); err != nil {
+		return nil, "", err
+	}
+	return g, g.branchName, nil
+}
+
+// AdoptedBranchName returns the name of the local branch ref is checked out as, without fetching anything. It's
+// meant for naming the session before it's created.
+func AdoptedBranchName(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if match := pullRequestRegex.FindStringSubmatch(ref); match != nil {
+		return "pr-" + match[1]
+	}
+	if remote, branch, ok := strings.Cut(ref, "/"); ok && remote == "origin" {
+		return branch
+	}
+	return ref
+}
+
+// adoptBranch makes sure there's a local branch for ref and returns its name.
+func (g *GitWorktree) adoptBranch(ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("no branch or pull request to check out")
+	}
+	if match := pullRequestRegex.FindStringSubmatch(ref); match != nil {
+		return g.fetchPullRequest(match[1])
+	}
+	if g.isLocalBranch(ref) {
+		return ref, nil
+	}
+
+	remote, branch, ok := g.remoteBranch(ref)
+	if !ok {
+		// A branch that was pushed by someone else only exists on origin.
+		remote, branch = "origin", ref
+	}
+	if _, err := g.runGitCommand(g.repoPath, "fetch", remote, branch); err != nil {
+		return "", fmt.Errorf("%s isn't a local branch and couldn't be fetched from %s: %w", ref, remote, err)
+	}
+	if g.isLocalBranch(branch) {
+		return branch, g.fastForward(branch, remote+"/"+branch)
+	}
+	if _, err := g.runGitCommand(g.repoPath, "branch", "--track", branch, remote+"/"+branch); err != nil {
+		return "", fmt.Errorf("failed to create branch %s from %s/%s: %w", branch, remote, branch, err)
+	}
+	return branch, nil
+}
+
+// fastForward moves the local branch to upstream if it's behind it, so that adopting a remote branch works on its
+// latest commit. Like for pull requests, it fails if the branch has commits that upstream doesn't: adopting either
+// would work on the wrong code.
+func (g *GitWorktree) fastForward(branch string, upstream string) error {
+	if _, err := g.runGitCommand(g.repoPath, "merge-base", "--is-ancestor", branch, upstream); err != nil {
+		return fmt.Errorf("local branch %s has commits that %s doesn't, merge or reset it, or adopt %s instead: %w",
+			branch, upstream, branch, err)
+	}
+	local, err := g.runGitCommand(g.repoPath, "rev-parse", branch)
+	if err != nil {
+		return fmt.Errorf("failed to resolve branch %s: %w", branch, err)
+	}
+	remote, err := g.runGitCommand(g.repoPath, "rev-parse", upstream)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", upstream, err)
+	}
+	if local == remote {
+		return nil
+	}
+	if _, err := g.runGitCommand(g.repoPath, "branch", "-f", branch, upstream); err != nil {
+		return fmt.Errorf("failed to fast-forward branch %s to %s: %w", branch, upstream, err)
+	}
+	log.InfoLog.Printf("fast-forwarded branch %s to %s", branch, upstream)
+	return nil
+}
+
+// fetchPullRequest fetches the head of the pull request into the local branch pr-<number> and returns its name. The
+// head branch's own name isn't used, since for pull requests from forks it's often one of the repo's branches, e.g.
+// main.
+func (g *GitWorktree) fetchPullRequest(number string) (string, error) {
+	branch := "pr-" + number
+	// The fetch only fast-forwards an existing branch, so local commits on it aren't lost. If it can't, the branch
+	// isn't the pull request anymore and adopting it would work on the wrong code.
+	if _, err := g.runGitCommand(g.repoPath, "fetch", "origin", fmt.Sprintf("pull/%s/head:refs/heads/%s", number, branch)); err != nil {
+		return "", fmt.Errorf("failed to fetch pull request #%s into branch %s: %w", number, branch, err)
+	}
+	return branch, nil
+}
+
+// adoptedBase returns the ref an adopted branch is taken to be based on, the default branch of origin if there is
+// one, and the commit where the branch forked from it.
+func (g *GitWorktree) adoptedBase() (ref string, commit string, err error) {
+	candidates := []string{"HEAD"}
+	if defaultBranch, err := config.GetDefaultBranch(g.repoPath); err != nil {
+		log.WarningLog.Printf("failed to get the default branch, taking the diff against HEAD: %v", err)
+	} else {
+		candidates = []string{"origin/" + defaultBranch, defaultBranch, "HEAD"}
+	}
+	for _, candidate := range candidates {
+		output, err := g.runGitCommand(g.repoPath, "merge-base", candidate, g.branchName)
+		if err != nil {
+			continue
+		}
+		if candidate == "HEAD" {
+			candidate = ""
+		}
+		return candidate, strings.TrimSpace(output), nil
+	}
+	return "", "", fmt.Errorf("branch %s has no commit in common with the repository's HEAD", g.branchName)
+}
@@ -0,0 +1,79 @@
+package git
+
+import (
+	"agent-farmer/log"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGitWorktreeFromExisting(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+	t.Setenv("HOME", t.TempDir())
+
+	upstream := t.TempDir()
+	gitIn(t, upstream, "init", "-q", "-b", "main")
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-m", "base")
+	base := gitIn(t, upstream, "rev-parse", "HEAD")
+	gitIn(t, upstream, "checkout", "-q", "-b", "pushed")
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-m", "pushed work")
+	pushed := gitIn(t, upstream, "rev-parse", "HEAD")
+	// GitHub keeps the head of a pull request under refs/pull.
+	gitIn(t, upstream, "update-ref", "refs/pull/7/head", pushed)
+	gitIn(t, upstream, "checkout", "-q", "main")
+
+	repo := t.TempDir()
+	gitIn(t, repo, "clone", "-q", upstream, ".")
+	gitIn(t, repo, "branch", "local")
+
+	tests := []struct {
+		ref    string
+		branch string
+		tip    string
+	}{
+		{ref: "local", branch: "local", tip: base},
+		{ref: "origin/pushed", branch: "pushed", tip: pushed},
+		{ref: "#7", branch: "pr-7", tip: pushed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			worktree, branch, err := NewGitWorktreeFromExisting(repo, "adopted", tt.ref)
+			require.NoError(t, err)
+			require.Equal(t, tt.branch, branch)
+			require.Equal(t, tt.tip, gitIn(t, repo, "rev-parse", branch))
+			require.Equal(t, base, worktree.GetBaseCommitSHA())
+			require.Equal(t, "origin/main", worktree.GetBaseRef())
+
+			// The branch isn't the session's, so it outlives it.
+			require.NoError(t, worktree.Setup())
+			require.NoError(t, worktree.Cleanup())
+			require.Equal(t, tt.tip, gitIn(t, repo, "rev-parse", branch))
+		})
+	}
+
+	_, _, err := NewGitWorktreeFromExisting(repo, "adopted", "no-such-branch")
+	require.Error(t, err)
+
+	// A local branch that's behind the remote one is fast-forwarded, one with its own commits isn't adopted.
+	gitIn(t, upstream, "checkout", "-q", "pushed")
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-m", "more pushed work")
+	pushed = gitIn(t, upstream, "rev-parse", "HEAD")
+	gitIn(t, upstream, "checkout", "-q", "main")
+	_, branch, err := NewGitWorktreeFromExisting(repo, "adopted", "origin/pushed")
+	require.NoError(t, err)
+	require.Equal(t, pushed, gitIn(t, repo, "rev-parse", branch))
+	gitIn(t, repo, "checkout", "-q", "pushed")
+	gitIn(t, repo, "commit", "-q", "--allow-empty", "-m", "local work")
+	gitIn(t, repo, "checkout", "-q", "main")
+	_, _, err = NewGitWorktreeFromExisting(repo, "adopted", "origin/pushed")
+	require.ErrorContains(t, err, "local branch pushed has commits that origin/pushed doesn't")
+
+	// A pr-7 branch that isn't the pull request anymore isn't adopted in its place.
+	gitIn(t, repo, "branch", "-f", "pr-7", "main")
+	gitIn(t, repo, "checkout", "-q", "pr-7")
+	gitIn(t, repo, "commit", "-q", "--allow-empty", "-m", "unrelated")
+	gitIn(t, repo, "checkout", "-q", "main")
+	_, _, err = NewGitWorktreeFromExisting(repo, "adopted", "#7")
+	require.Error(t, err)
+}
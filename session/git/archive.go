@@ -0,0 +1,109 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// archiveRefPrefix is where the tips of archived branches are kept. Refs outside refs/heads don't show up as
+// branches, but they keep the commits from being garbage collected.
+const archiveRefPrefix = "refs/agentfarmer/archive/"
+
+// archiveIDRegex matches what isn't allowed in archive IDs.
+var archiveIDRegex = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// ArchiveRef returns the hidden ref that keeps the tip of the branch archived with the given id.
+func ArchiveRef(id string) string {
+	return archiveRefPrefix + sanitizeBranchName(id)
+}
+
+// ArchiveSlug turns a title into an archive ID that's used as is in refs and file names: lower case letters, digits,
+// '-' and '_'. Titles that differ only in case or punctuation get the same slug.
+func ArchiveSlug(title string) string {
+	slug := strings.Trim(archiveIDRegex.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if slug == "" {
+		return "session"
+	}
+	return slug
+}
+
+// NewGitWorktreeFromBranch creates a GitWorktree for an existing branch, with a fresh worktree path. The worktree
+// isn't created until Setup is called.
+func NewGitWorktreeFromBranch(repoPath string, sessionName string, branchName string, baseCommitSHA string, baseRef string, adopted bool, sparse []string) (*GitWorktree, error) {
+	worktreePath, err := newWorktreePath(sessionName)
+	if err != nil {
+		return nil, err
+	}
+	return NewGitWorktreeFromStorage(repoPath, worktreePath, sessionName, branchName, baseCommitSHA, baseRef, adopted, sparse), nil
+}
+
+// Archive commits any uncommitted changes in the worktree and points the hidden ref of the given id at the tip of
+// the branch, so the work survives the branch being deleted. It returns the SHA of the tip.
+func (g *GitWorktree) Archive(id string, commitMessage string) (string, error) {
+	// Paused instances have no worktree, their changes were committed when they were paused.
+	if _, err := os.Stat(g.worktreePath); err == nil {
+		if err := g.commitChanges(commitMessage); err != nil {
+			return "", err
+		}
+	}
+
+	output, err := g.runGitCommand(g.repoPath, "rev-parse", "--verify", "refs/heads/"+g.branchName)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve branch %s: %w", g.branchName, err)
+	}
+	sha := strings.TrimSpace(output)
+	if _, err := g.runGitCommand(g.repoPath, "update-ref", ArchiveRef(id), sha); err != nil {
+		return "", fmt.Errorf("failed to create archive ref: %w", err)
+	}
+	return sha, nil
+}
+
+// RestoreArchivedBranch recreates the branch from the hidden ref of the given id. Adopted branches are kept when
+// their session is killed, so they're used as they are if they still exist.
+func (g *GitWorktree) RestoreArchivedBranch(id string) error {
+	repo, err := git.PlainOpen(g.repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	if _, err := repo.Reference(plumbing.NewBranchReferenceName(g.branchName), false); err == nil {
+		if g.adopted {
+			return nil
+		}
+		return fmt.Errorf("branch %s already exists", g.branchName)
+	}
+	if _, err := g.runGitCommand(g.repoPath, "branch", g.branchName, ArchiveRef(id)); err != nil {
+		return fmt.Errorf("failed to restore branch %s: %w", g.branchName, err)
+	}
+	return nil
+}
+
+// DeleteArchiveRef deletes the hidden ref of the given id.
+func (g *GitWorktree) DeleteArchiveRef(id string) error {
+	if _, err := g.runGitCommand(g.repoPath, "update-ref", "-d", ArchiveRef(id)); err != nil {
+		return fmt.Errorf("failed to delete archive ref: %w", err)
+	}
+	return nil
+}
+
+// commitChanges commits any uncommitted changes in the worktree without pushing them.
+func (g *GitWorktree) commitChanges(commitMessage string) error {
+	dirty, err := g.IsDirty()
+	if err != nil {
+		return err
+	}
+	if !dirty {
+		return nil
+	}
+	if err := g.stage("."); err != nil {
+		return fmt.Errorf("failed to stage changes: %w", err)
+	}
+	if _, err := g.runGitCommand(g.worktreePath, "commit", "-m", commitMessage, "--no-verify"); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+	return nil
+}
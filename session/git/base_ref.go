@@ -0,0 +1,66 @@
+package git
+
+import (
+	"agent-farmer/log"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// resolveBaseRef returns the commit the branch of a new worktree starts from. Remote-tracking branches, e.g.
+// origin/main, are fetched first so the branch starts from the latest commit of the remote.
+func (g *GitWorktree) resolveBaseRef() (string, error) {
+	if g.baseRef == "" {
+		output, err := g.runGitCommand(g.repoPath, "rev-parse", "HEAD")
+		if err != nil {
+			if strings.Contains(err.Error(), "fatal: ambiguous argument 'HEAD'") ||
+				strings.Contains(err.Error(), "fatal: not a valid object name") ||
+				strings.Contains(err.Error(), "fatal: HEAD: not a valid object name") {
+				return "", fmt.Errorf("this appears to be a brand new repository: please create an initial commit before creating an instance")
+			}
+			return "", fmt.Errorf("failed to get HEAD commit hash: %w", err)
+		}
+		return strings.TrimSpace(output), nil
+	}
+
+	if remote, branch, ok := g.remoteBranch(g.baseRef); ok {
+		// An unreachable remote shouldn't keep sessions from starting, the last fetched commit is used instead.
+		if _, err := g.runGitCommand(g.repoPath, "fetch", remote, branch); err != nil {
+			log.WarningLog.Printf("failed to fetch %s, using the last fetched commit: %v", g.baseRef, err)
+		}
+	}
+	output, err := g.runGitCommand(g.repoPath, "rev-parse", "--verify", "--quiet", g.baseRef+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("base ref %s isn't a branch, tag or commit of the repository", g.baseRef)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// remoteBranch splits a remote-tracking branch like origin/main into the remote and the branch. It returns false if
+// ref doesn't start with the name of a remote of the repository.
+func (g *GitWorktree) remoteBranch(ref string) (remote string, branch string, ok bool) {
+	remote, branch, ok = strings.Cut(ref, "/")
+	if !ok || branch == "" {
+		return "", "", false
+	}
+	repo, err := git.PlainOpen(g.repoPath)
+	if err != nil {
+		return "", "", false
+	}
+	if _, err := repo.Remote(remote); err != nil {
+		return "", "", false
+	}
+	return remote, branch, true
+}
+
+// isLocalBranch returns true if ref is a branch of the repository, e.g. the branch of another session.
+func (g *GitWorktree) isLocalBranch(ref string) bool {
+	repo, err := git.PlainOpen(g.repoPath)
+	if err != nil {
+		return false
+	}
+	_, err = repo.Reference(plumbing.NewBranchReferenceName(ref), false)
+	return err == nil
+}
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"agent-farmer/log"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gitIn runs git in dir and returns its trimmed output.
+func gitIn(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return strings.TrimSpace(string(output))
+}
+
+func TestResolveBaseRef(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+
+	upstream := t.TempDir()
+	gitIn(t, upstream, "init", "-q", "-b", "main")
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-m", "base")
+
+	repo := t.TempDir()
+	gitIn(t, repo, "clone", "-q", upstream, ".")
+	main := gitIn(t, repo, "rev-parse", "HEAD")
+	gitIn(t, repo, "checkout", "-q", "-b", "feature")
+	gitIn(t, repo, "commit", "-q", "--allow-empty", "-m", "work")
+	feature := gitIn(t, repo, "rev-parse", "HEAD")
+	gitIn(t, upstream, "commit", "-q", "--allow-empty", "-m", "upstream")
+	latest := gitIn(t, upstream, "rev-parse", "HEAD")
+
+	tests := map[string]string{
+		// The current HEAD of the repo, which is the feature branch.
+		"":            feature,
+		"main":        main,
+		"origin/main": latest,
+		feature[:8]:   feature,
+	}
+	for ref, want := range tests {
+		t.Run(ref, func(t *testing.T) {
+			worktree := NewGitWorktreeFromStorage(repo, "", "test", "test/test", "", ref, false, nil)
+			got, err := worktree.resolveBaseRef()
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		})
+	}
+
+	worktree := NewGitWorktreeFromStorage(repo, "", "test", "test/test", "", "no-such-branch", false, nil)
+	_, err := worktree.resolveBaseRef()
+	require.Error(t, err)
+}
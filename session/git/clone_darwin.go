@@ -0,0 +1,12 @@
+package git
+
+import (
+	"io/fs"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile creates dst as a clone of src on APFS. Clones keep the mode of src.
+func cloneFile(src, dst string, _ fs.FileMode) error {
+	return unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package git
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// cloneFile isn't supported here, so worktrees are checked out instead.
+func cloneFile(src, dst string, perm fs.FileMode) error {
+	return errors.ErrUnsupported
+}
@@ -26,7 +26,7 @@ func (g *GitWorktree) Diff() *DiffStats {
 	stats := &DiffStats{}
 
 	// -N stages untracked files (intent to add), including them in the diff
-	_, err := g.runGitCommand(g.worktreePath, "add", "-N", ".")
+	err := g.stage("-N", ".")
 	if err != nil {
 		stats.Error = err
 		return stats
@@ -49,3 +49,18 @@ func (g *GitWorktree) Diff() *DiffStats {
 
 	return stats
 }
+
+// Files returns the paths of the files changed in the diff, in diff order.
+func (d *DiffStats) Files() []string {
+	var files []string
+	for _, line := range strings.Split(d.Content, "\n") {
+		if !strings.HasPrefix(line, "diff --git ") {
+			continue
+		}
+		// The line is "diff --git a/<path> b/<path>", take the new path.
+		if idx := strings.LastIndex(line, " b/"); idx >= 0 {
+			files = append(files, line[idx+len(" b/"):])
+		}
+	}
+	return files
+}
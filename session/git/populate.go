@@ -0,0 +1,146 @@
+package git
+
+import (
+	"agent-farmer/config"
+	"agent-farmer/log"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SetupReport is how a worktree was set up, to compare the worktree strategies.
+type SetupReport struct {
+	// Strategy is the strategy that was used. It may not be the configured one, e.g. reflink falls back to checkout.
+	Strategy string
+	// Duration is how long creating and populating the worktree took.
+	Duration time.Duration
+}
+
+// String describes the setup, e.g. "reflink in 1.2s". It's empty if the worktree wasn't set up.
+func (r SetupReport) String() string {
+	if r.Strategy == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s in %s", r.Strategy, r.Duration.Round(time.Millisecond))
+}
+
+// addWorktree runs git worktree add with args and writes the worktree's files with the repo's worktree strategy, see
+// config.WorktreeConfig, or as a sparse checkout of the worktree's own directories if it has some. How long it took
+// is logged and kept, see GetSetup, to compare strategies.
+func (g *GitWorktree) addWorktree(args ...string) error {
+	worktreeConfig := config.WorktreeConfig{}
+	if settings, err := config.LoadRepoSettings(g.repoPath); err != nil {
+		log.WarningLog.Printf("failed to load repo settings, checking out the whole worktree: %v", err)
+	} else {
+		worktreeConfig = settings.Worktree
+	}
+	if len(g.sparse) > 0 {
+		worktreeConfig.Strategy = config.WorktreeStrategySparse
+		worktreeConfig.Sparse = g.sparse
+	}
+
+	start := time.Now()
+	strategy, err := g.populate(worktreeConfig, args)
+	if err != nil {
+		return err
+	}
+	g.setup = SetupReport{Strategy: strategy, Duration: time.Since(start)}
+	log.InfoLog.Printf("set up worktree %s with the %s", g.worktreePath, g.setup)
+	return nil
+}
+
+// populate creates the worktree and returns the strategy that was used. A sparse worktree keeps its directories, so
+// they're staged correctly, see stage.
+func (g *GitWorktree) populate(worktreeConfig config.WorktreeConfig, args []string) (string, error) {
+	strategy := worktreeConfig.Strategy
+	if strategy == "" || strategy == config.WorktreeStrategyCheckout {
+		if _, err := g.runGitCommand(g.repoPath, append([]string{"worktree", "add"}, args...)...); err != nil {
+			return "", err
+		}
+		return config.WorktreeStrategyCheckout, nil
+	}
+
+	// The other strategies write the files themselves, or tell git which ones to write first.
+	if _, err := g.runGitCommand(g.repoPath, append([]string{"worktree", "add", "--no-checkout"}, args...)...); err != nil {
+		return "", err
+	}
+	switch strategy {
+	case config.WorktreeStrategySparse:
+		args := append([]string{"sparse-checkout", "set", "--cone"}, worktreeConfig.Sparse...)
+		if _, err := g.runGitCommand(g.worktreePath, args...); err != nil {
+			return "", fmt.Errorf("failed to set sparse checkout: %w", err)
+		}
+		g.sparse = worktreeConfig.Sparse
+	case config.WorktreeStrategyReflink:
+		cloned, err := g.cloneFiles()
+		if err != nil {
+			log.WarningLog.Printf("failed to clone files into %s after %d files, checking out the rest: %v",
+				g.worktreePath, cloned, err)
+		}
+		if cloned == 0 {
+			strategy = config.WorktreeStrategyCheckout
+		}
+		// Let git find the clones that match the worktree's commit, so it only writes the others.
+		if _, err := g.runGitCommand(g.worktreePath, "read-tree", "HEAD"); err != nil {
+			return "", fmt.Errorf("failed to read worktree index: %w", err)
+		}
+		if _, err := g.runGitCommand(g.worktreePath, "update-index", "-q", "--refresh"); err != nil {
+			return "", fmt.Errorf("failed to refresh worktree index: %w", err)
+		}
+	}
+
+	if _, err := g.runGitCommand(g.worktreePath, "reset", "-q", "--hard"); err != nil {
+		return "", fmt.Errorf("failed to check out worktree: %w", err)
+	}
+	if strategy == config.WorktreeStrategyReflink {
+		// Clones of files the worktree's commit doesn't have.
+		if _, err := g.runGitCommand(g.worktreePath, "clean", "-fdq"); err != nil {
+			return "", fmt.Errorf("failed to clean worktree: %w", err)
+		}
+	}
+	return strategy, nil
+}
+
+// cloneFiles clones the files tracked in the main checkout into the worktree. Clones share their blocks with the
+// originals until either is written to, so they take next to no time or space. It returns the number of files cloned
+// before an error, e.g. because the filesystem can't clone.
+func (g *GitWorktree) cloneFiles() (int, error) {
+	output, err := g.runGitCommand(g.repoPath, "ls-files", "-z")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	cloned := 0
+	for _, name := range strings.Split(strings.TrimSuffix(output, "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+		src := filepath.Join(g.repoPath, filepath.FromSlash(name))
+		// Deleted files, symlinks and submodules are left for git to check out.
+		info, err := os.Lstat(src)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		dst := filepath.Join(g.worktreePath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return cloned, err
+		}
+		if err := cloneFile(src, dst, info.Mode().Perm()); err != nil {
+			return cloned, err
+		}
+		cloned++
+	}
+	return cloned, nil
+}
+
+// stage runs git add with args in the worktree. Sparse worktrees stage files outside their directories too, in case
+// the agent created some, rather than failing.
+func (g *GitWorktree) stage(args ...string) error {
+	if len(g.sparse) > 0 {
+		args = append([]string{"--sparse"}, args...)
+	}
+	_, err := g.runGitCommand(g.worktreePath, append([]string{"add"}, args...)...)
+	return err
+}
@@ -0,0 +1,98 @@
+package git
+
+import (
+	"agent-farmer/config"
+	"agent-farmer/log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorktreeStrategies(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+	t.Setenv("HOME", t.TempDir())
+
+	repo := t.TempDir()
+	gitIn(t, repo, "init", "-q", "-b", "main")
+	writeFile := func(name, content string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(repo, name), []byte(content), 0644))
+	}
+	writeFile("top", "base")
+	writeFile("api/main.go", "package main")
+	writeFile("web/index.html", "<html>")
+	gitIn(t, repo, "add", ".")
+	gitIn(t, repo, "commit", "-q", "-m", "base")
+	writeFile("api/new.go", "package main")
+	gitIn(t, repo, "add", ".")
+	gitIn(t, repo, "commit", "-q", "-m", "new")
+	// The main checkout doesn't match either commit.
+	writeFile("top", "uncommitted")
+
+	setup := func(t *testing.T, settings string, baseRef string) (string, SetupReport) {
+		t.Helper()
+		writeFile(".agent-farmer/config.json", settings)
+		worktreePath := filepath.Join(t.TempDir(), "worktree")
+		worktree := NewGitWorktreeFromStorage(repo, worktreePath, "test", "test/"+t.Name(), "", baseRef, false, nil)
+		require.NoError(t, worktree.Setup())
+		dirty, err := worktree.IsDirty()
+		require.NoError(t, err)
+		require.False(t, dirty)
+		require.NotZero(t, worktree.GetSetup().Duration)
+		return worktreePath, worktree.GetSetup()
+	}
+
+	t.Run("reflink", func(t *testing.T) {
+		// Filesystems that can't clone fall back to checking out.
+		worktreePath, report := setup(t, `{"worktree": {"strategy": "reflink"}}`, "HEAD~1")
+		require.Contains(t, []string{config.WorktreeStrategyReflink, config.WorktreeStrategyCheckout}, report.Strategy)
+		data, err := os.ReadFile(filepath.Join(worktreePath, "top"))
+		require.NoError(t, err)
+		require.Equal(t, "base", string(data))
+		require.FileExists(t, filepath.Join(worktreePath, "web", "index.html"))
+		require.NoFileExists(t, filepath.Join(worktreePath, "api", "new.go"))
+	})
+
+	t.Run("sparse", func(t *testing.T) {
+		worktreePath, report := setup(t, `{"worktree": {"strategy": "sparse", "sparse": ["api"]}}`, "")
+		require.Equal(t, config.WorktreeStrategySparse, report.Strategy)
+		require.FileExists(t, filepath.Join(worktreePath, "top"))
+		require.FileExists(t, filepath.Join(worktreePath, "api", "new.go"))
+		require.NoDirExists(t, filepath.Join(worktreePath, "web"))
+	})
+
+	t.Run("session sparse", func(t *testing.T) {
+		writeFile(".agent-farmer/config.json", `{}`)
+		worktreePath := filepath.Join(t.TempDir(), "worktree")
+		worktree := NewGitWorktreeFromStorage(repo, worktreePath, "test", "test/session-sparse", "", "", false, []string{"web"})
+		require.NoError(t, worktree.Setup())
+		require.NoDirExists(t, filepath.Join(worktreePath, "api"))
+
+		// Files created outside the sparse directories still show up in the diff and get committed.
+		require.NoError(t, os.MkdirAll(filepath.Join(worktreePath, "api"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(worktreePath, "api", "extra.go"), []byte("package api\n"), 0644))
+		stats := worktree.Diff()
+		require.NoError(t, stats.Error)
+		require.Equal(t, []string{"api/extra.go"}, stats.Files())
+		for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+			t.Setenv(name, "test")
+		}
+		for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+			t.Setenv(name, "test@example.com")
+		}
+		require.NoError(t, worktree.commitChanges("work"))
+
+		// Like pausing and resuming, the worktree is recreated with the same directories.
+		require.NoError(t, worktree.Remove())
+		require.NoError(t, worktree.Setup())
+		require.FileExists(t, filepath.Join(worktreePath, "web", "index.html"))
+		require.NoFileExists(t, filepath.Join(worktreePath, "api", "main.go"))
+		stats = worktree.Diff()
+		require.NoError(t, stats.Error)
+		require.Equal(t, []string{"api/extra.go"}, stats.Files())
+	})
+}
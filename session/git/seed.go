@@ -0,0 +1,111 @@
+package git
+
+import (
+	"agent-farmer/log"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SeedFiles copies the files matching copyPatterns and links the ones matching symlinkPatterns from the main checkout
+// into the worktree. They're things git doesn't check out, like .env or node_modules. Paths that already exist in the
+// worktree, e.g. because they're tracked, are left alone.
+func (g *GitWorktree) SeedFiles(copyPatterns []string, symlinkPatterns []string) error {
+	var errs []error
+	for _, pattern := range copyPatterns {
+		if err := g.seed(pattern, copyPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, pattern := range symlinkPatterns {
+		if err := g.seed(pattern, os.Symlink); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// seed places every path of the main checkout that matches pattern at the same place in the worktree.
+func (g *GitWorktree) seed(pattern string, place func(src, dst string) error) error {
+	matches, err := filepath.Glob(filepath.Join(g.repoPath, pattern))
+	if err != nil {
+		return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		log.WarningLog.Printf("nothing matches %s in %s", pattern, g.repoPath)
+		return nil
+	}
+
+	for _, src := range matches {
+		rel, err := filepath.Rel(g.repoPath, src)
+		if err != nil {
+			return fmt.Errorf("failed to seed %s: %w", src, err)
+		}
+		dst := filepath.Join(g.worktreePath, rel)
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("failed to seed %s: %w", rel, err)
+		}
+		if err := place(src, dst); err != nil {
+			return fmt.Errorf("failed to seed %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// copyPath copies the file or directory at src to dst, keeping modes and symlinks.
+func copyPath(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			// Sockets, pipes and the like aren't worth carrying over.
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
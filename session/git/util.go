@@ -67,7 +67,8 @@ func IsGitRepo(path string) bool {
 	}
 }
 
-func findGitRepoRoot(path string) (string, error) {
+// FindGitRepoRoot returns the root of the git repository containing path.
+func FindGitRepoRoot(path string) (string, error) {
 	currentPath := path
 	for {
 		_, err := git.PlainOpen(currentPath)
@@ -39,53 +39,83 @@ type GitWorktree struct {
 	branchName string
 	// Base commit hash for the worktree
 	baseCommitSHA string
+	// Ref the branch was created from, e.g. "origin/main". Empty if it was the repo's HEAD.
+	baseRef string
+	// Whether the branch existed before the session, see NewGitWorktreeFromExisting. It's kept when the session is
+	// killed.
+	adopted bool
+	// Directories checked out instead of the whole repo, as a sparse-checkout cone. Empty checks out what the repo's
+	// worktree settings say.
+	sparse []string
+	// How the worktree was last set up, see addWorktree.
+	setup SetupReport
 }
 
-func NewGitWorktreeFromStorage(repoPath string, worktreePath string, sessionName string, branchName string, baseCommitSHA string) *GitWorktree {
+func NewGitWorktreeFromStorage(repoPath string, worktreePath string, sessionName string, branchName string, baseCommitSHA string, baseRef string, adopted bool, sparse []string) *GitWorktree {
 	return &GitWorktree{
 		repoPath:      repoPath,
 		worktreePath:  worktreePath,
 		sessionName:   sessionName,
 		branchName:    branchName,
 		baseCommitSHA: baseCommitSHA,
+		baseRef:       baseRef,
+		adopted:       adopted,
+		sparse:        sparse,
 	}
 }
 
-// NewGitWorktree creates a new GitWorktree instance
-func NewGitWorktree(repoPath string, sessionName string) (tree *GitWorktree, branchname string, err error) {
+// NewGitWorktree creates a new GitWorktree instance. Its branch is created from baseRef, a branch, tag or SHA, or from
+// the configured default base ref if it's empty. The repo's HEAD is used if both are empty.
+func NewGitWorktree(repoPath string, sessionName string, baseRef string) (tree *GitWorktree, branchname string, err error) {
 	cfg := config.LoadConfig()
+	if baseRef == "" {
+		baseRef = cfg.DefaultBaseRef
+	}
 	sanitizedName := sanitizeBranchName(sessionName)
 	branchName := fmt.Sprintf("%s%s", cfg.BranchPrefix, sanitizedName)
 
-	// Convert repoPath to absolute path
-	absPath, err := filepath.Abs(repoPath)
-	if err != nil {
-		log.ErrorLog.Printf("git worktree path abs error, falling back to repoPath %s: %s", repoPath, err)
-		// If we can't get absolute path, use original path as fallback
-		absPath = repoPath
-	}
-
-	repoPath, err = findGitRepoRoot(absPath)
+	repoPath, err = repoRoot(repoPath)
 	if err != nil {
 		return nil, "", err
 	}
 
-	worktreeDir, err := getWorktreeDirectory()
+	worktreePath, err := newWorktreePath(sessionName)
 	if err != nil {
 		return nil, "", err
 	}
 
-	worktreePath := filepath.Join(worktreeDir, sanitizedName)
-	worktreePath = worktreePath + "_" + fmt.Sprintf("%x", time.Now().UnixNano())
-
 	return &GitWorktree{
 		repoPath:     repoPath,
 		sessionName:  sessionName,
 		branchName:   branchName,
 		worktreePath: worktreePath,
+		baseRef:      baseRef,
 	}, branchName, nil
 }
 
+// repoRoot returns the absolute path of the root of the repository that contains path.
+func repoRoot(path string) (string, error) {
+	// Convert path to absolute path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		log.ErrorLog.Printf("git worktree path abs error, falling back to repoPath %s: %s", path, err)
+		// If we can't get absolute path, use original path as fallback
+		absPath = path
+	}
+	return FindGitRepoRoot(absPath)
+}
+
+// newWorktreePath returns a unique path for a new worktree of the session.
+func newWorktreePath(sessionName string) (string, error) {
+	worktreeDir, err := getWorktreeDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	worktreePath := filepath.Join(worktreeDir, sanitizeBranchName(sessionName))
+	return worktreePath + "_" + fmt.Sprintf("%x", time.Now().UnixNano()), nil
+}
+
 // GetWorktreePath returns the path to the worktree
 func (g *GitWorktree) GetWorktreePath() string {
 	return g.worktreePath
@@ -110,3 +140,34 @@ func (g *GitWorktree) GetRepoName() string {
 func (g *GitWorktree) GetBaseCommitSHA() string {
 	return g.baseCommitSHA
 }
+
+// GetBaseRef returns the ref the branch was created from, or "" if it was the repo's HEAD.
+func (g *GitWorktree) GetBaseRef() string {
+	return g.baseRef
+}
+
+// IsAdopted returns true if the branch existed before the session, see NewGitWorktreeFromExisting.
+func (g *GitWorktree) IsAdopted() bool {
+	return g.adopted
+}
+
+// GetSparse returns the directories checked out instead of the whole repo, or nil if it's all checked out.
+func (g *GitWorktree) GetSparse() []string {
+	return g.sparse
+}
+
+// SetSparse sets the directories to check out instead of the whole repo. It takes effect when the worktree is set up.
+func (g *GitWorktree) SetSparse(sparse []string) {
+	g.sparse = sparse
+}
+
+// GetSetup returns how the worktree was last set up. It's zero if it wasn't set up since it was created or loaded
+// without one.
+func (g *GitWorktree) GetSetup() SetupReport {
+	return g.setup
+}
+
+// SetSetup restores how the worktree was last set up, e.g. when it's loaded from storage.
+func (g *GitWorktree) SetSetup(setup SetupReport) {
+	g.setup = setup
+}
@@ -44,7 +44,7 @@ func (g *GitWorktree) PushChanges(commitMessage string, open bool) error {
 
 	if isDirty {
 		// Stage all changes
-		if _, err := g.runGitCommand(g.worktreePath, "add", "."); err != nil {
+		if err := g.stage("."); err != nil {
 			log.ErrorLog.Print(err)
 			return fmt.Errorf("failed to stage changes: %w", err)
 		}
@@ -121,8 +121,10 @@ func (g *GitWorktree) OpenBranchURL() error {
 	return nil
 }
 
-// RebaseOntoDefault rebases the current branch onto the default branch using git rebase --onto
-func (g *GitWorktree) RebaseOntoDefault() error {
+// RebaseOntoBase rebases the current branch onto its base using git rebase --onto. The base is the base ref if
+// it's a branch, e.g. the branch of another session for stacked work, and the default branch of origin otherwise.
+// Diffs are taken against the new base afterwards.
+func (g *GitWorktree) RebaseOntoBase() error {
 	// Use mutex to prevent concurrent git operations
 	gitMutex.Lock()
 	defer gitMutex.Unlock()
@@ -131,15 +133,6 @@ func (g *GitWorktree) RebaseOntoDefault() error {
 	log.DebugLog.Printf("rebase working on branch: %s", g.branchName)
 	log.DebugLog.Printf("repository path: %s", g.repoPath)
 
-	// Get the default branch for this repository
-	defaultBranch, err := config.GetDefaultBranch(g.repoPath)
-	if err != nil {
-		log.ErrorLog.Printf("failed to get default branch for %s: %v", g.repoPath, err)
-		return fmt.Errorf("failed to get default branch: %w", err)
-	}
-
-	log.InfoLog.Printf("rebasing branch %s onto default branch %s", g.branchName, defaultBranch)
-
 	// Check if there are any uncommitted changes
 	log.DebugLog.Printf("checking for uncommitted changes...")
 	isDirty, err := g.IsDirty()
@@ -154,13 +147,12 @@ func (g *GitWorktree) RebaseOntoDefault() error {
 	}
 	log.DebugLog.Printf("worktree is clean, proceeding with rebase...")
 
-	// Ensure we have the latest changes from the default branch
-	// First fetch the latest changes
-	log.DebugLog.Printf("fetching latest changes from origin/%s...", defaultBranch)
-	if _, err := g.runGitCommand(g.worktreePath, "fetch", "origin", defaultBranch); err != nil {
-		log.ErrorLog.Printf("failed to fetch changes: %v", err)
-		return fmt.Errorf("failed to fetch latest changes: %w", err)
+	// Ensure we have the latest changes of the base
+	target, err := g.rebaseTarget()
+	if err != nil {
+		return err
 	}
+	log.InfoLog.Printf("rebasing branch %s onto %s", g.branchName, target)
 
 	// Get the current branch name
 	log.DebugLog.Printf("getting current branch name...")
@@ -174,11 +166,11 @@ func (g *GitWorktree) RebaseOntoDefault() error {
 
 	// Get the merge-base fork-point
 	log.DebugLog.Printf("finding merge-base fork-point...")
-	forkPoint, err := g.runGitCommand(g.worktreePath, "merge-base", "--fork-point", "origin/"+defaultBranch)
+	forkPoint, err := g.runGitCommand(g.worktreePath, "merge-base", "--fork-point", target)
 	if err != nil {
 		// If fork-point fails, use regular merge-base as fallback
 		log.WarningLog.Printf("merge-base --fork-point failed, falling back to regular merge-base: %v", err)
-		forkPoint, err = g.runGitCommand(g.worktreePath, "merge-base", "origin/"+defaultBranch, currentBranch)
+		forkPoint, err = g.runGitCommand(g.worktreePath, "merge-base", target, currentBranch)
 		if err != nil {
 			log.ErrorLog.Printf("failed to find merge-base: %v", err)
 			return fmt.Errorf("failed to find merge-base: %w", err)
@@ -189,8 +181,8 @@ func (g *GitWorktree) RebaseOntoDefault() error {
 
 	// Perform the rebase using --onto
 	// This is equivalent to: git rebase --onto origin/main $(git merge-base --fork-point origin/main) HEAD
-	log.DebugLog.Printf("executing rebase: git rebase --onto origin/%s %s %s", defaultBranch, forkPoint, currentBranch)
-	if _, err := g.runGitCommand(g.worktreePath, "rebase", "--onto", "origin/"+defaultBranch, forkPoint, currentBranch); err != nil {
+	log.DebugLog.Printf("executing rebase: git rebase --onto %s %s %s", target, forkPoint, currentBranch)
+	if _, err := g.runGitCommand(g.worktreePath, "rebase", "--onto", target, forkPoint, currentBranch); err != nil {
 		log.ErrorLog.Printf("rebase command failed: %v", err)
 		// If rebase fails, we should abort it to leave the repo in a clean state
 		if abortErr := g.abortRebase(); abortErr != nil {
@@ -199,10 +191,46 @@ func (g *GitWorktree) RebaseOntoDefault() error {
 		return fmt.Errorf("rebase failed: %w", err)
 	}
 
-	log.InfoLog.Printf("successfully rebased %s onto %s", currentBranch, defaultBranch)
+	// The branch now starts at the target, so its diff shouldn't include what changed in between.
+	base, err := g.runGitCommand(g.worktreePath, "rev-parse", target)
+	if err != nil {
+		return fmt.Errorf("failed to get the new base commit: %w", err)
+	}
+	g.baseCommitSHA = strings.TrimSpace(base)
+
+	log.InfoLog.Printf("successfully rebased %s onto %s", currentBranch, target)
 	return nil
 }
 
+// rebaseTarget fetches the base of the branch and returns the ref to rebase onto, see RebaseOntoBase.
+func (g *GitWorktree) rebaseTarget() (string, error) {
+	if g.baseRef != "" {
+		if remote, branch, ok := g.remoteBranch(g.baseRef); ok {
+			log.DebugLog.Printf("fetching latest changes from %s...", g.baseRef)
+			if _, err := g.runGitCommand(g.worktreePath, "fetch", remote, branch); err != nil {
+				return "", fmt.Errorf("failed to fetch latest changes: %w", err)
+			}
+			return g.baseRef, nil
+		}
+		if g.isLocalBranch(g.baseRef) {
+			return g.baseRef, nil
+		}
+	}
+
+	// Get the default branch for this repository
+	defaultBranch, err := config.GetDefaultBranch(g.repoPath)
+	if err != nil {
+		log.ErrorLog.Printf("failed to get default branch for %s: %v", g.repoPath, err)
+		return "", fmt.Errorf("failed to get default branch: %w", err)
+	}
+	log.DebugLog.Printf("fetching latest changes from origin/%s...", defaultBranch)
+	if _, err := g.runGitCommand(g.worktreePath, "fetch", "origin", defaultBranch); err != nil {
+		log.ErrorLog.Printf("failed to fetch changes: %v", err)
+		return "", fmt.Errorf("failed to fetch latest changes: %w", err)
+	}
+	return "origin/" + defaultBranch, nil
+}
+
 // abortRebase aborts an ongoing rebase operation
 func (g *GitWorktree) abortRebase() error {
 	_, err := g.runGitCommand(g.worktreePath, "rebase", "--abort")
@@ -26,7 +26,7 @@ func (g *GitWorktree) Setup() error {
 		return g.SetupFromExistingBranch()
 	}
 
-	// Branch doesn't exist, create new worktree from HEAD
+	// Branch doesn't exist, create new worktree from the base ref
 	return g.SetupNewWorktree()
 }
 
@@ -45,14 +45,14 @@ func (g *GitWorktree) SetupFromExistingBranch() error {
 	_, _ = g.runGitCommand(g.repoPath, "worktree", "remove", "-f", g.worktreePath) // Ignore error if worktree doesn't exist
 
 	// Create a new worktree from the existing branch
-	if _, err := g.runGitCommand(g.repoPath, "worktree", "add", g.worktreePath, g.branchName); err != nil {
+	if err := g.addWorktree(g.worktreePath, g.branchName); err != nil {
 		return fmt.Errorf("failed to create worktree from branch %s: %w", g.branchName, err)
 	}
 
 	return nil
 }
 
-// SetupNewWorktree creates a new worktree from HEAD
+// SetupNewWorktree creates a new worktree and branch from the base ref, HEAD if there is none
 func (g *GitWorktree) SetupNewWorktree() error {
 	// Ensure worktrees directory exists
 	worktreesDir, err := getWorktreeDirectory()
@@ -77,24 +77,17 @@ func (g *GitWorktree) SetupNewWorktree() error {
 		return fmt.Errorf("failed to cleanup existing branch: %w", err)
 	}
 
-	output, err := g.runGitCommand(g.repoPath, "rev-parse", "HEAD")
+	baseCommit, err := g.resolveBaseRef()
 	if err != nil {
-		if strings.Contains(err.Error(), "fatal: ambiguous argument 'HEAD'") ||
-			strings.Contains(err.Error(), "fatal: not a valid object name") ||
-			strings.Contains(err.Error(), "fatal: HEAD: not a valid object name") {
-			return fmt.Errorf("this appears to be a brand new repository: please create an initial commit before creating an instance")
-		}
-		return fmt.Errorf("failed to get HEAD commit hash: %w", err)
+		return err
 	}
-	headCommit := strings.TrimSpace(string(output))
-	g.baseCommitSHA = headCommit
+	g.baseCommitSHA = baseCommit
 
-	// Create a new worktree from the HEAD commit
+	// Create a new worktree from the base commit
 	// Otherwise, we'll inherit uncommitted changes from the previous worktree.
 	// This way, we can start the worktree with a clean slate.
-	// TODO: we might want to give an option to use main/master instead of the current branch.
-	if _, err := g.runGitCommand(g.repoPath, "worktree", "add", "-b", g.branchName, g.worktreePath, headCommit); err != nil {
-		return fmt.Errorf("failed to create worktree from commit %s: %w", headCommit, err)
+	if err := g.addWorktree("-b", g.branchName, g.worktreePath, baseCommit); err != nil {
+		return fmt.Errorf("failed to create worktree from commit %s: %w", baseCommit, err)
 	}
 
 	return nil
@@ -124,8 +117,10 @@ func (g *GitWorktree) Cleanup() error {
 
 	branchRef := plumbing.NewBranchReferenceName(g.branchName)
 
-	// Check if branch exists before attempting removal
-	if _, err := repo.Reference(branchRef, false); err == nil {
+	// Check if branch exists before attempting removal. Adopted branches aren't the session's to remove.
+	if g.adopted {
+		log.InfoLog.Printf("keeping adopted branch %s", g.branchName)
+	} else if _, err := repo.Reference(branchRef, false); err == nil {
 		if err := repo.Storer.RemoveReference(branchRef); err != nil {
 			errs = append(errs, fmt.Errorf("failed to remove branch %s: %w", g.branchName, err))
 		}
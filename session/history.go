@@ -0,0 +1,37 @@
+package session
+
+import (
+	"time"
+)
+
+// maxHistory caps the number of prompts kept per instance, dropping the oldest.
+const maxHistory = 100
+
+// HistoryEntry is a prompt that was sent to an instance.
+type HistoryEntry struct {
+	Prompt string    `json:"prompt"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// recordPrompt adds prompt to the history of the instance.
+func (i *Instance) recordPrompt(prompt string) {
+	i.History = append(i.History, HistoryEntry{Prompt: prompt, SentAt: time.Now()})
+	if len(i.History) > maxHistory {
+		i.History = i.History[len(i.History)-maxHistory:]
+	}
+}
+
+// PromptHistory returns the distinct prompts sent to the instance, most recent first.
+func (i *Instance) PromptHistory() []string {
+	var prompts []string
+	seen := make(map[string]bool)
+	for n := len(i.History) - 1; n >= 0; n-- {
+		prompt := i.History[n].Prompt
+		if seen[prompt] {
+			continue
+		}
+		seen[prompt] = true
+		prompts = append(prompts, prompt)
+	}
+	return prompts
+}
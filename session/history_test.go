@@ -0,0 +1,33 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptHistory(t *testing.T) {
+	instance := &Instance{Title: "a"}
+	instance.recordPrompt("fix the tests")
+	instance.recordPrompt("add docs")
+	instance.recordPrompt("fix the tests")
+	require.Len(t, instance.History, 3)
+	require.Equal(t, []string{"fix the tests", "add docs"}, instance.PromptHistory())
+
+	// The history survives a round trip through storage.
+	encoded, err := json.Marshal(instance.ToInstanceData())
+	require.NoError(t, err)
+	var data InstanceData
+	require.NoError(t, json.Unmarshal(encoded, &data))
+	require.Len(t, data.History, 3)
+	require.Equal(t, "add docs", data.History[1].Prompt)
+	require.True(t, data.History[1].SentAt.Equal(instance.History[1].SentAt))
+
+	for n := 0; n < maxHistory; n++ {
+		instance.recordPrompt(fmt.Sprintf("prompt %d", n))
+	}
+	require.Len(t, instance.History, maxHistory)
+	require.Equal(t, "prompt 0", instance.History[0].Prompt)
+}
@@ -0,0 +1,222 @@
+package session
+
+import (
+	"agent-farmer/config"
+	"agent-farmer/log"
+	"agent-farmer/session/tmux"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// hookLogDirName is the directory in the config dir that the output of hooks is saved to.
+	hookLogDirName = "hooks"
+	// hookTimeout caps how long a hook may run. Hooks hold up starting, pausing and killing their session, so long
+	// running commands like dev servers belong in windows.
+	hookTimeout = 5 * time.Minute
+)
+
+// HookLogPath returns the path the output of the hooks of the instance with the given title is saved to.
+func HookLogPath(title string) (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, hookLogDirName, fileName(title)+".log"), nil
+}
+
+// UntrustedSettingsError is the hook error of an instance whose repo's settings would run hooks or window commands,
+// or link files, but the user hasn't trusted them. Nothing was run or linked.
+type UntrustedSettingsError struct {
+	// RepoPath is the root of the repo.
+	RepoPath string
+	// Settings are the repo's settings, as the user would trust them with Instance.TrustSettings.
+	Settings *config.RepoSettings
+}
+
+func (e *UntrustedSettingsError) Error() string {
+	return fmt.Sprintf("skipped the hooks, symlinks and window commands of %s since they aren't trusted, run 'af "+
+		"trust' in the repo to allow them", filepath.Base(e.RepoPath))
+}
+
+// HookError returns why the repo's hooks, or copying its files into the worktree, failed the last time the instance
+// ran them, and whether they were skipped since the user doesn't trust them. It's nil if they succeeded.
+func (i *Instance) HookError() error {
+	if i.untrustedErr == nil {
+		return i.hookErr
+	}
+	return errors.Join(i.untrustedErr, i.hookErr)
+}
+
+// repoSettings loads the settings of the instance's repo. The session goes on without them if they're broken.
+func (i *Instance) repoSettings() *config.RepoSettings {
+	settings, err := config.LoadRepoSettings(i.gitWorktree.GetRepoPath())
+	if err != nil {
+		log.WarningLog.Printf("failed to load repo settings of %s: %v", i.Title, err)
+		return &config.RepoSettings{}
+	}
+	return settings
+}
+
+// hooks returns the hooks of the repo's settings, or none if the user hasn't trusted them.
+func (i *Instance) hooks() config.HooksConfig {
+	settings := i.repoSettings()
+	if !config.RepoSettingsTrusted(i.gitWorktree.GetRepoPath(), settings) {
+		log.WarningLog.Printf("skipping the untrusted hooks of %s", i.Title)
+		return config.HooksConfig{}
+	}
+	return settings.Hooks
+}
+
+// prepareWorktree copies and links the files the repo's settings ask for from the main checkout into the new
+// worktree, then runs the post-create hooks. Unless the user trusted the settings, it only copies, see
+// UntrustedSettingsError.
+func (i *Instance) prepareWorktree(settings *config.RepoSettings) {
+	symlinks, postCreate := settings.Symlink, settings.Hooks.PostCreate
+	var errs []error
+	i.untrustedErr = nil
+	if repoPath := i.gitWorktree.GetRepoPath(); !config.RepoSettingsTrusted(repoPath, settings) {
+		log.WarningLog.Printf("skipping the untrusted hooks and symlinks of %s", i.Title)
+		symlinks, postCreate = nil, nil
+		i.untrustedErr = &UntrustedSettingsError{RepoPath: repoPath, Settings: settings}
+	}
+	if err := i.gitWorktree.SeedFiles(settings.Copy, symlinks); err != nil {
+		log.WarningLog.Printf("failed to copy files into the worktree of %s: %v", i.Title, err)
+		errs = append(errs, fmt.Errorf("failed to copy files into the worktree: %w", err))
+	}
+	if err := i.runHooks("post_create", postCreate); err != nil {
+		errs = append(errs, err)
+	}
+	i.hookErr = errors.Join(errs...)
+}
+
+// TrustSettings records that the user trusts settings, the ones of an UntrustedSettingsError of the instance, for
+// its repo. If the instance is running, the symlinks and post-create hooks that were skipped are made and run, and
+// their error is returned. The windows that were started without their command run it.
+func (i *Instance) TrustSettings(settings *config.RepoSettings) error {
+	if err := config.TrustRepoSettings(i.gitWorktree.GetRepoPath(), settings); err != nil {
+		return err
+	}
+	if !i.started || i.Paused() {
+		return nil
+	}
+	i.prepareWorktree(settings)
+	err := i.HookError()
+
+	untrusted := i.untrustedWindows
+	i.untrustedWindows = nil
+	for _, window := range i.trustedWindows() {
+		if window.Command == "" || !slices.Contains(untrusted, window.Name) {
+			continue
+		}
+		if err := i.tmuxSession.RespawnWindow(window, i.gitWorktree.GetWorktreePath()); err != nil {
+			log.WarningLog.Printf("failed to run the command of window %s of %s: %v", window.Name, i.Title, err)
+		}
+	}
+	return err
+}
+
+// trustedWindows returns the instance's windows as they may be started: the commands of the windows are only kept if
+// the user trusts them as part of the repo's settings as they are now. The others run a shell, and are recorded so
+// that TrustSettings can run their command.
+func (i *Instance) trustedWindows() []tmux.Window {
+	settings := i.repoSettings()
+	trusted := config.RepoSettingsTrusted(i.gitWorktree.GetRepoPath(), settings)
+	windows := make([]tmux.Window, 0, len(i.Windows))
+	for _, window := range i.Windows {
+		if window.Command != "" && !(trusted && slices.ContainsFunc(settings.Windows, func(w config.WindowConfig) bool {
+			return w.Name == window.Name && w.Command == window.Command
+		})) {
+			log.WarningLog.Printf("starting window %s of %s without its untrusted command", window.Name, i.Title)
+			if !slices.Contains(i.untrustedWindows, window.Name) {
+				i.untrustedWindows = append(i.untrustedWindows, window.Name)
+			}
+			window.Command = ""
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// runHooks runs the given commands of a hook in the instance's worktree, stopping at the first one that fails. Their
+// output is appended to the instance's hook log. It does nothing if the worktree is gone.
+func (i *Instance) runHooks(event string, commands []string) error {
+	i.hookErr = nil
+	if len(commands) == 0 {
+		return nil
+	}
+	if _, err := os.Stat(i.gitWorktree.GetWorktreePath()); err != nil {
+		return nil
+	}
+	for _, command := range commands {
+		if err := i.runHook(event, command); err != nil {
+			log.WarningLog.Printf("%v", err)
+			i.hookErr = err
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Instance) runHook(event string, command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	cmd := hookCommand(ctx, command)
+	cmd.Dir = i.gitWorktree.GetWorktreePath()
+	cmd.Env = append(os.Environ(),
+		"AF_SESSION="+i.Title,
+		"AF_BRANCH="+i.gitWorktree.GetBranchName(),
+		"AF_REPO_PATH="+i.gitWorktree.GetRepoPath(),
+		"AF_WORKTREE_PATH="+i.gitWorktree.GetWorktreePath(),
+	)
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", hookTimeout)
+	}
+
+	path, pathErr := HookLogPath(i.Title)
+	if pathErr == nil {
+		header := fmt.Sprintf("=== %s %s: %s at %s (%s) ===", i.Title, event, command, start.Format(time.RFC3339),
+			time.Since(start).Round(time.Millisecond))
+		pathErr = appendLog(path, header, strings.TrimRight(string(output), "\n"))
+	}
+	if pathErr != nil {
+		log.WarningLog.Printf("failed to save hook output of %s: %v", i.Title, pathErr)
+	}
+
+	if err != nil {
+		message := fmt.Sprintf("%s hook '%s' failed: %v", event, command, err)
+		if last := lastLine(string(output)); last != "" {
+			message += ": " + last
+		}
+		if pathErr == nil {
+			message += fmt.Sprintf(" (see %s)", path)
+		}
+		return errors.New(message)
+	}
+	return nil
+}
+
+// hookCommand returns the command that runs a hook with the platform's shell.
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// lastLine returns the last non-empty line of output, which usually says why a command failed.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
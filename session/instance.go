@@ -1,6 +1,7 @@
 package session
 
 import (
+	"agent-farmer/config"
 	"agent-farmer/log"
 	"agent-farmer/session/git"
 	"agent-farmer/session/tmux"
@@ -8,7 +9,9 @@ import (
 
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/atotto/clipboard"
@@ -17,16 +20,58 @@ import (
 type Status int
 
 const (
-	// Running is the status when the instance is running and claude is working.
+	// Running is the status when the instance is running and its agent is working.
 	Running Status = iota
-	// Ready is if the claude instance is ready to be interacted with (waiting for user input).
+	// Ready is if the agent is idle at its input, ready to be interacted with.
 	Ready
 	// Loading is if the instance is loading (if we are starting it up or something).
 	Loading
 	// Paused is if the instance is paused (worktree removed but branch preserved).
 	Paused
+	// Pending is if the instance is waiting to be started because a limit was reached. It has no worktree or tmux
+	// session yet.
+	Pending
+	// AwaitingApproval is if the agent asks to approve an action and AutoYes didn't approve it.
+	AwaitingApproval
+	// RateLimited is if the agent hit a rate or usage limit.
+	RateLimited
+	// Errored is if the agent shows an error, e.g. from its API.
+	Errored
+	// Exited is if the agent quit or crashed, or its tmux session is gone. It can be restarted in the same worktree.
+	Exited
 )
 
+// String returns a short, human readable name for the status.
+func (s Status) String() string {
+	switch s {
+	case Running:
+		return "running"
+	case Ready:
+		return "ready"
+	case Loading:
+		return "loading"
+	case Paused:
+		return "paused"
+	case Pending:
+		return "pending"
+	case AwaitingApproval:
+		return "awaiting-approval"
+	case RateLimited:
+		return "rate-limited"
+	case Errored:
+		return "errored"
+	case Exited:
+		return "exited"
+	default:
+		return "unknown"
+	}
+}
+
+// NeedsAttention returns true if the agent can't continue without the user.
+func (s Status) NeedsAttention() bool {
+	return s == AwaitingApproval || s == RateLimited || s == Errored || s == Exited
+}
+
 // Instance is a running instance of claude code.
 type Instance struct {
 	// Title is the title of the instance.
@@ -51,6 +96,27 @@ type Instance struct {
 	AutoYes bool
 	// Prompt is the initial prompt to pass to the instance on startup
 	Prompt string
+	// Group is the fan-out group the instance belongs to, if any. Instances in a group attempt the same prompt.
+	Group string
+	// BaseRef is the ref the instance's branch is created from, e.g. "origin/main" or another instance's branch.
+	// Empty means the repo's HEAD when the instance starts.
+	BaseRef string
+	// Adopt is the existing branch or pull request the instance works on instead of a branch of its own, e.g.
+	// "origin/feature" or "#42".
+	Adopt string
+	// Sparse are the directories checked out instead of the whole repo. Until the instance starts, they may also be
+	// names of the repo's sparse profiles. Empty checks out what the repo's worktree settings say.
+	Sparse []string
+	// Tags are free-form labels used to group and filter instances.
+	Tags []string
+	// Project is the group the user put the instance in, e.g. the feature or ticket it's part of. Unlike Group, it
+	// isn't tied to a fan-out.
+	Project string
+	// History is every prompt sent to the instance, oldest first.
+	History []HistoryEntry
+	// Windows are auxiliary tmux windows next to the agent's, e.g. a dev server or a shell. They're declared by the
+	// repo's settings when the instance is created, started with the agent and killed with it.
+	Windows []tmux.Window
 
 	// DiffStats stores the current git diff statistics
 	diffStats *git.DiffStats
@@ -62,6 +128,17 @@ type Instance struct {
 	tmuxSession *tmux.TmuxSession
 	// gitWorktree is the git worktree for the instance.
 	gitWorktree *git.GitWorktree
+	// hookErr is why the repo's hooks failed the last time they ran, see HookError.
+	hookErr error
+	// untrustedErr is set when the repo's settings weren't trusted the last time the worktree was prepared. It's kept
+	// apart from hookErr, so that running other hooks doesn't clear it.
+	untrustedErr *UntrustedSettingsError
+	// untrustedWindows are the names of the windows that were started without their command, because the user didn't
+	// trust it. See TrustSettings.
+	untrustedWindows []string
+	// diskUsage is the size in bytes of the worktree when it was last measured, see UpdateDiskUsage. It's measured off
+	// the UI loop and read on it, hence atomic.
+	diskUsage atomic.Int64
 }
 
 // ToInstanceData converts an Instance to its serializable form
@@ -77,9 +154,21 @@ func (i *Instance) ToInstanceData() InstanceData {
 		UpdatedAt: time.Now(),
 		Program:   i.Program,
 		AutoYes:   i.AutoYes,
+		Prompt:    i.Prompt,
+		Group:     i.Group,
+		Adopt:     i.Adopt,
+		Tags:      i.Tags,
+		Project:   i.Project,
+		History:   i.History,
+	}
+	for _, window := range i.Windows {
+		data.Windows = append(data.Windows, WindowData{Name: window.Name, Command: window.Command})
 	}
 
-	// Only include worktree data if gitWorktree is initialized
+	// Only include worktree data if gitWorktree is initialized. Pending instances keep the base ref to start from and
+	// the directories to check out.
+	data.Worktree.BaseRef = i.BaseRef
+	data.Worktree.Sparse = i.Sparse
 	if i.gitWorktree != nil {
 		data.Worktree = GitWorktreeData{
 			RepoPath:      i.gitWorktree.GetRepoPath(),
@@ -87,6 +176,11 @@ func (i *Instance) ToInstanceData() InstanceData {
 			SessionName:   i.Title,
 			BranchName:    i.gitWorktree.GetBranchName(),
 			BaseCommitSHA: i.gitWorktree.GetBaseCommitSHA(),
+			BaseRef:       i.gitWorktree.GetBaseRef(),
+			Adopted:       i.gitWorktree.IsAdopted(),
+			Sparse:        i.gitWorktree.GetSparse(),
+			SetupStrategy: i.gitWorktree.GetSetup().Strategy,
+			SetupMillis:   i.gitWorktree.GetSetup().Duration.Milliseconds(),
 		}
 	}
 
@@ -114,12 +208,23 @@ func FromInstanceData(data InstanceData) (*Instance, error) {
 		CreatedAt: data.CreatedAt,
 		UpdatedAt: data.UpdatedAt,
 		Program:   data.Program,
+		Prompt:    data.Prompt,
+		Group:     data.Group,
+		BaseRef:   data.Worktree.BaseRef,
+		Adopt:     data.Adopt,
+		Sparse:    data.Worktree.Sparse,
+		Tags:      data.Tags,
+		Project:   data.Project,
+		History:   data.History,
 		gitWorktree: git.NewGitWorktreeFromStorage(
 			data.Worktree.RepoPath,
 			data.Worktree.WorktreePath,
 			data.Worktree.SessionName,
 			data.Worktree.BranchName,
 			data.Worktree.BaseCommitSHA,
+			data.Worktree.BaseRef,
+			data.Worktree.Adopted,
+			data.Worktree.Sparse,
 		),
 		diffStats: &git.DiffStats{
 			Added:   data.DiffStats.Added,
@@ -127,14 +232,27 @@ func FromInstanceData(data InstanceData) (*Instance, error) {
 			Content: data.DiffStats.Content,
 		},
 	}
+	instance.gitWorktree.SetSetup(git.SetupReport{
+		Strategy: data.Worktree.SetupStrategy,
+		Duration: time.Duration(data.Worktree.SetupMillis) * time.Millisecond,
+	})
+	for _, window := range data.Windows {
+		instance.Windows = append(instance.Windows, tmux.Window{Name: window.Name, Command: window.Command})
+	}
 
-	if instance.Paused() {
+	if instance.Pending() {
+		// Pending instances are started once there's room for them.
+		instance.gitWorktree = nil
+		instance.diffStats = nil
+	} else if instance.Paused() {
 		instance.started = true
-		instance.tmuxSession = tmux.NewTmuxSession(instance.Title, instance.Program)
-	} else {
-		if err := instance.Start(false); err != nil {
-			return nil, err
-		}
+		instance.tmuxSession = tmux.NewTmuxSession(instance.Title, instance.Program, data.Worktree.RepoPath)
+	} else if err := instance.Start(false); err != nil {
+		// One broken session shouldn't keep the others from loading. The instance is kept as exited, so the agent
+		// can be restarted in its worktree or the instance killed.
+		log.WarningLog.Printf("failed to restore instance %s: %v", instance.Title, err)
+		instance.started = true
+		instance.SetStatus(Exited)
 	}
 
 	return instance, nil
@@ -150,6 +268,12 @@ type InstanceOptions struct {
 	Program string
 	// If AutoYes is true, then
 	AutoYes bool
+	// BaseRef is the ref to create the instance's branch from. The configured default, or the repo's HEAD, if empty.
+	BaseRef string
+	// Adopt is an existing branch or pull request to work on instead of creating a branch.
+	Adopt string
+	// Sparse are directories, or names of the repo's sparse profiles, to check out instead of the whole repo.
+	Sparse []string
 }
 
 func NewInstance(opts InstanceOptions) (*Instance, error) {
@@ -166,6 +290,9 @@ func NewInstance(opts InstanceOptions) (*Instance, error) {
 		Status:    Ready,
 		Path:      absPath,
 		Program:   opts.Program,
+		BaseRef:   opts.BaseRef,
+		Adopt:     opts.Adopt,
+		Sparse:    opts.Sparse,
 		Height:    0,
 		Width:     0,
 		CreatedAt: t,
@@ -191,32 +318,62 @@ func (i *Instance) Start(firstTimeSetup bool) error {
 		return fmt.Errorf("instance title cannot be empty")
 	}
 
-	tmuxSession := tmux.NewTmuxSession(i.Title, i.Program)
-	i.tmuxSession = tmuxSession
-
+	var settings *config.RepoSettings
 	if firstTimeSetup {
-		gitWorktree, branchName, err := git.NewGitWorktree(i.Path, i.Title)
+		if err := rotateLogs(i.Title); err != nil {
+			log.WarningLog.Printf("could not rotate the logs of an earlier session named %s: %v", i.Title, err)
+		}
+		var gitWorktree *git.GitWorktree
+		var branchName string
+		var err error
+		if i.Adopt != "" {
+			gitWorktree, branchName, err = git.NewGitWorktreeFromExisting(i.Path, i.Title, i.Adopt)
+		} else {
+			gitWorktree, branchName, err = git.NewGitWorktree(i.Path, i.Title, i.BaseRef)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to create git worktree: %w", err)
 		}
 		i.gitWorktree = gitWorktree
 		i.Branch = branchName
+		i.BaseRef = gitWorktree.GetBaseRef()
+
+		settings = i.repoSettings()
+		for _, window := range settings.Windows {
+			i.Windows = append(i.Windows, tmux.Window{Name: window.Name, Command: window.Command})
+		}
+		// Profiles are resolved once, so the instance keeps its directories when it's resumed, even if the profile
+		// changes.
+		sparse, err := settings.Worktree.ResolveSparse(i.Sparse)
+		if err != nil {
+			return fmt.Errorf("failed to resolve sparse checkout: %w", err)
+		}
+		gitWorktree.SetSparse(sparse)
+		i.Sparse = sparse
 	}
 
-	// Setup error handler to cleanup resources on any error
+	tmuxSession := tmux.NewTmuxSession(i.Title, i.Program, i.gitWorktree.GetRepoPath())
+	i.tmuxSession = tmuxSession
+
+	// Setup error handler to cleanup resources on any error. An instance loaded from storage keeps its worktree and
+	// branch, its work isn't lost with its tmux session.
 	var setupErr error
 	defer func() {
-		if setupErr != nil {
+		if setupErr == nil {
+			i.started = true
+		} else if firstTimeSetup {
 			if cleanupErr := i.Kill(); cleanupErr != nil {
 				setupErr = fmt.Errorf("%v (cleanup error: %v)", setupErr, cleanupErr)
 			}
-		} else {
-			i.started = true
 		}
 	}()
 
 	if !firstTimeSetup {
 		// Reuse existing session
+		if !tmuxSession.DoesSessionExist() {
+			setupErr = fmt.Errorf("tmux session is gone")
+			return setupErr
+		}
 		if err := tmuxSession.Restore(); err != nil {
 			setupErr = fmt.Errorf("failed to restore existing session: %w", err)
 			return setupErr
@@ -227,6 +384,7 @@ func (i *Instance) Start(firstTimeSetup bool) error {
 			setupErr = fmt.Errorf("failed to setup git worktree: %w", err)
 			return setupErr
 		}
+		i.prepareWorktree(settings)
 
 		// Create new session
 		if err := i.tmuxSession.Start(i.gitWorktree.GetWorktreePath()); err != nil {
@@ -239,11 +397,35 @@ func (i *Instance) Start(firstTimeSetup bool) error {
 		}
 	}
 
+	i.startWindows()
 	i.SetStatus(Running)
 
 	return nil
 }
 
+// startWindows starts the windows that aren't running yet. They're auxiliary, so the agent keeps running if they fail.
+func (i *Instance) startWindows() {
+	if err := i.tmuxSession.StartWindows(i.trustedWindows(), i.gitWorktree.GetWorktreePath()); err != nil {
+		log.WarningLog.Printf("failed to start windows of %s: %v", i.Title, err)
+	}
+}
+
+// CheckKillable returns an error if the instance's branch is checked out in the repo, since killing the instance
+// deletes the branch. Pending instances don't have a branch yet.
+func (i *Instance) CheckKillable() error {
+	if !i.started {
+		return nil
+	}
+	checkedOut, err := i.gitWorktree.IsBranchCheckedOut()
+	if err != nil {
+		return err
+	}
+	if checkedOut {
+		return fmt.Errorf("instance %s is currently checked out", i.Title)
+	}
+	return nil
+}
+
 // Kill terminates the instance and cleans up all resources
 func (i *Instance) Kill() error {
 	if !i.started {
@@ -251,11 +433,18 @@ func (i *Instance) Kill() error {
 		return nil
 	}
 
+	if i.gitWorktree != nil {
+		_ = i.runHooks("pre_kill", i.hooks().PreKill)
+	}
+
 	var errs []error
 
 	// Always try to cleanup both resources, even if one fails
 	// Clean up tmux session first since it's using the git worktree
 	if i.tmuxSession != nil {
+		if err := i.SaveTranscript("killed"); err != nil {
+			log.WarningLog.Printf("failed to save transcript of %s: %v", i.Title, err)
+		}
 		if err := i.tmuxSession.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("failed to close tmux session: %w", err))
 		}
@@ -302,28 +491,81 @@ func (i *Instance) Preview() (string, error) {
 	return i.tmuxSession.CapturePaneContent()
 }
 
-func (i *Instance) HasUpdated() (updated bool, hasPrompt bool) {
-	if !i.started {
-		return false, false
+// UpdateStatus checks what the agent is doing and sets the status accordingly. If it's awaiting approval and AutoYes
+// is enabled, the prompt is approved and the agent is considered working. It returns true if the status changed.
+func (i *Instance) UpdateStatus() bool {
+	if !i.started || i.Paused() {
+		return false
+	}
+
+	var status Status
+	switch i.tmuxSession.State() {
+	case tmux.PaneWorking:
+		status = Running
+	case tmux.PaneIdle:
+		status = Ready
+	case tmux.PaneAwaitingApproval:
+		status = AwaitingApproval
+		if i.AutoYes {
+			if err := i.tmuxSession.Approve(); err != nil {
+				log.ErrorLog.Printf("error approving prompt: %v", err)
+			} else {
+				status = Running
+			}
+		}
+	case tmux.PaneRateLimited:
+		status = RateLimited
+	case tmux.PaneErrored:
+		status = Errored
+	case tmux.PaneExited:
+		status = Exited
 	}
-	return i.tmuxSession.HasUpdated()
+
+	changed := status != i.Status
+	i.SetStatus(status)
+	return changed
 }
 
-// TapEnter sends an enter key press to the tmux session if AutoYes is enabled.
-func (i *Instance) TapEnter() {
-	if !i.started || !i.AutoYes {
-		return
+func (i *Instance) Attach() (chan tmux.AttachResult, error) {
+	if !i.started {
+		return nil, fmt.Errorf("cannot attach instance that has not been started")
 	}
-	if err := i.tmuxSession.TapEnter(); err != nil {
-		log.ErrorLog.Printf("error tapping enter: %v", err)
+	return i.tmuxSession.Attach()
+}
+
+// PreviewWindow returns the content of the auxiliary window name, or of the agent's window if name is empty.
+func (i *Instance) PreviewWindow(name string) (string, error) {
+	if name == "" || !i.started || i.Status == Paused {
+		return i.Preview()
 	}
+	return i.tmuxSession.CaptureWindowContent(name)
 }
 
-func (i *Instance) Attach() (chan struct{}, error) {
+// AttachWindow attaches to the auxiliary window name, or to the agent's window if name is empty.
+func (i *Instance) AttachWindow(name string) (chan tmux.AttachResult, error) {
+	if name == "" {
+		return i.Attach()
+	}
 	if !i.started {
 		return nil, fmt.Errorf("cannot attach instance that has not been started")
 	}
-	return i.tmuxSession.Attach()
+	return i.tmuxSession.AttachWindow(name)
+}
+
+// OpenShell adds a window running a shell in the worktree, unless the instance has a window named shell already. It
+// returns the name of the window.
+func (i *Instance) OpenShell() (string, error) {
+	const name = "shell"
+	if !i.started || i.Paused() {
+		return "", fmt.Errorf("can only open a shell in started instances that aren't paused")
+	}
+	if !slices.ContainsFunc(i.Windows, func(w tmux.Window) bool { return w.Name == name }) {
+		i.Windows = append(i.Windows, tmux.Window{Name: name})
+	}
+	if err := i.tmuxSession.StartWindows(i.trustedWindows(), i.gitWorktree.GetWorktreePath()); err != nil {
+		return "", fmt.Errorf("failed to open shell: %w", err)
+	}
+	return name, nil
 }
 
 func (i *Instance) SetPreviewSize(width, height int) error {
@@ -360,8 +602,21 @@ func (i *Instance) Paused() bool {
 	return i.Status == Paused
 }
 
+// Live returns true if the instance's agent is up, whatever it's doing: it's started, and neither paused nor exited.
+func (i *Instance) Live() bool {
+	return i.started && i.Status != Paused && i.Status != Exited
+}
+
+// Pending returns true if the instance is waiting for room under the limits to be started.
+func (i *Instance) Pending() bool {
+	return i.Status == Pending
+}
+
 // TmuxAlive returns true if the tmux session is alive. This is a sanity check before attaching.
 func (i *Instance) TmuxAlive() bool {
+	if i.tmuxSession == nil {
+		return false
+	}
 	return i.tmuxSession.DoesSessionExist()
 }
 
@@ -374,6 +629,8 @@ func (i *Instance) Pause() error {
 		return fmt.Errorf("instance is already paused")
 	}
 
+	_ = i.runHooks("pre_pause", i.hooks().PrePause)
+
 	var errs []error
 
 	// Check if there are any changes to commit
@@ -391,6 +648,10 @@ func (i *Instance) Pause() error {
 		}
 	}
 
+	if err := i.SaveTranscript("paused"); err != nil {
+		log.WarningLog.Printf("failed to save transcript of %s: %v", i.Title, err)
+	}
+
 	// Close tmux session first since it's using the git worktree
 	if err := i.tmuxSession.Close(); err != nil {
 		errs = append(errs, fmt.Errorf("failed to close tmux session: %w", err))
@@ -426,6 +687,25 @@ func (i *Instance) Pause() error {
 	return nil
 }
 
+// Restart runs the agent again in the instance's worktree, e.g. after it exited or crashed. The worktree, branch and
+// prompt history are kept.
+func (i *Instance) Restart() error {
+	if !i.started || i.Paused() {
+		return fmt.Errorf("can only restart started instances that aren't paused")
+	}
+	worktreePath := i.gitWorktree.GetWorktreePath()
+	if _, err := os.Stat(worktreePath); err != nil {
+		return fmt.Errorf("failed to find worktree: %w", err)
+	}
+	if err := i.tmuxSession.Restart(worktreePath); err != nil {
+		return fmt.Errorf("failed to restart agent: %w", err)
+	}
+	// A new session was started if the old one was gone, without the windows.
+	i.startWindows()
+	i.SetStatus(Running)
+	return nil
+}
+
 // Resume recreates the worktree and restarts the tmux session
 func (i *Instance) Resume() error {
 	if !i.started {
@@ -448,6 +728,8 @@ func (i *Instance) Resume() error {
 		log.ErrorLog.Print(err)
 		return fmt.Errorf("failed to setup git worktree: %w", err)
 	}
+	// The worktree was removed when the instance was paused, along with what was copied into it.
+	i.prepareWorktree(i.repoSettings())
 
 	// Create new tmux session
 	if err := i.tmuxSession.Start(i.gitWorktree.GetWorktreePath()); err != nil {
@@ -460,6 +742,7 @@ func (i *Instance) Resume() error {
 		return fmt.Errorf("failed to start new session: %w", err)
 	}
 
+	i.startWindows()
 	i.SetStatus(Running)
 	return nil
 }
@@ -495,7 +778,15 @@ func (i *Instance) GetDiffStats() *git.DiffStats {
 	return i.diffStats
 }
 
-// SendPrompt sends a prompt to the tmux session
+// SendKeys types keys into the agent's pane as they are, e.g. "\x1b[A" for the up arrow.
+func (i *Instance) SendKeys(keys string) error {
+	if !i.started || i.Status == Paused {
+		return fmt.Errorf("cannot send keys to instance that has not been started or is paused")
+	}
+	return i.tmuxSession.SendKeys(keys)
+}
+
+// SendPrompt sends a prompt to the tmux session and records it in the history.
 func (i *Instance) SendPrompt(prompt string) error {
 	if !i.started {
 		return fmt.Errorf("instance not started")
@@ -503,15 +794,47 @@ func (i *Instance) SendPrompt(prompt string) error {
 	if i.tmuxSession == nil {
 		return fmt.Errorf("tmux session not initialized")
 	}
-	if err := i.tmuxSession.SendKeys(prompt); err != nil {
-		return fmt.Errorf("error sending keys to tmux session: %w", err)
+	if err := i.tmuxSession.SubmitPrompt(prompt); err != nil {
+		return err
+	}
+
+	i.recordPrompt(prompt)
+	return nil
+}
+
+// ApprovalPrompt returns what the agent asks to approve while it's awaiting approval, e.g. the command it wants to
+// run.
+func (i *Instance) ApprovalPrompt() string {
+	if !i.started || i.Status != AwaitingApproval {
+		return ""
 	}
+	return i.tmuxSession.ApprovalPrompt()
+}
 
-	// Brief pause to prevent carriage return from being interpreted as newline
-	time.Sleep(100 * time.Millisecond)
-	if err := i.tmuxSession.TapEnter(); err != nil {
-		return fmt.Errorf("error tapping enter: %w", err)
+// Approve answers the approval prompt the agent is waiting on with yes.
+func (i *Instance) Approve() error {
+	if !i.started || i.Status != AwaitingApproval {
+		return fmt.Errorf("instance is not awaiting approval")
+	}
+	if err := i.tmuxSession.Approve(); err != nil {
+		return err
 	}
+	i.SetStatus(Running)
+	return nil
+}
 
+// Deny answers the approval prompt the agent is waiting on with no. A non-empty message tells the agent what to do
+// instead and is recorded in the history.
+func (i *Instance) Deny(message string) error {
+	if !i.started || i.Status != AwaitingApproval {
+		return fmt.Errorf("instance is not awaiting approval")
+	}
+	if err := i.tmuxSession.Deny(message); err != nil {
+		return err
+	}
+	if message != "" {
+		i.recordPrompt(message)
+	}
+	i.SetStatus(Running)
 	return nil
 }
@@ -0,0 +1,112 @@
+package session
+
+import (
+	"agent-farmer/config"
+	"agent-farmer/session/git"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// ErrLimitReached is returned by CheckLimits when an instance can't be started without exceeding a limit.
+var ErrLimitReached = errors.New("limit reached")
+
+// DiskUsageInterval is how often long-running processes measure the worktrees, see UpdateDiskUsage.
+const DiskUsageInterval = 30 * time.Second
+
+// CheckLimits returns an error wrapping ErrLimitReached if starting candidate would exceed one of the limits. The
+// candidate may be a new instance or a paused one that is about to be resumed. Instances that haven't been started,
+// such as pending ones, don't count toward the limits. The worktrees' disk usage is the one last measured by
+// UpdateDiskUsage, so checking the limits doesn't touch the disk.
+func CheckLimits(limits config.InstanceLimits, candidate *Instance, instances []*Instance) error {
+	var repoPath string
+	if limits.MaxInstancesPerRepo > 0 {
+		var err error
+		repoPath, err = candidate.repoPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	var total, inRepo, running int
+	var usedBytes int64
+	for _, instance := range instances {
+		if instance == candidate || !instance.Started() {
+			continue
+		}
+		total++
+		if repoPath != "" && instance.gitWorktree.GetRepoPath() == repoPath {
+			inRepo++
+		}
+		if !instance.Paused() {
+			running++
+			usedBytes += instance.diskUsage.Load()
+		}
+	}
+
+	if limits.MaxInstances > 0 && total >= limits.MaxInstances {
+		return fmt.Errorf("%w: %d of %d instances in use", ErrLimitReached, total, limits.MaxInstances)
+	}
+	if limits.MaxInstancesPerRepo > 0 && inRepo >= limits.MaxInstancesPerRepo {
+		return fmt.Errorf("%w: %d of %d instances in use in %s", ErrLimitReached, inRepo,
+			limits.MaxInstancesPerRepo, filepath.Base(repoPath))
+	}
+	if limits.MaxRunning > 0 && running >= limits.MaxRunning {
+		return fmt.Errorf("%w: %d of %d instances running", ErrLimitReached, running, limits.MaxRunning)
+	}
+	if limits.MaxWorktreeDiskMB > 0 {
+		usedMB := usedBytes / (1 << 20)
+		if usedMB >= int64(limits.MaxWorktreeDiskMB) {
+			return fmt.Errorf("%w: worktrees use %dMB of %dMB", ErrLimitReached, usedMB, limits.MaxWorktreeDiskMB)
+		}
+	}
+	return nil
+}
+
+// repoPath returns the root of the repository the instance belongs to.
+func (i *Instance) repoPath() (string, error) {
+	if i.gitWorktree != nil {
+		return i.gitWorktree.GetRepoPath(), nil
+	}
+	return git.FindGitRepoRoot(i.Path)
+}
+
+// UpdateDiskUsage measures the worktrees of the started, unpaused instances if limits set a disk limit, see
+// Instance.UpdateDiskUsage.
+func UpdateDiskUsage(limits config.InstanceLimits, instances []*Instance) {
+	if limits.MaxWorktreeDiskMB <= 0 {
+		return
+	}
+	for _, instance := range instances {
+		if instance.Started() && !instance.Paused() {
+			instance.UpdateDiskUsage()
+		}
+	}
+}
+
+// UpdateDiskUsage measures the instance's worktree for the disk limit. It walks the whole worktree, so long-running
+// processes call it every DiskUsageInterval off the UI loop. Instances that were never measured, e.g. ones started
+// since, count as empty. The instance must be started.
+func (i *Instance) UpdateDiskUsage() {
+	i.diskUsage.Store(diskUsage(i.gitWorktree.GetWorktreePath()))
+}
+
+// diskUsage returns the total size in bytes of the files under dir. Files that can't be read are skipped, since the
+// worktree changes while we walk it.
+func diskUsage(dir string) int64 {
+	var total int64
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,79 @@
+package session
+
+import (
+	"agent-farmer/config"
+	"agent-farmer/session/git"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startedInstance returns an instance that looks started to CheckLimits without touching tmux or git.
+func startedInstance(title string, repoPath string, worktreePath string, status Status) *Instance {
+	return &Instance{
+		Title:       title,
+		Status:      status,
+		started:     true,
+		gitWorktree: git.NewGitWorktreeFromStorage(repoPath, worktreePath, title, "test/"+title, "", "", false, nil),
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	instances := []*Instance{
+		startedInstance("a", "/repo/one", "/nonexistent/a", Running),
+		startedInstance("b", "/repo/one", "/nonexistent/b", Paused),
+		startedInstance("c", "/repo/two", "/nonexistent/c", Ready),
+		{Title: "pending", Status: Pending},
+	}
+	// A paused instance in repo one that is about to be resumed.
+	candidate := startedInstance("d", "/repo/one", "/nonexistent/d", Paused)
+	instances = append(instances, candidate)
+
+	testCases := []struct {
+		name    string
+		limits  config.InstanceLimits
+		allowed bool
+	}{
+		{"no limits", config.InstanceLimits{}, true},
+		{"room for one more instance", config.InstanceLimits{MaxInstances: 4}, true},
+		{"pending instances don't count", config.InstanceLimits{MaxInstances: 3}, false},
+		{"room in repo", config.InstanceLimits{MaxInstancesPerRepo: 3}, true},
+		{"repo is full", config.InstanceLimits{MaxInstancesPerRepo: 2}, false},
+		{"paused instances aren't running", config.InstanceLimits{MaxRunning: 3}, true},
+		{"too many running", config.InstanceLimits{MaxRunning: 2}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckLimits(tc.limits, candidate, instances)
+			if tc.allowed {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrLimitReached)
+			}
+		})
+	}
+}
+
+func TestCheckLimitsDiskUsage(t *testing.T) {
+	worktree := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(worktree, "big"), make([]byte, 2<<20), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(worktree, "nested"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(worktree, "nested", "small"), make([]byte, 1<<20), 0644))
+
+	instances := []*Instance{
+		startedInstance("a", "/repo", worktree, Running),
+		// Paused instances have no worktree on disk, and their stale path must not be counted.
+		startedInstance("b", "/repo", worktree, Paused),
+	}
+	candidate := &Instance{Title: "new", Status: Ready}
+
+	// Nothing is measured unless there's a disk limit, and the limits are checked against the last measurement.
+	UpdateDiskUsage(config.InstanceLimits{}, instances)
+	require.NoError(t, CheckLimits(config.InstanceLimits{MaxWorktreeDiskMB: 1}, candidate, instances))
+	UpdateDiskUsage(config.InstanceLimits{MaxWorktreeDiskMB: 1}, instances)
+	require.NoError(t, CheckLimits(config.InstanceLimits{MaxWorktreeDiskMB: 4}, candidate, instances))
+	require.ErrorIs(t, CheckLimits(config.InstanceLimits{MaxWorktreeDiskMB: 3}, candidate, instances), ErrLimitReached)
+}
@@ -0,0 +1,160 @@
+package session
+
+import (
+	"agent-farmer/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotQueued is returned when no queued prompt has the requested title.
+var ErrNotQueued = errors.New("queued prompt not found")
+
+// QueuedPrompt is a prompt waiting in the queue for a session to be started with it.
+type QueuedPrompt struct {
+	// Title is the title of the session that will be started. It identifies the item in the queue.
+	Title string `json:"title"`
+	// Prompt is sent to the session once it starts.
+	Prompt string `json:"prompt"`
+	// Path is a path inside the repository to create the session's worktree from.
+	Path string `json:"path"`
+	// Program is the program to run. The default program is used if empty.
+	Program string `json:"program,omitempty"`
+	// AddedAt is the time the prompt was queued.
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Queue is a persistent FIFO of prompts that are turned into sessions as slots free up.
+type Queue struct {
+	state config.QueueStorage
+	items []QueuedPrompt
+}
+
+// NewQueue loads the queue from state.
+func NewQueue(state config.QueueStorage) (*Queue, error) {
+	var items []QueuedPrompt
+	if err := json.Unmarshal(state.GetQueue(), &items); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal queue: %w", err)
+	}
+	return &Queue{state: state, items: items}, nil
+}
+
+// Items returns the queued prompts, oldest first.
+func (q *Queue) Items() []QueuedPrompt {
+	return q.items
+}
+
+// Add appends prompts to the queue and saves it. Titles are made unique among the queue and the given instance
+// titles, so the returned items may have different titles than the ones passed in.
+func (q *Queue) Add(items []QueuedPrompt, instanceTitles []string) ([]QueuedPrompt, error) {
+	taken := append([]string{}, instanceTitles...)
+	for _, item := range q.items {
+		taken = append(taken, item.Title)
+	}
+
+	added := make([]QueuedPrompt, 0, len(items))
+	for _, item := range items {
+		if item.Title == "" {
+			return nil, fmt.Errorf("title cannot be empty")
+		}
+		if item.Prompt == "" {
+			return nil, fmt.Errorf("prompt cannot be empty")
+		}
+		item.Title = UniqueTitle(item.Title, taken)
+		if item.AddedAt.IsZero() {
+			item.AddedAt = time.Now()
+		}
+		taken = append(taken, item.Title)
+		added = append(added, item)
+	}
+
+	q.items = append(q.items, added...)
+	return added, q.save()
+}
+
+// Remove removes the prompt with the given title from the queue and saves it.
+func (q *Queue) Remove(title string) error {
+	for i, item := range q.items {
+		if item.Title == title {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return q.save()
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotQueued, title)
+}
+
+func (q *Queue) save() error {
+	data, err := json.Marshal(q.items)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue: %w", err)
+	}
+	return q.state.SaveQueue(data)
+}
+
+// Next takes the oldest queued prompt off the queue and returns an instance for it, if fewer than concurrency
+// instances are live and the limits leave room for it. The instance isn't started yet: the caller starts it, and sends
+// its Prompt once its program is up. It returns nil if nothing is queued or there's no room. A prompt that can't be
+// turned into an instance is dropped from the queue and reported in the returned error. program is used for prompts
+// that were queued without one.
+func (q *Queue) Next(concurrency int, limits config.InstanceLimits, program string, instances []*Instance) (*Instance, error) {
+	if len(q.items) == 0 {
+		return nil, nil
+	}
+	live := 0
+	for _, instance := range instances {
+		if instance.Live() {
+			live++
+		}
+	}
+	if live >= concurrency {
+		return nil, nil
+	}
+
+	item := q.items[0]
+	titles := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		titles = append(titles, instance.Title)
+	}
+	itemProgram := item.Program
+	if itemProgram == "" {
+		itemProgram = program
+	}
+	instance, err := NewInstance(InstanceOptions{
+		Title:   UniqueTitle(item.Title, titles),
+		Path:    item.Path,
+		Program: itemProgram,
+	})
+	if err == nil {
+		instance.Prompt = item.Prompt
+		err = CheckLimits(limits, instance, instances)
+		if errors.Is(err, ErrLimitReached) {
+			// Wait for room rather than piling up pending instances.
+			return nil, nil
+		}
+	}
+
+	q.items = q.items[1:]
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to start queued prompt %s: %w", item.Title, err), q.save())
+	}
+	return instance, q.save()
+}
+
+// UniqueTitle returns title, or title with a numeric suffix if it's already taken.
+func UniqueTitle(title string, taken []string) string {
+	isTaken := func(t string) bool {
+		for _, other := range taken {
+			if other == t {
+				return true
+			}
+		}
+		return false
+	}
+
+	unique := title
+	for n := 2; isTaken(unique); n++ {
+		unique = fmt.Sprintf("%s-%d", title, n)
+	}
+	return unique
+}
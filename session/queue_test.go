@@ -0,0 +1,110 @@
+package session
+
+import (
+	"agent-farmer/config"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueAddAndRemove(t *testing.T) {
+	state := &memoryState{}
+	queue, err := NewQueue(state)
+	require.NoError(t, err)
+	require.Empty(t, queue.Items())
+
+	added, err := queue.Add([]QueuedPrompt{
+		{Title: "fix-tests", Prompt: "fix the tests", Path: "/repo"},
+		{Title: "fix-tests", Prompt: "fix the other tests", Path: "/repo"},
+		{Title: "running", Prompt: "collides with an instance", Path: "/repo"},
+	}, []string{"running"})
+	require.NoError(t, err)
+	require.Equal(t, "fix-tests", added[0].Title)
+	require.Equal(t, "fix-tests-2", added[1].Title)
+	require.Equal(t, "running-2", added[2].Title)
+	require.False(t, added[0].AddedAt.IsZero())
+
+	_, err = queue.Add([]QueuedPrompt{{Title: "empty", Path: "/repo"}}, nil)
+	require.Error(t, err)
+
+	// The queue survives a reload.
+	reloaded, err := NewQueue(state)
+	require.NoError(t, err)
+	require.Len(t, reloaded.Items(), 3)
+	for i, item := range queue.Items() {
+		require.Equal(t, item.Title, reloaded.Items()[i].Title)
+		require.Equal(t, item.Prompt, reloaded.Items()[i].Prompt)
+	}
+
+	require.NoError(t, reloaded.Remove("fix-tests-2"))
+	require.Error(t, reloaded.Remove("fix-tests-2"))
+	require.Len(t, reloaded.Items(), 2)
+	require.Equal(t, "running-2", reloaded.Items()[1].Title)
+}
+
+func TestQueueNextWaitsForFreeSlot(t *testing.T) {
+	state := &memoryState{}
+	queue, err := NewQueue(state)
+	require.NoError(t, err)
+	_, err = queue.Add([]QueuedPrompt{{Title: "busy", Prompt: "do the next thing", Path: "/nonexistent"}}, nil)
+	require.NoError(t, err)
+
+	instances := []*Instance{
+		startedInstance("busy", "/repo", "/nonexistent/busy", Running),
+		startedInstance("idle", "/repo", "/nonexistent/idle", Ready),
+		{Title: "pending", Status: Pending},
+	}
+
+	// Idle instances count too, so there's no free slot.
+	next, err := queue.Next(2, config.InstanceLimits{}, "claude", instances)
+	require.NoError(t, err)
+	require.Nil(t, next)
+	require.Len(t, queue.Items(), 1)
+
+	// The limits are checked before starting. The queued prompt waits rather than becoming a pending instance.
+	next, err = queue.Next(3, config.InstanceLimits{MaxInstances: 2}, "claude", instances)
+	require.NoError(t, err)
+	require.Nil(t, next)
+	require.Len(t, queue.Items(), 1)
+
+	// The caller starts the instance and sends it the prompt.
+	next, err = queue.Next(3, config.InstanceLimits{}, "claude", instances)
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	require.False(t, next.Started())
+	require.Equal(t, "busy-2", next.Title)
+	require.Equal(t, "claude", next.Program)
+	require.Equal(t, "do the next thing", next.Prompt)
+	require.Empty(t, queue.Items())
+}
+
+func TestQueueNextCountsLiveInstances(t *testing.T) {
+	var instances []*Instance
+	for _, status := range []Status{Running, Ready, Loading, AwaitingApproval, RateLimited, Errored} {
+		instances = append(instances, startedInstance(status.String(), "/repo", "/nonexistent/"+status.String(), status))
+	}
+	live := len(instances)
+	instances = append(instances,
+		startedInstance("paused", "/repo", "/nonexistent/paused", Paused),
+		startedInstance("exited", "/repo", "/nonexistent/exited", Exited),
+		&Instance{Title: "pending", Status: Pending},
+	)
+
+	queue, err := NewQueue(&memoryState{})
+	require.NoError(t, err)
+	_, err = queue.Add([]QueuedPrompt{{Title: "next", Prompt: "do the next thing", Path: "/nonexistent"}}, nil)
+	require.NoError(t, err)
+
+	next, err := queue.Next(live, config.InstanceLimits{}, "claude", instances)
+	require.NoError(t, err)
+	require.Nil(t, next)
+	next, err = queue.Next(live+1, config.InstanceLimits{}, "claude", instances)
+	require.NoError(t, err)
+	require.NotNil(t, next)
+}
+
+func TestUniqueTitle(t *testing.T) {
+	require.Equal(t, "a", UniqueTitle("a", nil))
+	require.Equal(t, "a-2", UniqueTitle("a", []string{"a"}))
+	require.Equal(t, "a-3", UniqueTitle("a", []string{"a", "a-2"}))
+}
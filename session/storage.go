@@ -2,6 +2,7 @@ package session
 
 import (
 	"agent-farmer/config"
+	"agent-farmer/session/git"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -18,6 +19,21 @@ type InstanceData struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	AutoYes   bool      `json:"auto_yes"`
+	// Prompt is the initial prompt. Pending instances send it once they start.
+	Prompt string `json:"prompt,omitempty"`
+	// Group is the fan-out group of the instance.
+	Group string `json:"group,omitempty"`
+	// Adopt is the existing branch or pull request the instance works on. Pending instances check it out once they
+	// start.
+	Adopt string `json:"adopt,omitempty"`
+	// Tags are the labels of the instance.
+	Tags []string `json:"tags,omitempty"`
+	// Project is the group the user put the instance in.
+	Project string `json:"project,omitempty"`
+	// History is every prompt sent to the instance, oldest first.
+	History []HistoryEntry `json:"history,omitempty"`
+	// Windows are the auxiliary tmux windows of the instance.
+	Windows []WindowData `json:"windows,omitempty"`
 
 	Program   string          `json:"program"`
 	Worktree  GitWorktreeData `json:"worktree"`
@@ -31,6 +47,21 @@ type GitWorktreeData struct {
 	SessionName   string `json:"session_name"`
 	BranchName    string `json:"branch_name"`
 	BaseCommitSHA string `json:"base_commit_sha"`
+	// BaseRef is the ref the branch was created from, e.g. "origin/main". Empty if it was the repo's HEAD.
+	BaseRef string `json:"base_ref,omitempty"`
+	// Adopted is true if the branch existed before the session. It's kept when the session is killed.
+	Adopted bool `json:"adopted,omitempty"`
+	// Sparse are the directories checked out instead of the whole repo.
+	Sparse []string `json:"sparse,omitempty"`
+	// SetupStrategy and SetupMillis are how the worktree was last set up, and how long it took.
+	SetupStrategy string `json:"setup_strategy,omitempty"`
+	SetupMillis   int64  `json:"setup_ms,omitempty"`
+}
+
+// WindowData represents the serializable data of an auxiliary tmux window
+type WindowData struct {
+	Name    string `json:"name"`
+	Command string `json:"command,omitempty"`
 }
 
 // DiffStatsData represents the serializable data of a DiffStats
@@ -40,6 +71,55 @@ type DiffStatsData struct {
 	Content string `json:"content"`
 }
 
+// Summary is a flat, machine-readable view of an instance. It's what the status commands and the control API report.
+type Summary struct {
+	Title         string    `json:"title"`
+	Status        string    `json:"status"`
+	Branch        string    `json:"branch"`
+	BaseRef       string    `json:"base_ref,omitempty"`
+	Sparse        []string  `json:"sparse,omitempty"`
+	Program       string    `json:"program"`
+	Group         string    `json:"group,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+	Project       string    `json:"project,omitempty"`
+	SetupStrategy string    `json:"setup_strategy,omitempty"`
+	SetupMillis   int64     `json:"setup_ms,omitempty"`
+	RepoPath      string    `json:"repo_path"`
+	WorktreePath  string    `json:"worktree_path"`
+	Added         int       `json:"added"`
+	Removed       int       `json:"removed"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Setup describes how the session's worktree was last set up, e.g. "reflink in 1.2s". It's empty if that's unknown.
+func (s Summary) Setup() string {
+	return git.SetupReport{Strategy: s.SetupStrategy, Duration: time.Duration(s.SetupMillis) * time.Millisecond}.String()
+}
+
+// Summary returns the summary of the serialized instance.
+func (d InstanceData) Summary() Summary {
+	return Summary{
+		Title:         d.Title,
+		Status:        d.Status.String(),
+		Branch:        d.Branch,
+		BaseRef:       d.Worktree.BaseRef,
+		Sparse:        d.Worktree.Sparse,
+		Program:       d.Program,
+		Group:         d.Group,
+		Tags:          d.Tags,
+		Project:       d.Project,
+		SetupStrategy: d.Worktree.SetupStrategy,
+		SetupMillis:   d.Worktree.SetupMillis,
+		RepoPath:      d.Worktree.RepoPath,
+		WorktreePath:  d.Worktree.WorktreePath,
+		Added:         d.DiffStats.Added,
+		Removed:       d.DiffStats.Removed,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+	}
+}
+
 // Storage handles saving and loading instances using the state interface
 type Storage struct {
 	state config.InstanceStorage
@@ -57,7 +137,7 @@ func (s *Storage) SaveInstances(instances []*Instance) error {
 	// Convert instances to InstanceData
 	data := make([]InstanceData, 0)
 	for _, instance := range instances {
-		if instance.Started() {
+		if instance.Started() || instance.Pending() {
 			data = append(data, instance.ToInstanceData())
 		}
 	}
@@ -92,6 +172,16 @@ func (s *Storage) LoadInstances() ([]*Instance, error) {
 	return instances, nil
 }
 
+// LoadInstanceData loads the serialized instances from disk without restoring them. Unlike LoadInstances, this
+// doesn't touch tmux or the worktrees, so it's safe to call while another process owns the sessions.
+func (s *Storage) LoadInstanceData() ([]InstanceData, error) {
+	var instancesData []InstanceData
+	if err := json.Unmarshal(s.state.GetInstances(), &instancesData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal instances: %w", err)
+	}
+	return instancesData, nil
+}
+
 // DeleteInstance removes an instance from storage
 func (s *Storage) DeleteInstance(title string) error {
 	instances, err := s.LoadInstances()
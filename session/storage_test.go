@@ -0,0 +1,69 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryState is an in-memory config.InstanceStorage and config.QueueStorage.
+type memoryState struct {
+	instances json.RawMessage
+	queue     json.RawMessage
+}
+
+func (m *memoryState) SaveQueue(queueJSON json.RawMessage) error {
+	m.queue = queueJSON
+	return nil
+}
+
+func (m *memoryState) GetQueue() json.RawMessage {
+	if m.queue == nil {
+		return json.RawMessage("[]")
+	}
+	return m.queue
+}
+
+func (m *memoryState) SaveInstances(instancesJSON json.RawMessage) error {
+	m.instances = instancesJSON
+	return nil
+}
+
+func (m *memoryState) GetInstances() json.RawMessage {
+	return m.instances
+}
+
+func (m *memoryState) DeleteAllInstances() error {
+	m.instances = json.RawMessage("[]")
+	return nil
+}
+
+func TestLoadInstanceDataDoesNotStartInstances(t *testing.T) {
+	// A running instance whose tmux session doesn't exist. LoadInstances would fail to restore it.
+	state := &memoryState{instances: json.RawMessage(`[{
+		"title": "does-not-exist",
+		"branch": "user/does-not-exist",
+		"status": 0,
+		"program": "claude",
+		"worktree": {"repo_path": "/nonexistent", "worktree_path": "/nonexistent/wt", "setup_strategy": "reflink", "setup_ms": 1234},
+		"diff_stats": {"added": 3, "removed": 1}
+	}]`)}
+	storage, err := NewStorage(state)
+	require.NoError(t, err)
+
+	data, err := storage.LoadInstanceData()
+	require.NoError(t, err)
+	require.Len(t, data, 1)
+	require.Equal(t, "does-not-exist", data[0].Title)
+	require.Equal(t, Running, data[0].Status)
+	require.Equal(t, "/nonexistent/wt", data[0].Worktree.WorktreePath)
+	require.Equal(t, 3, data[0].DiffStats.Added)
+	require.Equal(t, "running", data[0].Status.String())
+	require.Equal(t, "reflink in 1.234s", data[0].Summary().Setup())
+	// The setup report survives loading and saving the instance. Paused instances load without tmux.
+	data[0].Status = Paused
+	instance, err := FromInstanceData(data[0])
+	require.NoError(t, err)
+	require.Equal(t, "reflink in 1.234s", instance.ToInstanceData().Summary().Setup())
+}
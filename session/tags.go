@@ -0,0 +1,63 @@
+package session
+
+import (
+	"strings"
+)
+
+// ParseTags splits s on commas and whitespace into tags. Tags are lowercased, a leading # is dropped and duplicates
+// are removed, keeping the first occurrence.
+func ParseTags(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	var tags []string
+	for _, field := range fields {
+		tag := strings.ToLower(strings.TrimPrefix(field, "#"))
+		if tag == "" || hasTag(tags, tag) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// SetTags replaces the tags of the instance. The tags are normalized like ParseTags does.
+func (i *Instance) SetTags(tags []string) {
+	i.Tags = ParseTags(strings.Join(tags, ","))
+}
+
+// AddTags adds tags the instance doesn't have yet.
+func (i *Instance) AddTags(tags []string) {
+	i.SetTags(append(append([]string{}, i.Tags...), tags...))
+}
+
+// RemoveTags removes the given tags from the instance.
+func (i *Instance) RemoveTags(tags []string) {
+	remove := ParseTags(strings.Join(tags, ","))
+	var kept []string
+	for _, tag := range i.Tags {
+		if !hasTag(remove, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	i.Tags = kept
+}
+
+// SetProject puts the instance in a project, or takes it out of its project if project is blank.
+func (i *Instance) SetProject(project string) {
+	i.Project = strings.TrimSpace(project)
+}
+
+// HasTag returns true if the instance has the given tag.
+func (i *Instance) HasTag(tag string) bool {
+	return hasTag(i.Tags, strings.ToLower(tag))
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
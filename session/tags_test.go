@@ -0,0 +1,27 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTags(t *testing.T) {
+	require.Equal(t, []string{"ui", "backend", "p1"}, ParseTags("UI, #backend  p1,ui,"))
+	require.Empty(t, ParseTags(" , "))
+
+	instance := &Instance{Title: "test"}
+	instance.SetTags([]string{"ui"})
+	instance.AddTags([]string{"Backend", "ui"})
+	require.Equal(t, []string{"ui", "backend"}, instance.Tags)
+	require.True(t, instance.HasTag("BACKEND"))
+
+	instance.RemoveTags([]string{"#ui", "missing"})
+	require.Equal(t, []string{"backend"}, instance.Tags)
+
+	instance.SetProject("  billing v2 ")
+	require.Equal(t, "billing v2", instance.Project)
+	require.Equal(t, "billing v2", instance.ToInstanceData().Summary().Project)
+	instance.SetProject(" ")
+	require.Empty(t, instance.Project)
+}
@@ -0,0 +1,91 @@
+package tmux
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxApprovalLines caps how far above the approval prompt its text is looked for.
+	maxApprovalLines = 30
+	// denyDelay is how long the program gets to leave the approval prompt before a message is typed after denying.
+	denyDelay = 300 * time.Millisecond
+)
+
+// optionLineRegex matches the options of an approval prompt, e.g. "❯ 1. Yes" or "▶ Yes   Always   No".
+var optionLineRegex = regexp.MustCompile(`^([❯●▶]\s*)?(\d+\.\s|Yes\b)`)
+
+// extractApproval returns what the approval prompt matching pattern in content asks to approve, e.g. the command the
+// program wants to run. Programs that draw the prompt in a box, like Claude Code, get the text in the box. Otherwise
+// it's the paragraph ending with the prompt and what follows it. The options to answer with are left out.
+func extractApproval(content string, pattern *regexp.Regexp) string {
+	lines := strings.Split(content, "\n")
+	end := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if pattern.MatchString(lines[i]) {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return ""
+	}
+
+	start := -1
+	for i := end; i >= 0 && i >= end-maxApprovalLines; i-- {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "╭") {
+			start = i + 1
+			lines = lines[:end+1]
+			break
+		}
+	}
+	if start == -1 {
+		start = end
+		for start > 0 && start > end-maxApprovalLines && approvalLine(lines[start-1]) != "" {
+			start--
+		}
+	}
+
+	var text []string
+	for _, line := range lines[start:] {
+		if line = approvalLine(line); line != "" && !optionLineRegex.MatchString(line) {
+			text = append(text, line)
+		}
+	}
+	return strings.Join(text, "\n")
+}
+
+// approvalLine returns line without the borders programs draw around approval prompts.
+func approvalLine(line string) string {
+	return strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "│▌"))
+}
+
+// ApprovalPrompt returns what the approval prompt found by the last call to State asks to approve. It's empty if there
+// was none.
+func (t *TmuxSession) ApprovalPrompt() string {
+	if t.monitor == nil || t.monitor.approval == nil {
+		return ""
+	}
+	return t.monitor.approvalText
+}
+
+// Deny answers the approval prompt found by the last call to State with no. A non-empty message is submitted
+// afterwards, to tell the program what to do instead. It does nothing if there was no prompt.
+func (t *TmuxSession) Deny(message string) error {
+	approval := t.monitor.approval
+	if approval == nil {
+		return nil
+	}
+	t.monitor.approval = nil
+	if err := t.SendKeys(approval.denyKeys); err != nil {
+		return fmt.Errorf("error denying approval prompt: %w", err)
+	}
+	if message == "" {
+		return nil
+	}
+	// Typed right after the escape, the message would be taken for alt and a key.
+	time.Sleep(denyDelay)
+	return t.SubmitPrompt(message)
+}
@@ -0,0 +1,31 @@
+package tmux
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractApproval(t *testing.T) {
+	tests := map[string]string{
+		ProgramClaude: "Bash command\ngo test ./session/... -run TestStorage -count=50\n" +
+			"Run the storage test 50 times to check it's not flaky\nDo you want to proceed?",
+		ProgramAider: "session/storage.go\nAdd file to the chat? (Y)es/(N)o/(D)on't ask again [Yes]:",
+		"codex":      "Allow command?\n$ go test ./session/... -run TestStorage -count=50",
+		"gemini": "?  Shell go test ./session/... -run TestStorage -count=50\n" +
+			"go test ./session/... -run TestStorage -count=50\nAllow execution?",
+	}
+	for program, want := range tests {
+		t.Run(program, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", program+"_approval.txt"))
+			require.NoError(t, err)
+			profile := profileFor(program)
+			require.NotNil(t, profile)
+			_, approval := classify(profile, string(content), false)
+			require.NotNil(t, approval)
+			require.Equal(t, want, extractApproval(string(content), approval.pattern))
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package tmux
+
+import (
+	"agent-farmer/log"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+	"golang.org/x/term"
+)
+
+const (
+	// DefaultDetachKey detaches from an attached session.
+	DefaultDetachKey = "ctrl-q"
+	// DefaultPaletteKey opens the palette while attached.
+	DefaultPaletteKey = "ctrl-]"
+	// noPaletteKey disables the palette.
+	noPaletteKey = "none"
+	// maxPalettePrompts is how many saved prompts the palette offers, one per digit.
+	maxPalettePrompts = 9
+)
+
+// AttachAction is what the user chose to do when an attached session returns.
+type AttachAction int
+
+const (
+	// AttachDetach goes back to the session list.
+	AttachDetach AttachAction = iota
+	// AttachNext switches to the next session.
+	AttachNext
+	// AttachPrevious switches to the previous session.
+	AttachPrevious
+	// AttachSendPrompt sends the saved prompt AttachResult.Prompt to the session.
+	AttachSendPrompt
+	// AttachToggleAutoYes toggles auto-yes of the session.
+	AttachToggleAutoYes
+	// AttachPause pauses the session.
+	AttachPause
+)
+
+// AttachResult is sent when an attached session returns, to tell why.
+type AttachResult struct {
+	Action AttachAction
+	// Prompt is the index of the saved prompt for AttachSendPrompt.
+	Prompt int
+}
+
+// attachKeys are the keys handled while attached, as the bytes the terminal sends for them.
+type attachKeys struct {
+	detach     byte
+	detachName string
+	// palette is 0 if the palette is disabled.
+	palette     byte
+	paletteName string
+	prompts     []string
+}
+
+var (
+	attachMu   sync.RWMutex
+	attachConf = attachKeys{detach: 0x11, detachName: DefaultDetachKey, palette: 0x1d, paletteName: DefaultPaletteKey}
+)
+
+// ConfigureAttach sets the keys that detach and open the palette while attached, e.g. "ctrl-q", and the prompts the
+// palette can send. Empty keys select the defaults, a palette key of "none" disables the palette.
+func ConfigureAttach(detachKey string, paletteKey string, prompts []string) error {
+	if detachKey == "" {
+		detachKey = DefaultDetachKey
+	}
+	if paletteKey == "" {
+		paletteKey = DefaultPaletteKey
+	}
+	keys := attachKeys{detachName: detachKey, paletteName: paletteKey, prompts: prompts}
+	var err error
+	if keys.detach, err = parseKey(detachKey); err != nil {
+		return fmt.Errorf("invalid detach key: %w", err)
+	}
+	if paletteKey != noPaletteKey {
+		if keys.palette, err = parseKey(paletteKey); err != nil {
+			return fmt.Errorf("invalid palette key: %w", err)
+		}
+		if keys.palette == keys.detach {
+			return fmt.Errorf("the palette key and the detach key are both %s", detachKey)
+		}
+	}
+
+	attachMu.Lock()
+	defer attachMu.Unlock()
+	attachConf = keys
+	return nil
+}
+
+// DetachKeyName returns the configured detach key, e.g. "ctrl-q".
+func DetachKeyName() string {
+	return currentAttachKeys().detachName
+}
+
+// DetachKey returns the byte the terminal sends for the configured detach key.
+func DetachKey() byte {
+	return currentAttachKeys().detach
+}
+
+// PaletteKeyName returns the configured palette key, or "" if the palette is disabled.
+func PaletteKeyName() string {
+	keys := currentAttachKeys()
+	if keys.palette == 0 {
+		return ""
+	}
+	return keys.paletteName
+}
+
+func currentAttachKeys() attachKeys {
+	attachMu.RLock()
+	defer attachMu.RUnlock()
+	return attachConf
+}
+
+// parseKey returns the byte the terminal sends for a control key, e.g. "ctrl-q" or "C-q".
+func parseKey(name string) (byte, error) {
+	lower := strings.ToLower(name)
+	var key string
+	if k, ok := strings.CutPrefix(lower, "ctrl-"); ok {
+		key = k
+	} else if k, ok := strings.CutPrefix(lower, "c-"); ok {
+		key = k
+	} else {
+		return 0, fmt.Errorf("%q isn't a control key, e.g. ctrl-q", name)
+	}
+	if len(key) != 1 {
+		return 0, fmt.Errorf("%q isn't a control key, e.g. ctrl-q", name)
+	}
+	switch c := key[0]; {
+	case c == 'i' || c == 'm' || c == '[':
+		// They send the same bytes as tab, enter and escape.
+		return 0, fmt.Errorf("%s can't be told apart from tab, enter or escape", name)
+	case c >= 'a' && c <= 'z':
+		return c - 'a' + 1, nil
+	case c == '\\' || c == ']' || c == '^' || c == '_':
+		return c ^ 0x40, nil
+	default:
+		return 0, fmt.Errorf("%q isn't a control key, e.g. ctrl-q", name)
+	}
+}
+
+// paletteLines returns the lines of the palette.
+func (k attachKeys) paletteLines() []string {
+	lines := []string{"n next  p previous  a toggle auto-yes  c pause  d detach  esc close"}
+	for i, prompt := range k.prompts[:min(len(k.prompts), maxPalettePrompts)] {
+		firstLine, _, _ := strings.Cut(prompt, "\n")
+		lines = append(lines, fmt.Sprintf("%d %s", i+1, firstLine))
+	}
+	return lines
+}
+
+// paletteAction returns what the key pressed in the palette does. It's false if the key only closes the palette.
+func (k attachKeys) paletteAction(key byte) (AttachResult, bool) {
+	switch key {
+	case 'n':
+		return AttachResult{Action: AttachNext}, true
+	case 'p':
+		return AttachResult{Action: AttachPrevious}, true
+	case 'a':
+		return AttachResult{Action: AttachToggleAutoYes}, true
+	case 'c':
+		return AttachResult{Action: AttachPause}, true
+	case 'd', k.detach:
+		return AttachResult{Action: AttachDetach}, true
+	}
+	if prompt := int(key) - '1'; prompt >= 0 && prompt < min(len(k.prompts), maxPalettePrompts) {
+		return AttachResult{Action: AttachSendPrompt, Prompt: prompt}, true
+	}
+	return AttachResult{}, false
+}
+
+// paletteRedrawDelay is how long the session's output has to pause before the palette is drawn over it again, so
+// it isn't drawn in the middle of an escape sequence.
+const paletteRedrawDelay = 20 * time.Millisecond
+
+// attachOutput writes the output of an attached session to the terminal, with the palette drawn over its bottom
+// lines while it's open.
+type attachOutput struct {
+	mu      sync.Mutex
+	out     io.Writer
+	palette []string
+	redraw  *time.Timer
+}
+
+func (o *attachOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n, err := o.out.Write(p)
+	if o.palette != nil {
+		if o.redraw != nil {
+			o.redraw.Stop()
+		}
+		o.redraw = time.AfterFunc(paletteRedrawDelay, func() {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			o.drawPalette()
+		})
+	}
+	return n, err
+}
+
+// showPalette opens the palette.
+func (o *attachOutput) showPalette(lines []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.palette = lines
+	o.drawPalette()
+}
+
+// hidePalette closes the palette. The session has to redraw the lines it covered.
+func (o *attachOutput) hidePalette() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.palette = nil
+	if o.redraw != nil {
+		o.redraw.Stop()
+	}
+}
+
+func (o *attachOutput) drawPalette() {
+	if o.palette == nil {
+		return
+	}
+	cols, rows, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil {
+		cols, rows = 80, 24
+	}
+	var b strings.Builder
+	// Save the cursor, draw the lines in reverse video and restore it, so the session's output continues where it was.
+	b.WriteString("\0337")
+	for i, line := range o.palette {
+		row := rows - len(o.palette) + i + 1
+		if row < 1 {
+			continue
+		}
+		line = ansi.Truncate(" "+line, cols, "…")
+		fmt.Fprintf(&b, "\033[%d;1H\033[0;7m%s%s", row, line, strings.Repeat(" ", max(0, cols-ansi.StringWidth(line))))
+	}
+	b.WriteString("\033[0m\0338")
+	if _, err := io.WriteString(o.out, b.String()); err != nil {
+		log.WarningLog.Printf("could not draw the palette: %v", err)
+	}
+}
+
+// refreshClients makes the clients attached to the session redraw, e.g. where the palette was.
+func (t *TmuxSession) refreshClients() {
+	output, err := t.cmdExec.Output(t.server.command("list-clients", "-F",
+		"#{client_control_mode} #{client_name} #{session_name}"))
+	if err != nil {
+		log.WarningLog.Printf("could not list clients of %s: %v", t.sanitizedName, err)
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] == "1" {
+			continue
+		}
+		client, session := fields[1], fields[2]
+		// Windows are attached through a session grouped with this one, see AttachWindow.
+		if session != t.sanitizedName && !strings.HasPrefix(session, t.sanitizedName+"~") {
+			continue
+		}
+		if err := t.cmdExec.Run(t.server.command("refresh-client", "-t", client)); err != nil {
+			log.WarningLog.Printf("could not refresh client %s: %v", client, err)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package tmux
+
+import (
+	"agent-farmer/log"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// controlSession is the session the control mode client attaches to. The windows of the agent sessions are linked
+// into it, since tmux only sends %output notifications for the panes of the attached session.
+const controlSession = "agentfarmer-control"
+
+var errControlClosed = errors.New("tmux control mode connection is closed")
+
+// Control is a tmux control mode client (tmux -C). A single connection is shared by all sessions on a server: tmux
+// commands go over it instead of spawning a process each, and its %output notifications tell which panes changed, so
+// panes without new output don't need to be captured again. It implements cmd.Executor, commands other than tmux
+// ones, and all commands once the connection is gone, are run as processes.
+type Control struct {
+	process *exec.Cmd
+	stdin   io.WriteCloser
+
+	// mu guards pending and closed. tmux answers commands in order, so replies go to the oldest pending command.
+	mu      sync.Mutex
+	pending []*pendingCommand
+	closed  bool
+
+	panesMu sync.Mutex
+	// panes are the watched panes by pane id.
+	panes map[string]*watchedPane
+}
+
+type watchedPane struct {
+	window string
+	// seq counts the %output notifications of the pane.
+	seq uint64
+}
+
+type controlReply struct {
+	output []byte
+	err    error
+}
+
+// pendingCommand is a command list waiting for its replies. tmux replies to each command of a list with a block of
+// its own, and skips the rest of the list once a command fails.
+type pendingCommand struct {
+	blocks int
+	output bytes.Buffer
+	reply  chan controlReply
+}
+
+var (
+	controlMu sync.Mutex
+	// controlEnabled is whether sessions use control mode, see EnableControlMode.
+	controlEnabled bool
+	// controls are the connections by server socket. It's nil for a server if connecting to it failed.
+	controls = make(map[string]*Control)
+)
+
+// EnableControlMode has sessions created afterwards use a control mode connection to their tmux server. A server's
+// connection is made when the first session on it is created. If it fails, the server's sessions fall back to
+// running tmux commands as processes.
+func EnableControlMode() {
+	controlMu.Lock()
+	defer controlMu.Unlock()
+	controlEnabled = true
+}
+
+// CloseControl disconnects the control mode connections and disables control mode. Existing sessions go back to
+// running tmux commands as processes.
+func CloseControl() {
+	controlMu.Lock()
+	closing := controls
+	controls = make(map[string]*Control)
+	controlEnabled = false
+	controlMu.Unlock()
+
+	for _, c := range closing {
+		if c == nil {
+			continue
+		}
+		if err := c.stdin.Close(); err != nil {
+			log.WarningLog.Printf("failed to close tmux control mode connection: %v", err)
+		}
+		_ = c.process.Wait()
+	}
+}
+
+// controlFor returns the control mode connection to s, or nil if control mode isn't used for it.
+func controlFor(s server) *Control {
+	controlMu.Lock()
+	defer controlMu.Unlock()
+	if !controlEnabled {
+		return nil
+	}
+	if c, ok := controls[s.socket]; ok {
+		return c
+	}
+	c, err := connectControl(s)
+	if err != nil {
+		log.WarningLog.Printf("tmux control mode disabled for server %s: %v", s.socket, err)
+	}
+	controls[s.socket] = c
+	return c
+}
+
+func connectControl(s server) (*Control, error) {
+	// The pane of the control session runs nothing, it's kept dead. The session is destroyed when the client
+	// disconnects, which also kills the windows of agent sessions that were killed in the meantime.
+	process := s.command("-C", "new-session", "-A", "-s", controlSession, "true",
+		";", "set-option", "-t", controlSession, "remain-on-exit", "on",
+		";", "set-option", "-t", controlSession, "destroy-unattached", "on")
+	stdin, err := process.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to tmux in control mode: %w", err)
+	}
+	stdout, err := process.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to tmux in control mode: %w", err)
+	}
+	if err := process.Start(); err != nil {
+		return nil, fmt.Errorf("failed to connect to tmux in control mode: %w", err)
+	}
+
+	c := newControl(stdin, stdout)
+	c.process = process
+	return c, nil
+}
+
+func newControl(stdin io.WriteCloser, stdout io.Reader) *Control {
+	c := &Control{stdin: stdin, panes: make(map[string]*watchedPane)}
+	go c.read(stdout)
+	return c
+}
+
+// Run runs cmd, see Output.
+func (c *Control) Run(cmd *exec.Cmd) error {
+	_, err := c.Output(cmd)
+	return err
+}
+
+// Output runs cmd over the connection if it's a tmux command, and as a process otherwise.
+func (c *Control) Output(cmd *exec.Cmd) ([]byte, error) {
+	if len(cmd.Args) < 2 || cmd.Args[0] != "tmux" {
+		return cmd.Output()
+	}
+	// The connection is to the session's server already.
+	output, err := c.command(withoutServerArgs(cmd.Args[1:])...)
+	if errors.Is(err, errControlClosed) {
+		return cmd.Output()
+	}
+	return output, err
+}
+
+// command sends a command, or a list of commands separated by ";" arguments, and waits for its reply.
+func (c *Control) command(args ...string) ([]byte, error) {
+	pending := &pendingCommand{blocks: 1, reply: make(chan controlReply, 1)}
+	for _, arg := range args {
+		if arg == ";" {
+			pending.blocks++
+		}
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errControlClosed
+	}
+	c.pending = append(c.pending, pending)
+	_, err := io.WriteString(c.stdin, quoteCommand(args)+"\n")
+	c.mu.Unlock()
+	if err != nil {
+		// The reply would never come, give up on the connection.
+		c.shutdown()
+	}
+
+	r := <-pending.reply
+	return r.output, r.err
+}
+
+// read handles the replies and notifications tmux sends until the connection closes.
+func (c *Control) read(stdout io.Reader) {
+	defer c.shutdown()
+
+	reader := bufio.NewReader(stdout)
+	// block is the output of the reply being read, nil between replies.
+	var block *bytes.Buffer
+	var begin []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				log.WarningLog.Printf("tmux control mode connection failed: %v", err)
+			}
+			return
+		}
+		line = strings.TrimSuffix(line, "\n")
+		fields := strings.Fields(line)
+
+		if block != nil {
+			// The end of a block repeats the time, number and flags of its beginning.
+			if len(fields) == 4 && (fields[0] == "%end" || fields[0] == "%error") && slices.Equal(fields[1:], begin) {
+				// Flags are 1 for commands sent by this client, other blocks answer the command it was started with.
+				if begin[2] == "1" {
+					c.reply(block.Bytes(), fields[0] == "%error")
+				}
+				block = nil
+				continue
+			}
+			block.WriteString(line)
+			block.WriteByte('\n')
+			continue
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "%begin":
+			if len(fields) == 4 {
+				block, begin = &bytes.Buffer{}, fields[1:]
+			}
+		case "%output":
+			if len(fields) >= 2 {
+				c.touch(fields[1])
+			}
+		case "%sessions-changed":
+			// Replies are read by this goroutine, so commands can't be sent from it.
+			go c.reap()
+		case "%exit":
+			return
+		}
+	}
+}
+
+func (c *Control) reply(output []byte, failed bool) {
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	pending := c.pending[0]
+	pending.blocks--
+	if pending.blocks > 0 && !failed {
+		pending.output.Write(output)
+		c.mu.Unlock()
+		return
+	}
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+
+	if failed {
+		pending.reply <- controlReply{err: fmt.Errorf("%s", strings.TrimSpace(string(output)))}
+		return
+	}
+	pending.output.Write(output)
+	pending.reply <- controlReply{output: pending.output.Bytes()}
+}
+
+// shutdown fails the pending commands, later ones are run as processes.
+func (c *Control) shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for _, pending := range c.pending {
+		pending.reply <- controlReply{err: errControlClosed}
+	}
+	c.pending = nil
+}
+
+// watch links the window of session into the control session, so the client receives the output of its pane. It
+// returns the id of the pane.
+func (c *Control) watch(session string) (string, error) {
+	output, err := c.command("display-message", "-p", "-t", fmt.Sprintf("=%s:", session), "#{window_id} #{pane_id}")
+	if err != nil {
+		return "", fmt.Errorf("failed to find pane of %s: %w", session, err)
+	}
+	window, pane, _ := strings.Cut(strings.TrimSpace(string(output)), " ")
+
+	c.panesMu.Lock()
+	if _, ok := c.panes[pane]; ok {
+		c.panesMu.Unlock()
+		return pane, nil
+	}
+	c.panes[pane] = &watchedPane{window: window}
+	c.panesMu.Unlock()
+
+	if _, err := c.command("link-window", "-d", "-s", window, "-t", fmt.Sprintf("=%s:", controlSession)); err != nil {
+		c.panesMu.Lock()
+		delete(c.panes, pane)
+		c.panesMu.Unlock()
+		return "", fmt.Errorf("failed to link window of %s: %w", session, err)
+	}
+	return pane, nil
+}
+
+// unwatch unlinks the window of pane from the control session, so the window goes away with its session.
+func (c *Control) unwatch(pane string) error {
+	c.panesMu.Lock()
+	watched, ok := c.panes[pane]
+	delete(c.panes, pane)
+	c.panesMu.Unlock()
+	if !ok {
+		return nil
+	}
+	_, err := c.command("unlink-window", "-t", fmt.Sprintf("=%s:%s", controlSession, watched.window))
+	return err
+}
+
+// reap kills the windows that are only left in the control session because their agent session was killed without
+// unwatching them first, e.g. with tmux kill-session.
+func (c *Control) reap() {
+	output, err := c.command("list-windows", "-t", "="+controlSession, "-F", "#{window_id} #{window_linked_sessions}")
+	if err != nil {
+		if !errors.Is(err, errControlClosed) {
+			log.WarningLog.Printf("failed to list windows of the tmux control session: %v", err)
+		}
+		return
+	}
+	orphans := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if window, sessions, ok := strings.Cut(line, " "); ok && sessions == "1" {
+			orphans[window] = true
+		}
+	}
+
+	for pane, watched := range c.watchedPanes() {
+		if !orphans[watched] {
+			continue
+		}
+		c.panesMu.Lock()
+		delete(c.panes, pane)
+		c.panesMu.Unlock()
+		if _, err := c.command("unlink-window", "-k", "-t", fmt.Sprintf("=%s:%s", controlSession, watched)); err != nil {
+			log.WarningLog.Printf("failed to kill orphaned window %s: %v", watched, err)
+		}
+	}
+}
+
+// watchedPanes returns the windows of the watched panes by pane id.
+func (c *Control) watchedPanes() map[string]string {
+	c.panesMu.Lock()
+	defer c.panesMu.Unlock()
+	windows := make(map[string]string, len(c.panes))
+	for pane, watched := range c.panes {
+		windows[pane] = watched.window
+	}
+	return windows
+}
+
+func (c *Control) touch(pane string) {
+	c.panesMu.Lock()
+	defer c.panesMu.Unlock()
+	if watched, ok := c.panes[pane]; ok {
+		watched.seq++
+	}
+}
+
+// outputSeq returns the number of %output notifications seen for pane. It returns false if the pane isn't watched or
+// the connection is gone, since then output can't be told from no output.
+func (c *Control) outputSeq(pane string) (uint64, bool) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return 0, false
+	}
+
+	c.panesMu.Lock()
+	defer c.panesMu.Unlock()
+	watched, ok := c.panes[pane]
+	if !ok {
+		return 0, false
+	}
+	return watched.seq, true
+}
+
+var bareWord = regexp.MustCompile(`^[A-Za-z0-9_@%=:./,+-]+$`)
+
+// quoteCommand quotes args for the tmux command parser. A ";" argument separates commands, as it does on the command
+// line.
+func quoteCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == ";" || bareWord.MatchString(arg) {
+			quoted[i] = arg
+			continue
+		}
+		arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`).Replace(arg)
+		quoted[i] = `"` + arg + `"`
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,106 @@
+package tmux
+
+import (
+	"agent-farmer/log"
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteCommand(t *testing.T) {
+	require.Equal(t, "has-session -t=agentfarmer_test", quoteCommand([]string{"has-session", "-t=agentfarmer_test"}))
+	require.Equal(t, `display-message -p "#{window_id} #{pane_id}"`,
+		quoteCommand([]string{"display-message", "-p", "#{window_id} #{pane_id}"}))
+	require.Equal(t, `new-session "aider --model \"x\" \$HOME\n"`,
+		quoteCommand([]string{"new-session", "aider --model \"x\" $HOME\n"}))
+	require.Equal(t, "new-window -d ; set-option -w remain-on-exit on",
+		quoteCommand([]string{"new-window", "-d", ";", "set-option", "-w", "remain-on-exit", "on"}))
+}
+
+func TestControl(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+
+	stdinReader, stdin := io.Pipe()
+	stdout, tmux := io.Pipe()
+	c := newControl(stdin, stdout)
+	commands := bufio.NewReader(stdinReader)
+
+	// reply answers the next command the way tmux does.
+	reply := func(number int, end string, lines ...string) string {
+		command, err := commands.ReadString('\n')
+		require.NoError(t, err)
+		output := fmt.Sprintf("%%begin 1 %d 1\n", number)
+		for _, line := range lines {
+			output += line + "\n"
+		}
+		_, err = io.WriteString(tmux, output+fmt.Sprintf("%%%s 1 %d 1\n", end, number))
+		require.NoError(t, err)
+		return strings.TrimSpace(command)
+	}
+
+	// The block of the command the client was started with isn't a reply.
+	go func() {
+		_, _ = io.WriteString(tmux, "%begin 1 1 0\n%end 1 1 0\n%session-changed $1 agentfarmer-control\n")
+	}()
+
+	done := make(chan string, 2)
+	go func() {
+		done <- reply(2, "end", "@1 %1")
+		done <- reply(3, "end")
+	}()
+	pane, err := c.watch("agentfarmer_test")
+	require.NoError(t, err)
+	require.Equal(t, "%1", pane)
+	require.Equal(t, `display-message -p -t =agentfarmer_test: "#{window_id} #{pane_id}"`, <-done)
+	require.Equal(t, "link-window -d -s @1 -t =agentfarmer-control:", <-done)
+
+	seq, ok := c.outputSeq(pane)
+	require.True(t, ok)
+	require.Zero(t, seq)
+
+	go func() {
+		_, _ = io.WriteString(tmux, "%output %1 hello\\015\\012\n%output %2 other\n")
+		done <- reply(4, "end", "%end 1 3 1", "hello")
+	}()
+	output, err := c.Output(exec.Command("tmux", "capture-pane", "-p", "-t", "agentfarmer_test"))
+	require.NoError(t, err)
+	// Lines that look like the end of another block are output.
+	require.Equal(t, "%end 1 3 1\nhello\n", string(output))
+	require.Equal(t, "capture-pane -p -t agentfarmer_test", <-done)
+	seq, _ = c.outputSeq(pane)
+	require.Equal(t, uint64(1), seq)
+
+	go func() {
+		done <- reply(5, "error", "can't find session: agentfarmer_gone")
+	}()
+	err = c.Run(exec.Command("tmux", "has-session", "-t=agentfarmer_gone"))
+	require.EqualError(t, err, "can't find session: agentfarmer_gone")
+	<-done
+
+	// Each command of a list gets a reply, until one fails.
+	go func() {
+		command, _ := commands.ReadString('\n')
+		_, _ = io.WriteString(tmux, "%begin 1 6 1\none\n%end 1 6 1\n%begin 1 7 1\ntwo\n%end 1 7 1\n")
+		done <- strings.TrimSpace(command)
+	}()
+	output, err = c.Output(exec.Command("tmux", "display-message", "-p", "one", ";", "display-message", "-p", "two"))
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\n", string(output))
+	require.Equal(t, "display-message -p one ; display-message -p two", <-done)
+
+	// Once tmux goes away, commands fail over to processes and output can't be relied on anymore.
+	require.NoError(t, tmux.Close())
+	require.Eventually(t, func() bool {
+		_, ok := c.outputSeq(pane)
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+	_, err = c.command("list-sessions")
+	require.ErrorIs(t, err, errControlClosed)
+}
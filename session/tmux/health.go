@@ -0,0 +1,59 @@
+package tmux
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PaneHealth is whether the program in a pane is still running.
+type PaneHealth int
+
+const (
+	// PaneAlive is when the program is running.
+	PaneAlive PaneHealth = iota
+	// PaneDead is when the program exited, e.g. because it crashed, and tmux kept the pane around.
+	PaneDead
+	// PaneAtShell is when the program exited back to the shell it was started from.
+	PaneAtShell
+	// PaneGone is when the tmux session no longer exists.
+	PaneGone
+)
+
+// shells are the commands a pane shows when the program exited back to a shell.
+var shells = map[string]bool{
+	"bash": true, "zsh": true, "fish": true, "sh": true, "dash": true, "ksh": true, "tcsh": true, "csh": true,
+	"nu": true,
+}
+
+// Health checks whether the program in the session's pane is still running.
+func (t *TmuxSession) Health() (PaneHealth, error) {
+	cmd := t.server.command("list-panes", "-s", fmt.Sprintf("-t=%s", t.sanitizedName), "-F",
+		"#{pane_dead} #{pane_current_command}")
+	output, err := t.cmdExec.Output(cmd)
+	if err != nil {
+		if !t.DoesSessionExist() {
+			return PaneGone, nil
+		}
+		return PaneAlive, fmt.Errorf("error listing panes of session '%s': %v", t.sanitizedName, err)
+	}
+	return paneHealth(string(output), t.program), nil
+}
+
+// paneHealth parses the output of list-panes for the pane running program.
+func paneHealth(output string, program string) PaneHealth {
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	dead, command, _ := strings.Cut(line, " ")
+	if dead == "1" {
+		return PaneDead
+	}
+	// A shell is only a sign the program exited if the program isn't a shell itself.
+	if !shells[command] {
+		return PaneAlive
+	}
+	if fields := strings.Fields(os.ExpandEnv(program)); len(fields) > 0 && shells[filepath.Base(fields[0])] {
+		return PaneAlive
+	}
+	return PaneAtShell
+}
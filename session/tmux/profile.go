@@ -0,0 +1,264 @@
+package tmux
+
+import (
+	"agent-farmer/config"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStartupTimeout = time.Second
+	defaultDenyKeys       = "\x1b"
+	defaultSubmitKeys     = "\r"
+	defaultSubmitDelay    = 100 * time.Millisecond
+)
+
+// BuiltinAgentProfiles returns the profiles of the agent programs agent-farmer knows about.
+func BuiltinAgentProfiles() []config.AgentProfile {
+	return []config.AgentProfile{
+		{
+			Name:     ProgramClaude,
+			Programs: []string{ProgramClaude},
+			StartupDialogs: []config.AgentDialog{
+				{Pattern: `Do you trust the files in this folder\?`, Keys: "\r"},
+			},
+			Approvals: []config.AgentDialog{
+				{Pattern: `No, and tell Claude what to do differently`, Keys: "\r"},
+			},
+			WorkingPatterns:   []string{`(?i)esc to interrupt`},
+			RateLimitPatterns: []string{`usage limit reached`, `API Error: 429`},
+			ErrorPatterns:     []string{`API Error`},
+		},
+		{
+			Name:     ProgramAider,
+			Programs: []string{ProgramAider},
+			StartupDialogs: []config.AgentDialog{
+				{Pattern: `Open documentation url for more info`, Keys: "D\r"},
+			},
+			// Aider takes longer to start.
+			StartupTimeoutMs: 2000,
+			Approvals: []config.AgentDialog{
+				{Pattern: `\(Y\)es/\(N\)o/\(D\)on't ask again`, Keys: "\r", DenyKeys: "n\r"},
+			},
+			RateLimitPatterns: []string{`RateLimitError`},
+			ErrorPatterns:     []string{`litellm\.\w+Error`},
+		},
+		{
+			Name:     "codex",
+			Programs: []string{"codex"},
+			StartupDialogs: []config.AgentDialog{
+				{Pattern: `allow Codex to work in this folder`, Keys: "\r"},
+			},
+			Approvals: []config.AgentDialog{
+				{Pattern: `Allow command\?|Would you like to (run the following command|make the following edits)\?`, Keys: "y"},
+			},
+			WorkingPatterns:   []string{`(?i)esc to interrupt`},
+			RateLimitPatterns: []string{`(?i)usage limit`, `(?i)rate limit reached`},
+			ErrorPatterns:     []string{`stream error`},
+		},
+		{
+			Name:     "gemini",
+			Programs: []string{"gemini"},
+			StartupDialogs: []config.AgentDialog{
+				{Pattern: `Do you trust this folder\?`, Keys: "\r"},
+			},
+			Approvals: []config.AgentDialog{
+				{Pattern: `Allow execution\?|Apply this change\?`, Keys: "\r"},
+			},
+			WorkingPatterns:   []string{`(?i)esc to cancel`},
+			RateLimitPatterns: []string{`(?i)quota exceeded`, `status 429`},
+			ErrorPatterns:     []string{`\[API Error`},
+		},
+	}
+}
+
+// agentProfile is a config.AgentProfile with its patterns compiled.
+type agentProfile struct {
+	name              string
+	programs          []string
+	startupDialogs    []agentDialog
+	startupTimeout    time.Duration
+	approvals         []agentDialog
+	workingPatterns   []*regexp.Regexp
+	idlePatterns      []*regexp.Regexp
+	rateLimitPatterns []*regexp.Regexp
+	errorPatterns     []*regexp.Regexp
+	submitKeys        string
+	submitDelay       time.Duration
+}
+
+type agentDialog struct {
+	pattern  *regexp.Regexp
+	keys     string
+	denyKeys string
+}
+
+var (
+	profilesMu sync.RWMutex
+	// profiles are checked in order, custom profiles come before the built-in ones.
+	profiles = mustCompileProfiles(BuiltinAgentProfiles())
+)
+
+// SetAgentProfiles puts the custom profiles ahead of the built-in ones. A custom profile replaces the built-in one
+// with the same name. It only affects sessions created afterwards.
+func SetAgentProfiles(custom []config.AgentProfile) error {
+	compiled, err := compileProfiles(custom)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(custom))
+	for _, profile := range custom {
+		names[profile.Name] = true
+	}
+	for _, builtin := range mustCompileProfiles(BuiltinAgentProfiles()) {
+		if !names[builtin.name] {
+			compiled = append(compiled, builtin)
+		}
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles = compiled
+	return nil
+}
+
+// profileFor returns the profile for program, or nil if no profile applies to it.
+func profileFor(program string) *agentProfile {
+	fields := strings.Fields(program)
+	if len(fields) == 0 {
+		return nil
+	}
+	name := filepath.Base(fields[0])
+
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	for _, profile := range profiles {
+		for _, p := range profile.programs {
+			if p == name {
+				return profile
+			}
+		}
+	}
+	return nil
+}
+
+func mustCompileProfiles(raw []config.AgentProfile) []*agentProfile {
+	compiled, err := compileProfiles(raw)
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}
+
+func compileProfiles(raw []config.AgentProfile) ([]*agentProfile, error) {
+	compiled := make([]*agentProfile, 0, len(raw))
+	for _, r := range raw {
+		profile, err := compileProfile(r)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, profile)
+	}
+	return compiled, nil
+}
+
+func compileProfile(raw config.AgentProfile) (*agentProfile, error) {
+	if raw.Name == "" {
+		return nil, fmt.Errorf("agent profile name cannot be empty")
+	}
+	if len(raw.Programs) == 0 {
+		return nil, fmt.Errorf("agent profile %s has no programs", raw.Name)
+	}
+
+	profile := &agentProfile{
+		name:           raw.Name,
+		programs:       raw.Programs,
+		startupTimeout: time.Duration(raw.StartupTimeoutMs) * time.Millisecond,
+		submitKeys:     raw.SubmitKeys,
+		submitDelay:    time.Duration(raw.SubmitDelayMs) * time.Millisecond,
+	}
+	if profile.startupTimeout == 0 {
+		profile.startupTimeout = defaultStartupTimeout
+	}
+	if profile.submitKeys == "" {
+		profile.submitKeys = defaultSubmitKeys
+	}
+	if profile.submitDelay == 0 {
+		profile.submitDelay = defaultSubmitDelay
+	}
+
+	var err error
+	if profile.startupDialogs, err = compileDialogs(raw.Name, raw.StartupDialogs); err != nil {
+		return nil, err
+	}
+	if profile.approvals, err = compileDialogs(raw.Name, raw.Approvals); err != nil {
+		return nil, err
+	}
+	if profile.workingPatterns, err = compilePatterns(raw.Name, raw.WorkingPatterns); err != nil {
+		return nil, err
+	}
+	if profile.idlePatterns, err = compilePatterns(raw.Name, raw.IdlePatterns); err != nil {
+		return nil, err
+	}
+	if profile.rateLimitPatterns, err = compilePatterns(raw.Name, raw.RateLimitPatterns); err != nil {
+		return nil, err
+	}
+	if profile.errorPatterns, err = compilePatterns(raw.Name, raw.ErrorPatterns); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func compileDialogs(name string, raw []config.AgentDialog) ([]agentDialog, error) {
+	dialogs := make([]agentDialog, 0, len(raw))
+	for _, d := range raw {
+		if d.Keys == "" {
+			return nil, fmt.Errorf("dialog %q in agent profile %s has no keys", d.Pattern, name)
+		}
+		pattern, err := regexp.Compile(d.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in agent profile %s: %w", name, err)
+		}
+		denyKeys := d.DenyKeys
+		if denyKeys == "" {
+			denyKeys = defaultDenyKeys
+		}
+		dialogs = append(dialogs, agentDialog{pattern: pattern, keys: d.Keys, denyKeys: denyKeys})
+	}
+	return dialogs, nil
+}
+
+func compilePatterns(name string, raw []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(raw))
+	for _, p := range raw {
+		pattern, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in agent profile %s: %w", name, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// matchDialog returns the first dialog whose pattern matches content.
+func matchDialog(dialogs []agentDialog, content string) (agentDialog, bool) {
+	for _, d := range dialogs {
+		if d.pattern.MatchString(content) {
+			return d, true
+		}
+	}
+	return agentDialog{}, false
+}
+
+func matchAny(patterns []*regexp.Regexp, content string) bool {
+	for _, p := range patterns {
+		if p.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
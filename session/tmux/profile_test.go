@@ -0,0 +1,31 @@
+package tmux
+
+import (
+	"agent-farmer/config"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileFor(t *testing.T) {
+	require.Equal(t, ProgramClaude, profileFor("/usr/local/bin/claude --model opus").name)
+	require.Equal(t, ProgramAider, profileFor("aider --model ollama_chat/gemma3:1b").name)
+	require.Equal(t, "codex", profileFor("codex").name)
+	require.Nil(t, profileFor("$SHELL"))
+	require.Nil(t, profileFor(""))
+
+	t.Cleanup(func() {
+		require.NoError(t, SetAgentProfiles(nil))
+	})
+	require.NoError(t, SetAgentProfiles([]config.AgentProfile{
+		{Name: "amp", Programs: []string{"amp"}, SubmitKeys: "\x1b\r"},
+		{Name: ProgramClaude, Programs: []string{ProgramClaude}},
+	}))
+	require.Equal(t, "\x1b\r", profileFor("amp").submitKeys)
+	// The custom claude profile replaces the built-in one.
+	require.Empty(t, profileFor(ProgramClaude).approvals)
+	require.Equal(t, ProgramAider, profileFor(ProgramAider).name)
+
+	require.Error(t, SetAgentProfiles([]config.AgentProfile{{Name: "bad", Programs: []string{"bad"}, IdlePatterns: []string{"("}}}))
+	require.Error(t, SetAgentProfiles([]config.AgentProfile{{Name: "nothing"}}))
+}
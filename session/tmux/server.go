@@ -0,0 +1,153 @@
+package tmux
+
+import (
+	"agent-farmer/cmd"
+	"agent-farmer/config"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultSocket is the socket name of the tmux server agent sessions run on, apart from the user's own tmux server.
+const DefaultSocket = "agentfarmer"
+
+const serverConfigFileName = "tmux.conf"
+
+// defaultServerConfig is written to the config dir if there's no tmux config for the server yet. The user's own
+// tmux config isn't loaded, so their options and key bindings don't leak into agent panes.
+const defaultServerConfig = `# tmux config of the agent-farmer server. The user's own tmux config isn't loaded.
+# Changes apply once the server restarts, e.g. after af reset.
+set -g history-limit 100000
+set -g escape-time 0
+set -g default-terminal "screen-256color"
+`
+
+// server is a tmux server, selected by socket name (tmux -L) or, if it contains a slash, socket path (tmux -S).
+type server struct {
+	socket string
+}
+
+var (
+	serverMu sync.RWMutex
+	// socket is the socket of the server, or the prefix of the servers per repo.
+	socket        = DefaultSocket
+	socketPerRepo bool
+	// serverConfig is the path of the tmux config the server starts with, empty to start it without one.
+	serverConfig string
+)
+
+// SetServer selects the tmux server sessions created afterwards run on. An empty socket selects DefaultSocket. With
+// perRepo, the sessions of each repo get their own server. The server's tmux config is written to the config dir
+// if it doesn't exist yet.
+func SetServer(name string, perRepo bool) error {
+	if name == "" {
+		name = DefaultSocket
+	}
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return err
+	}
+	configPath := filepath.Join(configDir, serverConfigFileName)
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+		if err := os.WriteFile(configPath, []byte(defaultServerConfig), 0644); err != nil {
+			return fmt.Errorf("failed to write tmux config: %w", err)
+		}
+	}
+
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	socket, socketPerRepo, serverConfig = name, perRepo, configPath
+	return nil
+}
+
+var unsafeSocketChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// serverFor returns the server the sessions of the repo at repoPath run on.
+func serverFor(repoPath string) server {
+	serverMu.RLock()
+	defer serverMu.RUnlock()
+	if !socketPerRepo || repoPath == "" {
+		return server{socket: socket}
+	}
+	// The hash keeps repos with the same name apart.
+	hash := sha256.Sum256([]byte(repoPath))
+	suffix := fmt.Sprintf("%s-%x", unsafeSocketChars.ReplaceAllString(filepath.Base(repoPath), "_"), hash[:4])
+	return server{socket: socket + "-" + suffix}
+}
+
+func (s server) args() []string {
+	args := []string{"-L", s.socket}
+	if strings.Contains(s.socket, "/") {
+		args = []string{"-S", s.socket}
+	}
+	serverMu.RLock()
+	defer serverMu.RUnlock()
+	if serverConfig != "" {
+		args = append(args, "-f", serverConfig)
+	}
+	return args
+}
+
+// command returns a tmux command run on the server. $TMUX is left out of its environment: the server is selected by
+// its socket anyway, and tmux refuses to attach a client as nested if $TMUX is set and the client's tty has the name
+// of one of its panes, which happens when the tty of a dead pane is reused.
+func (s server) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("tmux", append(s.args(), args...)...)
+	cmd.Env = slices.DeleteFunc(os.Environ(), func(v string) bool { return strings.HasPrefix(v, "TMUX=") })
+	return cmd
+}
+
+// withoutServerArgs strips the flags selecting the server from the arguments of a tmux command.
+func withoutServerArgs(args []string) []string {
+	for len(args) >= 2 && (args[0] == "-L" || args[0] == "-S" || args[0] == "-f") {
+		args = args[2:]
+	}
+	return args
+}
+
+// KillServers kills the servers agent sessions run on, including the ones per repo.
+func KillServers(cmdExec cmd.Executor) error {
+	serverMu.RLock()
+	servers := []server{{socket: socket}}
+	prefix := socket
+	serverMu.RUnlock()
+
+	// Servers per repo are found by their sockets, -L sockets are in tmux's socket directory.
+	pattern := prefix + "-*"
+	if !strings.Contains(prefix, "/") {
+		tmpDir := os.Getenv("TMUX_TMPDIR")
+		if tmpDir == "" {
+			tmpDir = "/tmp"
+		}
+		pattern = filepath.Join(tmpDir, fmt.Sprintf("tmux-%d", os.Getuid()), pattern)
+	}
+	sockets, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("failed to find tmux servers: %w", err)
+	}
+	for _, s := range sockets {
+		servers = append(servers, server{socket: s})
+	}
+
+	for _, s := range servers {
+		if err := cmdExec.Run(s.command("kill-server")); err != nil {
+			// tmux exits with 1 if the server isn't running.
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+				continue
+			}
+			return fmt.Errorf("failed to kill tmux server %s: %w", s.socket, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package tmux
+
+import "strings"
+
+// stateLines is the number of lines at the bottom of the pane, not counting blank ones, that are matched against the
+// working, rate limit, error and idle patterns. The agents show their state right above their input, and an error
+// further up was already answered, e.g. by retrying.
+const stateLines = 8
+
+// PaneState is what the program in a pane is doing, as far as its output tells.
+type PaneState int
+
+const (
+	// PaneWorking is when the program's output is changing or it shows its working indicator.
+	PaneWorking PaneState = iota
+	// PaneIdle is when the program waits at its input.
+	PaneIdle
+	// PaneAwaitingApproval is when the program asks to approve an action.
+	PaneAwaitingApproval
+	// PaneRateLimited is when the program hit a rate or usage limit.
+	PaneRateLimited
+	// PaneErrored is when the program shows an error, e.g. from its API.
+	PaneErrored
+	// PaneExited is when the program quit or crashed, see Health.
+	PaneExited
+)
+
+// classify returns the state of a pane showing content, without ANSI escapes. changed is whether the content changed
+// since the last check. The patterns of the profile take precedence over changed, profile may be nil. If the pane is
+// awaiting approval, the matching approval dialog is returned too. Dialogs are matched against the whole pane since
+// they can be taller than stateLines, the other patterns only against its bottom.
+func classify(profile *agentProfile, content string, changed bool) (PaneState, *agentDialog) {
+	if profile != nil {
+		if approval, ok := matchDialog(profile.approvals, content); ok {
+			return PaneAwaitingApproval, &approval
+		}
+		content = lastLines(content, stateLines)
+		// A working program may still show an error it's retrying, so the working indicator wins.
+		if matchAny(profile.workingPatterns, content) {
+			return PaneWorking, nil
+		}
+		if matchAny(profile.rateLimitPatterns, content) {
+			return PaneRateLimited, nil
+		}
+		if matchAny(profile.errorPatterns, content) {
+			return PaneErrored, nil
+		}
+		if matchAny(profile.idlePatterns, content) {
+			return PaneIdle, nil
+		}
+	}
+	if changed {
+		return PaneWorking, nil
+	}
+	return PaneIdle, nil
+}
+
+// lastLines returns the last n lines of content that aren't blank, and the blank ones between them.
+func lastLines(content string, n int) string {
+	lines := strings.Split(content, "\n")
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	start := end
+	for ; start > 0 && n > 0; start-- {
+		if strings.TrimSpace(lines[start-1]) != "" {
+			n--
+		}
+	}
+	return strings.Join(lines[start:end], "\n")
+}
@@ -0,0 +1,110 @@
+package tmux
+
+import (
+	"agent-farmer/cmd/cmd_test"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClassify classifies panes recorded from the agents in testdata. Fixtures are named <program>_<state>.txt, or
+// <program>_<state>-<case>.txt if there are several for a state.
+func TestClassify(t *testing.T) {
+	states := map[string]PaneState{
+		"working":      PaneWorking,
+		"idle":         PaneIdle,
+		"approval":     PaneAwaitingApproval,
+		"rate_limited": PaneRateLimited,
+		"error":        PaneErrored,
+	}
+
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	require.NoError(t, err)
+	require.NotEmpty(t, fixtures)
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".txt")
+		t.Run(name, func(t *testing.T) {
+			program, state, _ := strings.Cut(name, "_")
+			state, _, _ = strings.Cut(state, "-")
+			want, ok := states[state]
+			require.True(t, ok, "unknown state %q in fixture name", state)
+
+			content, err := os.ReadFile(fixture)
+			require.NoError(t, err)
+			profile := profileFor(program)
+			require.NotNil(t, profile)
+
+			// Recorded panes don't change between checks, the patterns alone have to tell the state.
+			got, approval := classify(profile, ansi.Strip(string(content)), false)
+			require.Equal(t, want, got)
+			require.Equal(t, want == PaneAwaitingApproval, approval != nil)
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	content := ""
+	exists := true
+	panes := "0 claude"
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			if !exists {
+				return fmt.Errorf("can't find session")
+			}
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			if !exists {
+				return nil, fmt.Errorf("can't find session")
+			}
+			if slices.Contains(cmd.Args, "list-panes") {
+				return []byte(panes), nil
+			}
+			return []byte(content), nil
+		},
+	}
+
+	session := newTmuxSession("test", "claude", NewMockPtyFactory(t), cmdExec)
+	content = "> "
+	require.Equal(t, PaneWorking, session.State())
+	require.Equal(t, PaneIdle, session.State())
+
+	content = "Do you want to proceed?\n❯ 1. Yes\n  2. No, and tell \x1b[2mClaude\x1b[0m what to do differently"
+	require.Equal(t, PaneAwaitingApproval, session.State())
+	require.Equal(t, "\r", session.monitor.approval.keys)
+
+	// The program crashed and tmux kept its pane.
+	panes = "1 claude"
+	require.Equal(t, PaneExited, session.State())
+	require.Nil(t, session.monitor.approval)
+
+	// The session is gone.
+	panes = "0 claude"
+	exists = false
+	require.Equal(t, PaneExited, session.State())
+
+	// Without a profile only changes in the pane count.
+	exists = true
+	panes = "0 bash"
+	shell := newTmuxSession("shell", "bash", NewMockPtyFactory(t), cmdExec)
+	require.Equal(t, PaneWorking, shell.State())
+	require.Equal(t, PaneIdle, shell.State())
+}
+
+func TestPaneHealth(t *testing.T) {
+	require.Equal(t, PaneAlive, paneHealth("0 claude\n", "claude"))
+	require.Equal(t, PaneAlive, paneHealth("0 node\n", "claude --model opus"))
+	require.Equal(t, PaneDead, paneHealth("1 claude\n", "claude"))
+	// The agent quit back to the shell it was started from.
+	require.Equal(t, PaneAtShell, paneHealth("0 zsh\n", "claude"))
+	// A shell is fine if it's the program.
+	require.Equal(t, PaneAlive, paneHealth("0 bash\n", "/bin/bash"))
+	require.Equal(t, PaneDead, paneHealth("1 bash\n", "bash"))
+}
@@ -0,0 +1,88 @@
+package tmux
+
+// maxPendingResponse caps how much of an unfinished sequence is held back, so input isn't stuck behind a sequence that
+// never ends.
+const maxPendingResponse = 1024
+
+// responseFilter removes the terminal's responses to queries, e.g. the device attributes (ESC [ ? 62 c) or the
+// foreground color (ESC ] 10 ; rgb:...), from the input forwarded to a session. They arrive on stdin like keys and
+// would be typed into the agent otherwise. Keys, including escape sequences like the arrow keys, are kept.
+type responseFilter struct {
+	// pending is the start of a response that continues in the next read.
+	pending []byte
+}
+
+// filter returns input without responses. A response that isn't complete at the end of input is held back until
+// the rest of it is read.
+func (f *responseFilter) filter(input []byte) []byte {
+	if len(f.pending) > 0 {
+		input = append(f.pending, input...)
+		f.pending = nil
+	}
+
+	out := make([]byte, 0, len(input))
+	for i := 0; i < len(input); {
+		if input[i] != 0x1b || i+1 == len(input) {
+			// A lone escape at the end is the escape key, terminals send sequences in one write.
+			out = append(out, input[i])
+			i++
+			continue
+		}
+		n, response, complete := responseLength(input[i:])
+		if !complete {
+			if len(input)-i > maxPendingResponse {
+				return append(out, input[i:]...)
+			}
+			f.pending = append(f.pending, input[i:]...)
+			return out
+		}
+		if !response {
+			out = append(out, input[i:i+n]...)
+		}
+		i += n
+	}
+	return out
+}
+
+// responseLength returns the length of the escape sequence at the start of input and whether it's a response. If the
+// sequence might be a response but isn't complete, complete is false.
+func responseLength(input []byte) (n int, response bool, complete bool) {
+	switch input[1] {
+	case ']', 'P', '_':
+		// OSC, DCS and APC strings are only sent by the terminal to answer queries. They end with BEL (OSC only) or
+		// ST (ESC \).
+		for i := 2; i < len(input); i++ {
+			if input[i] == 0x07 && input[1] == ']' {
+				return i + 1, true, true
+			}
+			if input[i] == 0x1b && i+1 < len(input) && input[i+1] == '\\' {
+				return i + 2, true, true
+			}
+		}
+		return 0, true, false
+	case '[':
+		// CSI sequences are keys, unless they have the private markers responses use: DA1 (ESC [ ? ... c),
+		// DA2 (ESC [ > ... c), DA3 (ESC [ = ... c), mode reports (ESC [ ? ... $ y) and keyboard flags (ESC [ ? ... u).
+		if len(input) < 3 {
+			return 0, false, false
+		}
+		private := input[2] == '?' || input[2] == '>' || input[2] == '='
+		for i := 2; i < len(input); i++ {
+			if input[i] >= 0x40 && input[i] <= 0x7e {
+				if !private {
+					return i + 1, false, true
+				}
+				final := input[i]
+				return i + 1, final == 'c' || final == 'y' || final == 'u', true
+			}
+		}
+		if !private {
+			// Not a response, there's nothing to wait for.
+			return len(input), false, true
+		}
+		return 0, true, false
+	default:
+		// Alt and a key.
+		return 2, false, true
+	}
+}
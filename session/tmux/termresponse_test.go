@@ -0,0 +1,67 @@
+package tmux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads []string
+		want  string
+	}{
+		{name: "keys", reads: []string{"hello\r"}, want: "hello\r"},
+		{name: "arrow keys and alt", reads: []string{"\x1b[A\x1b[1;5C\x1bb"}, want: "\x1b[A\x1b[1;5C\x1bb"},
+		{name: "escape key", reads: []string{"\x1b"}, want: "\x1b"},
+		{name: "mouse", reads: []string{"\x1b[<0;10;5M"}, want: "\x1b[<0;10;5M"},
+		{name: "bracketed paste", reads: []string{"\x1b[200~text\x1b[201~"}, want: "\x1b[200~text\x1b[201~"},
+		{name: "device attributes", reads: []string{"\x1b[?62;22c\x1b[>0;95;0cx"}, want: "x"},
+		{name: "colors", reads: []string{"a\x1b]10;rgb:f8f8/f8f8/f8f8\x07\x1b]11;rgb:0000/0000/0000\x1b\\b"}, want: "ab"},
+		{name: "mode report and keyboard flags", reads: []string{"\x1b[?2004;1$y\x1b[?0u"}, want: ""},
+		{name: "dcs", reads: []string{"\x1bP>|tmux 3.4\x1b\\q"}, want: "q"},
+		{name: "split response", reads: []string{"\x1b]11;rgb:00", "00/0000/0000\x07x"}, want: "x"},
+		{name: "split private csi", reads: []string{"\x1b[?6", "2c"}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &responseFilter{}
+			var got []byte
+			for _, read := range tt.reads {
+				got = append(got, f.filter([]byte(read))...)
+			}
+			require.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key, err := parseKey("ctrl-q")
+	require.NoError(t, err)
+	require.Equal(t, byte(17), key)
+	key, err = parseKey("C-]")
+	require.NoError(t, err)
+	require.Equal(t, byte(0x1d), key)
+	key, err = parseKey(`ctrl-\`)
+	require.NoError(t, err)
+	require.Equal(t, byte(0x1c), key)
+
+	for _, name := range []string{"q", "ctrl-", "ctrl-qq", "ctrl-m", "ctrl-[", "ctrl-1"} {
+		_, err := parseKey(name)
+		require.Error(t, err, name)
+	}
+
+	t.Cleanup(func() {
+		require.NoError(t, ConfigureAttach("", "", nil))
+	})
+	require.Error(t, ConfigureAttach("ctrl-g", "C-g", nil))
+	require.NoError(t, ConfigureAttach("ctrl-g", "none", []string{"run the tests"}))
+	require.Equal(t, "", PaletteKeyName())
+	keys := currentAttachKeys()
+	result, ok := keys.paletteAction('1')
+	require.True(t, ok)
+	require.Equal(t, AttachResult{Action: AttachSendPrompt, Prompt: 0}, result)
+	_, ok = keys.paletteAction('2')
+	require.False(t, ok)
+}
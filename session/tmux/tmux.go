@@ -10,12 +10,12 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/charmbracelet/x/ansi"
 	"github.com/creack/pty"
 )
 
@@ -30,25 +30,43 @@ type TmuxSession struct {
 	// The name of the tmux session and the sanitized name used for tmux commands.
 	sanitizedName string
 	program       string
+	// server is the tmux server the session runs on.
+	server server
+	// profile tells how to drive the program. It's nil for programs without a profile, e.g. a shell.
+	profile *agentProfile
 	// ptyFactory is used to create a PTY for the tmux session.
 	ptyFactory PtyFactory
 	// cmdExec is used to execute commands in the tmux session.
 	cmdExec cmd.Executor
+	// control is the control mode connection the session's commands go over, nil if it isn't used.
+	control *Control
 
 	// Initialized by Start or Restore
 	//
 	// ptmx is a PTY is running the tmux attach command. This can be resized to change the
 	// stdout dimensions of the tmux pane. On detach, we close it and set a new one.
-	// This should never be nil.
+	// It's only nil if the session was gone when it was loaded, until Restart.
 	ptmx *os.File
 	// monitor monitors the tmux pane content and sends signals to the UI when it's status changes
 	monitor *statusMonitor
+	// paneID is the id of the pane watched by control, empty if it isn't watched.
+	paneID string
+	// windows are the auxiliary windows of the session, see StartWindows.
+	windows []Window
+
+	// captureMu guards the last capture of a watched pane, which is reused until the pane has new output.
+	captureMu      sync.Mutex
+	captured       string
+	capturedSeq    uint64
+	capturedStored bool
 
 	// Initialized by Attach
 	// Deinitilaized by Detach
 	//
-	// Channel to be closed at the very end of detaching. Used to signal callers.
-	attachCh chan struct{}
+	// Channel that gets the AttachResult and is closed at the very end of detaching. Used to signal callers.
+	attachCh chan AttachResult
+	// sessionPtmx is the session's own PTY while ptmx is the one of an attached window, see AttachWindow.
+	sessionPtmx *os.File
 	// While attached, we use some goroutines to manage the window size and stdin/stdout. This stuff
 	// is used to terminate them on Detach. We don't want them to outlive the attached window.
 	ctx    context.Context
@@ -71,17 +89,30 @@ func toClaudeSquadTmuxName(str string) string {
 	return sanitized
 }
 
-// NewTmuxSession creates a new TmuxSession with the given name and program.
-func NewTmuxSession(name string, program string) *TmuxSession {
-	return newTmuxSession(name, program, MakePtyFactory(), cmd.MakeExecutor())
+// NewTmuxSession creates a new TmuxSession with the given name and program, on the tmux server of the repo at
+// repoPath, see SetServer. Its commands go over the server's control mode connection if control mode is enabled,
+// see EnableControlMode.
+func NewTmuxSession(name string, program string, repoPath string) *TmuxSession {
+	server := serverFor(repoPath)
+	if control := controlFor(server); control != nil {
+		t := newTmuxSession(name, program, MakePtyFactory(), control)
+		t.server, t.control = server, control
+		return t
+	}
+	t := newTmuxSession(name, program, MakePtyFactory(), cmd.MakeExecutor())
+	t.server = server
+	return t
 }
 
 func newTmuxSession(name string, program string, ptyFactory PtyFactory, cmdExec cmd.Executor) *TmuxSession {
 	return &TmuxSession{
 		sanitizedName: toClaudeSquadTmuxName(name),
 		program:       program,
+		server:        serverFor(""),
+		profile:       profileFor(program),
 		ptyFactory:    ptyFactory,
 		cmdExec:       cmdExec,
+		monitor:       newStatusMonitor(),
 	}
 }
 
@@ -93,14 +124,17 @@ func (t *TmuxSession) Start(workDir string) error {
 		return fmt.Errorf("tmux session already exists: %s", t.sanitizedName)
 	}
 
-	// Create a new detached tmux session and start claude in it
-	cmd := exec.Command("tmux", "new-session", "-d", "-s", t.sanitizedName, "-c", workDir, t.program)
+	// Create a new detached tmux session and start claude in it. The pane is kept when the program exits, so a
+	// crash can be inspected and the program restarted in place. The option is set in the same tmux invocation, so
+	// a program that exits right away is caught too.
+	cmd := t.server.command("new-session", "-d", "-s", t.sanitizedName, "-c", workDir, t.program,
+		";", "set-option", "-t", t.sanitizedName, "remain-on-exit", "on")
 
 	ptmx, err := t.ptyFactory.Start(cmd)
 	if err != nil {
 		// Cleanup any partially created session if any exists.
 		if t.DoesSessionExist() {
-			cleanupCmd := exec.Command("tmux", "kill-session", "-t", t.sanitizedName)
+			cleanupCmd := t.server.command("kill-session", "-t", t.sanitizedName)
 			if cleanupErr := t.cmdExec.Run(cleanupCmd); cleanupErr != nil {
 				err = fmt.Errorf("%v (cleanup error: %v)", err, cleanupErr)
 			}
@@ -133,47 +167,106 @@ func (t *TmuxSession) Start(workDir string) error {
 		return fmt.Errorf("error restoring tmux session: %w", err)
 	}
 
-	if t.program == ProgramClaude || strings.HasPrefix(t.program, ProgramAider) {
-		searchString := "Do you trust the files in this folder?"
-		tapFunc := t.TapEnter
-		iterations := 5
-		if t.program != ProgramClaude {
-			searchString = "Open documentation url for more info"
-			tapFunc = t.TapDAndEnter
-			iterations = 10 // Aider takes longer to start :/
+	t.answerStartupDialogs()
+	return nil
+}
+
+// Restart runs the program again in workDir. If the session still exists, e.g. with the pane of a crashed program,
+// the pane is respawned. Otherwise, a new session is started.
+func (t *TmuxSession) Restart(workDir string) error {
+	if !t.DoesSessionExist() {
+		if t.ptmx != nil {
+			_ = t.ptmx.Close()
+			t.ptmx = nil
 		}
-		// Deal with "do you trust the files" screen by sending an enter keystroke.
-		for i := 0; i < iterations; i++ {
-			time.Sleep(200 * time.Millisecond)
-			content, err := t.CapturePaneContent()
-			if err != nil {
-				log.ErrorLog.Printf("could not check 'do you trust the files screen': %v", err)
+		return t.Start(workDir)
+	}
+
+	cmd := t.server.command("respawn-pane", "-k", fmt.Sprintf("-t=%s:", t.sanitizedName), "-c", workDir, t.program)
+	if err := t.cmdExec.Run(cmd); err != nil {
+		return fmt.Errorf("error respawning pane: %w", err)
+	}
+	// The session may have been loaded without attaching to it.
+	if t.ptmx == nil {
+		if err := t.Restore(); err != nil {
+			return fmt.Errorf("error restoring tmux session: %w", err)
+		}
+	}
+	t.monitor = newStatusMonitor()
+	t.answerStartupDialogs()
+	return nil
+}
+
+// answerStartupDialogs answers the startup dialogs of the program's profile, e.g. the "do you trust the files"
+// screen, while the program starts.
+func (t *TmuxSession) answerStartupDialogs() {
+	if t.profile == nil || len(t.profile.startupDialogs) == 0 {
+		return
+	}
+
+	answered := make([]bool, len(t.profile.startupDialogs))
+	remaining := len(answered)
+	for deadline := time.Now().Add(t.profile.startupTimeout); remaining > 0 && time.Now().Before(deadline); {
+		time.Sleep(200 * time.Millisecond)
+		content, err := t.CapturePaneContent()
+		if err != nil {
+			log.ErrorLog.Printf("could not check for startup dialogs: %v", err)
+			continue
+		}
+		content = ansi.Strip(content)
+		for i, dialog := range t.profile.startupDialogs {
+			if answered[i] || !dialog.pattern.MatchString(content) {
+				continue
 			}
-			if strings.Contains(content, searchString) {
-				if err := tapFunc(); err != nil {
-					log.ErrorLog.Printf("could not tap enter on trust screen: %v", err)
-				}
-				break
+			if err := t.SendKeys(dialog.keys); err != nil {
+				log.ErrorLog.Printf("could not answer startup dialog: %v", err)
 			}
+			answered[i] = true
+			remaining--
 		}
 	}
-	return nil
 }
 
 // Restore attaches to an existing session and restores the window size
 func (t *TmuxSession) Restore() error {
-	ptmx, err := t.ptyFactory.Start(exec.Command("tmux", "attach-session", "-t", t.sanitizedName))
+	ptmx, err := t.ptyFactory.Start(t.server.command("attach-session", "-t", t.sanitizedName))
 	if err != nil {
 		return fmt.Errorf("error opening PTY: %w", err)
 	}
 	t.ptmx = ptmx
 	t.monitor = newStatusMonitor()
+	// The agent's window is the first one. It's made the current one again in case another one was selected while
+	// attached, since prompts are typed into the current window.
+	if err := t.cmdExec.Run(t.server.command("select-window", "-t", fmt.Sprintf("=%s:^", t.sanitizedName))); err != nil {
+		log.WarningLog.Printf("could not select the agent's window of %s: %v", t.sanitizedName, err)
+	}
+	t.watch()
 	return nil
 }
 
+// watch has the control mode connection watch the session's pane for output. Without it, the pane is captured on
+// every check.
+func (t *TmuxSession) watch() {
+	if t.control == nil {
+		return
+	}
+	paneID, err := t.control.watch(t.sanitizedName)
+	if err != nil {
+		log.WarningLog.Printf("could not watch pane of %s, capturing it on every check: %v", t.sanitizedName, err)
+		return
+	}
+	t.paneID = paneID
+}
+
 type statusMonitor struct {
 	// Store hashes to save memory.
 	prevOutputHash []byte
+	// state is the result of the last check.
+	state PaneState
+	// approval is the approval prompt seen by the last check, if any.
+	approval *agentDialog
+	// approvalText is what the approval prompt asks to approve, see extractApproval.
+	approvalText string
 }
 
 func newStatusMonitor() *statusMonitor {
@@ -197,58 +290,91 @@ func (t *TmuxSession) TapEnter() error {
 	return nil
 }
 
-// TapDAndEnter sends 'D' followed by an enter keystroke to the tmux pane.
-func (t *TmuxSession) TapDAndEnter() error {
-	_, err := t.ptmx.Write([]byte{0x44, 0x0D})
-	if err != nil {
-		return fmt.Errorf("error sending enter keystroke to PTY: %w", err)
-	}
-	return nil
-}
-
 func (t *TmuxSession) SendKeys(keys string) error {
 	_, err := t.ptmx.Write([]byte(keys))
 	return err
 }
 
-// HasUpdated checks if the tmux pane content has changed since the last tick. It also returns true if
-// the tmux pane has a prompt for aider or claude code.
-func (t *TmuxSession) HasUpdated() (updated bool, hasPrompt bool) {
+// SubmitPrompt types the prompt into the pane and submits it the way the program's profile says.
+func (t *TmuxSession) SubmitPrompt(prompt string) error {
+	submitKeys, submitDelay := defaultSubmitKeys, defaultSubmitDelay
+	if t.profile != nil {
+		submitKeys, submitDelay = t.profile.submitKeys, t.profile.submitDelay
+	}
+
+	if err := t.SendKeys(prompt); err != nil {
+		return fmt.Errorf("error sending keys to tmux session: %w", err)
+	}
+	// Brief pause to prevent the submit keys from being interpreted as part of the prompt
+	time.Sleep(submitDelay)
+	if err := t.SendKeys(submitKeys); err != nil {
+		return fmt.Errorf("error submitting prompt: %w", err)
+	}
+	return nil
+}
+
+// State checks what the program in the pane is doing. Besides the pane content changing since the last check, the
+// patterns of the program's profile are used to tell approval prompts, rate limits and errors apart. If the program
+// is awaiting approval, Approve answers the prompt.
+func (t *TmuxSession) State() PaneState {
+	if health, err := t.Health(); err != nil {
+		log.ErrorLog.Printf("error checking pane health in status monitor: %v", err)
+	} else if health != PaneAlive {
+		t.monitor.state, t.monitor.approval = PaneExited, nil
+		return PaneExited
+	}
+
 	content, err := t.CapturePaneContent()
 	if err != nil {
 		log.ErrorLog.Printf("error capturing pane content in status monitor: %v", err)
-		return false, false
+		return t.monitor.state
 	}
 
-	// Only set hasPrompt for claude and aider. Use these strings to check for a prompt.
-	if t.program == ProgramClaude {
-		hasPrompt = strings.Contains(content, "No, and tell Claude what to do differently")
-	} else if strings.HasPrefix(t.program, ProgramAider) {
-		hasPrompt = strings.Contains(content, "(Y)es/(N)o/(D)on't ask again")
+	hash := t.monitor.hash(content)
+	changed := !bytes.Equal(hash, t.monitor.prevOutputHash)
+	t.monitor.prevOutputHash = hash
+	stripped := ansi.Strip(content)
+	t.monitor.state, t.monitor.approval = classify(t.profile, stripped, changed)
+	t.monitor.approvalText = ""
+	if t.monitor.approval != nil {
+		t.monitor.approvalText = extractApproval(stripped, t.monitor.approval.pattern)
 	}
+	return t.monitor.state
+}
 
-	if !bytes.Equal(t.monitor.hash(content), t.monitor.prevOutputHash) {
-		t.monitor.prevOutputHash = t.monitor.hash(content)
-		return true, hasPrompt
+// Approve answers the approval prompt found by the last call to State. It does nothing if there was none.
+func (t *TmuxSession) Approve() error {
+	approval := t.monitor.approval
+	if approval == nil {
+		return nil
+	}
+	t.monitor.approval = nil
+	if err := t.SendKeys(approval.keys); err != nil {
+		return fmt.Errorf("error answering approval prompt: %w", err)
 	}
-	return false, hasPrompt
+	return nil
 }
 
-func (t *TmuxSession) Attach() (chan struct{}, error) {
-	t.attachCh = make(chan struct{})
+// Attach attaches the terminal to the session. The returned channel gets what the user chose in the palette, or
+// AttachDetach when they detached, once the session is detached again.
+func (t *TmuxSession) Attach() (chan AttachResult, error) {
+	t.attachCh = make(chan AttachResult, 1)
 
 	t.wg = &sync.WaitGroup{}
 	t.wg.Add(1)
 	t.ctx, t.cancel = context.WithCancel(context.Background())
 
+	keys := currentAttachKeys()
+	output := &attachOutput{out: os.Stdout}
+
 	// The first goroutine should terminate when the ptmx is closed. We use the
 	// waitgroup to wait for it to finish.
-	// The 2nd one returns when you press escape to Detach. It doesn't need to be
+	// The 2nd one returns when you press the detach key or choose an action in the palette. It doesn't need to be
 	// in the waitgroup because is the goroutine doing the Detaching; it waits for
 	// all the other ones.
 	go func() {
 		defer t.wg.Done()
-		_, _ = io.Copy(os.Stdout, t.ptmx)
+		_, _ = io.Copy(output, t.ptmx)
 		// When io.Copy returns, it means the connection was closed
 		// This could be due to normal detach or Ctrl-D
 		// Check if the context is done to determine if it was a normal detach
@@ -258,19 +384,15 @@ func (t *TmuxSession) Attach() (chan struct{}, error) {
 		default:
 			// If context is not done, it was likely an abnormal termination (Ctrl-D)
 			// Print warning message
-			fmt.Fprintf(os.Stderr, "\n\033[31mError: Session terminated without detaching. Use Ctrl-Q to properly detach from tmux sessions.\033[0m\n")
+			fmt.Fprintf(os.Stderr, "\n\033[31mError: Session terminated without detaching. Use %s to properly detach from tmux sessions.\033[0m\n", keys.detachName)
 		}
 	}()
 
 	go func() {
-		// Close the channel after 50ms
-		timeoutCh := make(chan struct{})
-		go func() {
-			time.Sleep(50 * time.Millisecond)
-			close(timeoutCh)
-		}()
-
-		// Read input from stdin and check for Ctrl+q
+		// The terminal answers queries, e.g. for its colors, on stdin. The answers are dropped, so they don't end up
+		// in the agent's input.
+		filter := &responseFilter{}
+		paletteOpen := false
 		buf := make([]byte, 32)
 		for {
 			nr, err := os.Stdin.Read(buf)
@@ -280,30 +402,39 @@ func (t *TmuxSession) Attach() (chan struct{}, error) {
 				}
 				continue
 			}
-
-			// Nuke the first bytes of stdin, up to 64, to prevent tmux from reading it.
-			// When we attach, there tends to be terminal control sequences like ?[?62c0;95;0c or
-			// ]10;rgb:f8f8f8. The control sequences depend on the terminal (warp vs iterm). We should use regex ideally
-			// but this works well for now. Log this for debugging.
-			//
-			// There seems to always be control characters, but I think it's possible for there not to be. The heuristic
-			// here can be: if there's characters within 50ms, then assume they are control characters and nuke them.
-			select {
-			case <-timeoutCh:
-			default:
-				log.InfoLog.Printf("nuked first stdin: %s", buf[:nr])
+			input := filter.filter(buf[:nr])
+			if len(input) == 0 {
 				continue
 			}
 
-			// Check for Ctrl+q (ASCII 17)
-			if nr == 1 && buf[0] == 17 {
-				// Detach from the session
+			if paletteOpen {
+				paletteOpen = false
+				output.hidePalette()
+				t.refreshClients()
+				if len(input) == 1 {
+					if result, ok := keys.paletteAction(input[0]); ok {
+						t.detach(result)
+						return
+					}
+					// Pressing the palette key twice sends it to the session.
+					if input[0] == keys.palette {
+						_, _ = t.ptmx.Write(input)
+					}
+				}
+				continue
+			}
+			if len(input) == 1 && input[0] == keys.detach {
 				t.Detach()
 				return
 			}
+			if len(input) == 1 && keys.palette != 0 && input[0] == keys.palette {
+				paletteOpen = true
+				output.showPalette(keys.paletteLines())
+				continue
+			}
 
 			// Forward other input to tmux
-			_, _ = t.ptmx.Write(buf[:nr])
+			_, _ = t.ptmx.Write(input)
 		}
 	}()
 
@@ -314,9 +445,15 @@ func (t *TmuxSession) Attach() (chan struct{}, error) {
 // Detach disconnects from the current tmux session. It panics if detaching fails. At the moment, there's no
 // way to recover from a failed detach.
 func (t *TmuxSession) Detach() {
+	t.detach(AttachResult{Action: AttachDetach})
+}
+
+// detach detaches and sends result to the channel returned by Attach.
+func (t *TmuxSession) detach(result AttachResult) {
 	// TODO: control flow is a bit messy here. If there's an error,
 	// I'm not sure if we get into a bad state. Needs testing.
 	defer func() {
+		t.attachCh <- result
 		close(t.attachCh)
 		t.attachCh = nil
 		t.cancel = nil
@@ -334,8 +471,11 @@ func (t *TmuxSession) Detach() {
 		panic(msg)
 	}
 	// Attach goroutines should die on EOF due to the ptmx closing. Call
-	// t.Restore to set a new t.ptmx.
-	if err = t.Restore(); err != nil {
+	// t.Restore to set a new t.ptmx, unless it was a window's and the session's own one is still open.
+	if t.sessionPtmx != nil {
+		t.ptmx, t.sessionPtmx = t.sessionPtmx, nil
+		t.resizeWindows()
+	} else if err = t.Restore(); err != nil {
 		// This is a fatal error. Our invariant that a started TmuxSession always has a valid ptmx is violated.
 		msg := fmt.Sprintf("error closing attach pty session: %v", err)
 		log.ErrorLog.Println(msg)
@@ -351,6 +491,14 @@ func (t *TmuxSession) Detach() {
 func (t *TmuxSession) Close() error {
 	var errs []error
 
+	// Unlink the window from the control session first, otherwise it would outlive the session.
+	if t.control != nil && t.paneID != "" {
+		if err := t.control.unwatch(t.paneID); err != nil {
+			log.WarningLog.Printf("could not stop watching pane of %s: %v", t.sanitizedName, err)
+		}
+		t.paneID = ""
+	}
+
 	if t.ptmx != nil {
 		if err := t.ptmx.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("error closing PTY: %w", err))
@@ -358,7 +506,7 @@ func (t *TmuxSession) Close() error {
 		t.ptmx = nil
 	}
 
-	cmd := exec.Command("tmux", "kill-session", "-t", t.sanitizedName)
+	cmd := t.server.command("kill-session", "-t", t.sanitizedName)
 	if err := t.cmdExec.Run(cmd); err != nil {
 		errs = append(errs, fmt.Errorf("error killing tmux session: %w", err))
 	}
@@ -380,7 +528,15 @@ func (t *TmuxSession) Close() error {
 // SetDetachedSize set the width and height of the session while detached. This makes the
 // tmux output conform to the specified shape.
 func (t *TmuxSession) SetDetachedSize(width, height int) error {
-	return t.updateWindowSize(width, height)
+	// tmux reflows the pane without the program writing anything, so the last capture is outdated.
+	t.captureMu.Lock()
+	t.capturedStored = false
+	t.captureMu.Unlock()
+	if err := t.updateWindowSize(width, height); err != nil {
+		return err
+	}
+	t.resizeWindows()
+	return nil
 }
 
 // updateWindowSize updates the window size of the PTY.
@@ -395,64 +551,48 @@ func (t *TmuxSession) updateWindowSize(cols, rows int) error {
 
 func (t *TmuxSession) DoesSessionExist() bool {
 	// Using "-t name" does a prefix match, which is wrong. `-t=` does an exact match.
-	existsCmd := exec.Command("tmux", "has-session", fmt.Sprintf("-t=%s", t.sanitizedName))
+	existsCmd := t.server.command("has-session", fmt.Sprintf("-t=%s", t.sanitizedName))
 	return t.cmdExec.Run(existsCmd) == nil
 }
 
-// CapturePaneContent captures the content of the tmux pane
+// CapturePaneContent captures the content of the tmux pane. If the pane is watched over the control mode
+// connection and had no output since the last capture, the last capture is returned.
 func (t *TmuxSession) CapturePaneContent() (string, error) {
+	t.captureMu.Lock()
+	defer t.captureMu.Unlock()
+
+	// The count is taken before capturing, so output while capturing is captured the next time.
+	seq, watched := uint64(0), false
+	if t.control != nil && t.paneID != "" {
+		seq, watched = t.control.outputSeq(t.paneID)
+	}
+	if watched && t.capturedStored && seq == t.capturedSeq {
+		return t.captured, nil
+	}
+
 	// Check if session exists first
 	if !t.DoesSessionExist() {
 		return "", fmt.Errorf("tmux session '%s' does not exist", t.sanitizedName)
 	}
 
 	// Add -e flag to preserve escape sequences (ANSI color codes)
-	cmd := exec.Command("tmux", "capture-pane", "-p", "-e", "-J", "-t", t.sanitizedName)
+	cmd := t.server.command("capture-pane", "-p", "-e", "-J", "-t", t.sanitizedName)
 	output, err := t.cmdExec.Output(cmd)
 	if err != nil {
 		return "", fmt.Errorf("error capturing pane content for session '%s': %v", t.sanitizedName, err)
 	}
-	return string(output), nil
+	t.captured, t.capturedSeq, t.capturedStored = string(output), seq, watched
+	return t.captured, nil
 }
 
 // CapturePaneContentWithOptions captures the pane content with additional options
 // start and end specify the starting and ending line numbers (use "-" for the start/end of history)
 func (t *TmuxSession) CapturePaneContentWithOptions(start, end string) (string, error) {
 	// Add -e flag to preserve escape sequences (ANSI color codes)
-	cmd := exec.Command("tmux", "capture-pane", "-p", "-e", "-J", "-S", start, "-E", end, "-t", t.sanitizedName)
+	cmd := t.server.command("capture-pane", "-p", "-e", "-J", "-S", start, "-E", end, "-t", t.sanitizedName)
 	output, err := t.cmdExec.Output(cmd)
 	if err != nil {
 		return "", fmt.Errorf("failed to capture tmux pane content with options: %v", err)
 	}
 	return string(output), nil
 }
-
-// CleanupSessions kills all tmux sessions that start with "session-"
-func CleanupSessions(cmdExec cmd.Executor) error {
-	// First try to list sessions
-	cmd := exec.Command("tmux", "ls")
-	output, err := cmdExec.Output(cmd)
-
-	// If there's an error and it's because no server is running, that's fine
-	// Exit code 1 typically means no sessions exist
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			return nil // No sessions to clean up
-		}
-		return fmt.Errorf("failed to list tmux sessions: %v", err)
-	}
-
-	re := regexp.MustCompile(fmt.Sprintf(`%s.*:`, TmuxPrefix))
-	matches := re.FindAllString(string(output), -1)
-	for i, match := range matches {
-		matches[i] = match[:strings.Index(match, ":")]
-	}
-
-	for _, match := range matches {
-		log.InfoLog.Printf("cleaning up session: %s", match)
-		if err := cmdExec.Run(exec.Command("tmux", "kill-session", "-t", match)); err != nil {
-			return fmt.Errorf("failed to kill tmux session %s: %v", match, err)
-		}
-	}
-	return nil
-}
@@ -42,13 +42,26 @@ func NewMockPtyFactory(t *testing.T) *MockPtyFactory {
 }
 
 func TestSanitizeName(t *testing.T) {
-	session := NewTmuxSession("asdf", "program")
+	session := NewTmuxSession("asdf", "program", "")
 	require.Equal(t, TmuxPrefix+"asdf", session.sanitizedName)
 
-	session = NewTmuxSession("a sd f . . asdf", "program")
+	session = NewTmuxSession("a sd f . . asdf", "program", "")
 	require.Equal(t, TmuxPrefix+"asdf__asdf", session.sanitizedName)
 }
 
+func TestServerFor(t *testing.T) {
+	require.Equal(t, []string{"-L", DefaultSocket}, serverFor("/src/app").args())
+
+	socketPerRepo = true
+	defer func() { socketPerRepo = false }()
+	s := serverFor("/src/my app")
+	require.Regexp(t, `^agentfarmer-my_app-[0-9a-f]{8}$`, s.socket)
+	require.NotEqual(t, s, serverFor("/other/my app"))
+	require.Equal(t, server{socket: DefaultSocket}, serverFor(""))
+
+	require.Equal(t, []string{"new-session"}, withoutServerArgs([]string{"-S", "/tmp/af.sock", "-f", "tmux.conf", "new-session"}))
+}
+
 func TestStartTmuxSession(t *testing.T) {
 	ptyFactory := NewMockPtyFactory(t)
 
@@ -72,9 +85,10 @@ func TestStartTmuxSession(t *testing.T) {
 	err := session.Start(workdir)
 	require.NoError(t, err)
 	require.Equal(t, 2, len(ptyFactory.cmds))
-	require.Equal(t, fmt.Sprintf("tmux new-session -d -s agentfarmer_test-session -c %s claude", workdir),
+	require.Equal(t, fmt.Sprintf("tmux -L agentfarmer new-session -d -s agentfarmer_test-session -c %s claude ; "+
+		"set-option -t agentfarmer_test-session remain-on-exit on", workdir),
 		cmd2.ToString(ptyFactory.cmds[0]))
-	require.Equal(t, "tmux attach-session -t agentfarmer_test-session",
+	require.Equal(t, "tmux -L agentfarmer attach-session -t agentfarmer_test-session",
 		cmd2.ToString(ptyFactory.cmds[1]))
 
 	require.Equal(t, 2, len(ptyFactory.files))
@@ -86,3 +100,27 @@ func TestStartTmuxSession(t *testing.T) {
 	_, err = ptyFactory.files[1].Stat()
 	require.NoError(t, err)
 }
+
+func TestStartWindows(t *testing.T) {
+	var ran []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			ran = append(ran, cmd2.ToString(cmd))
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			return []byte("claude\ndev\n"), nil
+		},
+	}
+
+	session := newTmuxSession("test-session", "claude", NewMockPtyFactory(t), cmdExec)
+	windows := []Window{{Name: "dev", Command: "npm run dev"}, {Name: "shell"}}
+	require.NoError(t, session.StartWindows(windows, "/work"))
+	// Only the missing window is created, then both are sized like the agent's window.
+	require.Equal(t, []string{
+		"tmux -L agentfarmer new-window -d -t =agentfarmer_test-session: -n shell -c /work ; " +
+			"set-option -w -t =agentfarmer_test-session:=shell remain-on-exit on",
+		"tmux -L agentfarmer resize-window -A -t =agentfarmer_test-session:=dev",
+		"tmux -L agentfarmer resize-window -A -t =agentfarmer_test-session:=shell",
+	}, ran)
+}
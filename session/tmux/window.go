@@ -0,0 +1,119 @@
+package tmux
+
+import (
+	"agent-farmer/log"
+	"fmt"
+	"strings"
+)
+
+// Window is an auxiliary window of a session, next to the agent's window, e.g. running a dev server or tests.
+type Window struct {
+	Name string
+	// Command is the command the window runs, the default shell if it's empty.
+	Command string
+}
+
+// windowTarget returns the target of the window name of the session.
+func (t *TmuxSession) windowTarget(name string) string {
+	return fmt.Sprintf("=%s:=%s", t.sanitizedName, name)
+}
+
+// StartWindows creates the windows that don't exist in the session yet. They run in workDir and are kept when their
+// command exits, so its output can still be seen.
+func (t *TmuxSession) StartWindows(windows []Window, workDir string) error {
+	t.windows = windows
+
+	output, err := t.cmdExec.Output(t.server.command("list-windows", "-t", "="+t.sanitizedName, "-F", "#{window_name}"))
+	if err != nil {
+		return fmt.Errorf("error listing windows of session '%s': %v", t.sanitizedName, err)
+	}
+	existing := make(map[string]bool)
+	for _, name := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		existing[name] = true
+	}
+
+	for _, window := range windows {
+		if existing[window.Name] {
+			continue
+		}
+		// The window is created in the background, so the agent's window stays the current one.
+		args := []string{"new-window", "-d", "-t", "=" + t.sanitizedName + ":", "-n", window.Name, "-c", workDir}
+		if window.Command != "" {
+			args = append(args, window.Command)
+		}
+		args = append(args, ";", "set-option", "-w", "-t", t.windowTarget(window.Name), "remain-on-exit", "on")
+		if err := t.cmdExec.Run(t.server.command(args...)); err != nil {
+			return fmt.Errorf("error creating window %s: %w", window.Name, err)
+		}
+	}
+	t.resizeWindows()
+	return nil
+}
+
+// RespawnWindow runs the command of window in its window instead of what runs there, e.g. a shell.
+func (t *TmuxSession) RespawnWindow(window Window, workDir string) error {
+	args := []string{"respawn-window", "-k", "-t", t.windowTarget(window.Name), "-c", workDir}
+	if window.Command != "" {
+		args = append(args, window.Command)
+	}
+	if err := t.cmdExec.Run(t.server.command(args...)); err != nil {
+		return fmt.Errorf("error respawning window %s: %w", window.Name, err)
+	}
+	return nil
+}
+
+// resizeWindows sizes the windows like the agent's window. Only the agent's window is shown by the session's client,
+// so tmux doesn't size the others.
+func (t *TmuxSession) resizeWindows() {
+	for _, window := range t.windows {
+		if err := t.cmdExec.Run(t.server.command("resize-window", "-A", "-t", t.windowTarget(window.Name))); err != nil {
+			log.WarningLog.Printf("could not resize window %s of %s: %v", window.Name, t.sanitizedName, err)
+		}
+	}
+}
+
+// CaptureWindowContent captures the content of the window name.
+func (t *TmuxSession) CaptureWindowContent(name string) (string, error) {
+	cmd := t.server.command("capture-pane", "-p", "-e", "-J", "-t", t.windowTarget(name))
+	output, err := t.cmdExec.Output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error capturing window %s of session '%s': %v", name, t.sanitizedName, err)
+	}
+	return string(output), nil
+}
+
+// AttachWindow attaches to the window name. It's shown by a session grouped with this one, so the agent's window stays
+// the current one of the session and the prompts sent to the agent don't go to the window. The grouped session goes
+// away on Detach. If the window's command exited, it's run again.
+func (t *TmuxSession) AttachWindow(name string) (chan AttachResult, error) {
+	target := t.windowTarget(name)
+	output, err := t.cmdExec.Output(t.server.command("display-message", "-p", "-t", target, "#{pane_dead}"))
+	if err != nil {
+		return nil, fmt.Errorf("error finding window %s: %w", name, err)
+	}
+	if strings.TrimSpace(string(output)) == "1" {
+		if err := t.cmdExec.Run(t.server.command("respawn-pane", "-t", target)); err != nil {
+			return nil, fmt.Errorf("error respawning window %s: %w", name, err)
+		}
+	}
+	// resizeWindows fixed the window's size, let it follow the terminal while attached.
+	if err := t.cmdExec.Run(t.server.command("set-option", "-w", "-u", "-t", target, "window-size")); err != nil {
+		log.WarningLog.Printf("could not reset size of window %s: %v", name, err)
+	}
+
+	view := fmt.Sprintf("%s~%s", t.sanitizedName, name)
+	// A grouped session left behind, e.g. by a crash, shares the windows. Killing it leaves them alone.
+	if t.cmdExec.Run(t.server.command("has-session", "-t", "="+view)) == nil {
+		if err := t.cmdExec.Run(t.server.command("kill-session", "-t", "="+view)); err != nil {
+			log.WarningLog.Printf("could not kill the leftover session %s: %v", view, err)
+		}
+	}
+	ptmx, err := t.ptyFactory.Start(t.server.command("new-session", "-t", "="+t.sanitizedName, "-s", view,
+		";", "set-option", "-t", "="+view+":", "destroy-unattached", "on",
+		";", "select-window", "-t", fmt.Sprintf("=%s:=%s", view, name)))
+	if err != nil {
+		return nil, fmt.Errorf("error opening PTY: %w", err)
+	}
+	t.sessionPtmx, t.ptmx = t.ptmx, ptmx
+	return t.Attach()
+}
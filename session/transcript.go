@@ -0,0 +1,133 @@
+package session
+
+import (
+	"agent-farmer/config"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// transcriptDirName is the directory in the config dir that transcripts are saved to.
+const transcriptDirName = "transcripts"
+
+// TranscriptPath returns the path the transcript of the instance with the given title is saved to.
+func TranscriptPath(title string) (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, transcriptDirName, fileName(title)+".log"), nil
+}
+
+// fileName turns a title, which may contain path separators, into a file name.
+func fileName(title string) string {
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(title)
+}
+
+// Transcript returns the full scrollback of the instance's pane, without escape sequences.
+func (i *Instance) Transcript() (string, error) {
+	if !i.started || i.Status == Paused || (i.Status == Exited && !i.TmuxAlive()) {
+		return "", nil
+	}
+	content, err := i.tmuxSession.CapturePaneContentWithOptions("-", "-")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(ansi.Strip(content), "\n"), nil
+}
+
+// SaveTranscript appends the instance's scrollback to its transcript file. The scrollback is lost when the tmux
+// session is closed, so this is called right before that, e.g. when the instance is paused or killed.
+func (i *Instance) SaveTranscript(event string) error {
+	content, err := i.Transcript()
+	if err != nil {
+		return fmt.Errorf("failed to capture transcript: %w", err)
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	return appendTranscript(i.Title, fmt.Sprintf("=== %s %s at %s ===", i.Title, event, time.Now().Format(time.RFC3339)), content)
+}
+
+func appendTranscript(title string, header string, content string) error {
+	path, err := TranscriptPath(title)
+	if err != nil {
+		return err
+	}
+	return appendLog(path, header, content)
+}
+
+// appendLog appends content under header to the log file at path, creating it if needed.
+func appendLog(path string, header string, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s\n%s\n\n", header, content); err != nil {
+		return fmt.Errorf("failed to write log: %w", err)
+	}
+	return nil
+}
+
+// rotateLogs renames the transcript and hook log left by an earlier session with the same title, so that a new
+// session starts with logs of its own and archiving it doesn't pick up the old scrollback. The old logs are kept next
+// to the new ones, named after when they were last written to.
+func rotateLogs(title string) error {
+	transcriptPath, err := TranscriptPath(title)
+	if err != nil {
+		return err
+	}
+	hookLogPath, err := HookLogPath(title)
+	if err != nil {
+		return err
+	}
+	return errors.Join(rotateLog(transcriptPath), rotateLog(hookLogPath))
+}
+
+// rotateLog renames the log file at path, if there is one, e.g. from feature.log to feature.20250102-150405.log.
+func rotateLog(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rotate log: %w", err)
+	}
+	base := strings.TrimSuffix(path, ".log") + "." + info.ModTime().Format("20060102-150405")
+	rotated := base + ".log"
+	for n := 2; ; n++ {
+		if _, err := os.Stat(rotated); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		rotated = fmt.Sprintf("%s-%d.log", base, n)
+	}
+	if err := os.Rename(path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate log: %w", err)
+	}
+	return nil
+}
+
+// LoadTranscript returns the saved transcript of the instance with the given title, or "" if none was saved.
+func LoadTranscript(title string) (string, error) {
+	path, err := TranscriptPath(title)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read transcript: %w", err)
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
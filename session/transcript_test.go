@@ -0,0 +1,39 @@
+package session
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscript(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	transcript, err := LoadTranscript("feature/x")
+	require.NoError(t, err)
+	require.Empty(t, transcript)
+
+	// Titles can contain slashes, the transcript still goes in the transcript directory.
+	path, err := TranscriptPath("feature/x")
+	require.NoError(t, err)
+	require.Equal(t, "feature_x.log", filepath.Base(path))
+
+	// Each save is appended, so pausing and later killing keeps both scrollbacks.
+	require.NoError(t, appendTranscript("feature/x", "=== paused ===", "$ make test\nok"))
+	require.NoError(t, appendTranscript("feature/x", "=== killed ===", "$ git push"))
+	transcript, err = LoadTranscript("feature/x")
+	require.NoError(t, err)
+	require.Equal(t, "=== paused ===\n$ make test\nok\n\n=== killed ===\n$ git push", transcript)
+
+	// A new session with the same title starts a transcript of its own, the old one is kept.
+	require.NoError(t, rotateLogs("feature/x"))
+	transcript, err = LoadTranscript("feature/x")
+	require.NoError(t, err)
+	require.Empty(t, transcript)
+	require.NoError(t, appendTranscript("feature/x", "=== paused ===", "$ make lint"))
+	require.NoError(t, rotateLogs("feature/x"))
+	rotated, err := filepath.Glob(filepath.Join(filepath.Dir(path), "feature_x.*.log"))
+	require.NoError(t, err)
+	require.Len(t, rotated, 2)
+}
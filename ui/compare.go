@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"agent-farmer/session"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxComparedFiles is the number of changed files listed per attempt in the comparison.
+const maxComparedFiles = 10
+
+var compareHeaderStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#7D56F4"))
+
+var compareColumnStyle = lipgloss.NewStyle().
+	Border(lipgloss.NormalBorder(), false, true, false, false).
+	BorderForeground(lipgloss.AdaptiveColor{Light: "#DDDADA", Dark: "#3C3C3C"}).
+	Padding(0, 1)
+
+// RenderComparison renders the attempts of a fan-out side by side with their status, diff stats and changed files.
+// width is the total width available.
+func RenderComparison(group string, attempts []*session.Instance, width int) string {
+	if len(attempts) == 0 {
+		return ""
+	}
+	// Account for the border and padding of each column.
+	colWidth := width/len(attempts) - 3
+	if colWidth < 12 {
+		colWidth = 12
+	}
+
+	columns := make([]string, 0, len(attempts))
+	for i, attempt := range attempts {
+		lines := []string{
+			compareHeaderStyle.Render(truncate(fmt.Sprintf("%d. %s", i+1, attempt.Title), colWidth)),
+			pausedStyle.Render(truncate(attempt.Program, colWidth)),
+			attempt.Status.String(),
+			"",
+		}
+
+		stats := attempt.GetDiffStats()
+		switch {
+		case stats == nil:
+			lines = append(lines, pausedStyle.Render("no diff yet"))
+		case stats.Error != nil:
+			lines = append(lines, removedLinesStyle.Render(truncate(stats.Error.Error(), colWidth)))
+		default:
+			files := stats.Files()
+			lines = append(lines,
+				addedLinesStyle.Render(fmt.Sprintf("+%d", stats.Added))+","+
+					removedLinesStyle.Render(fmt.Sprintf("-%d", stats.Removed)),
+				fmt.Sprintf("%d files changed", len(files)),
+			)
+			for n, file := range files {
+				if n == maxComparedFiles {
+					lines = append(lines, pausedStyle.Render(fmt.Sprintf("... %d more", len(files)-n)))
+					break
+				}
+				lines = append(lines, truncate(file, colWidth))
+			}
+		}
+
+		style := compareColumnStyle.Width(colWidth + 2)
+		if i == len(attempts)-1 {
+			style = style.BorderRight(false)
+		}
+		columns = append(columns, style.Render(strings.Join(lines, "\n")))
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		compareHeaderStyle.Underline(true).Render(fmt.Sprintf("Fan-out: %s", group)),
+		"",
+		lipgloss.JoinHorizontal(lipgloss.Top, columns...),
+		"",
+		pausedStyle.Render("Select an attempt and press W to keep it and kill the rest."),
+	)
+}
+
+// truncate cuts s to at most width runes, ending it with "..." if it was cut.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width || width <= 3 {
+		return s
+	}
+	return string(runes[:width-3]) + "..."
+}
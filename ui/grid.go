@@ -0,0 +1,205 @@
+package ui
+
+import (
+	"agent-farmer/session"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// GridLayout is how the preview arranges the panes of several instances.
+type GridLayout int
+
+const (
+	// GridOff shows only the selected instance.
+	GridOff GridLayout = iota
+	// GridAuto fits the running instances into as square a grid as possible, up to maxGridTiles.
+	GridAuto
+	// Grid2x2 shows four instances in two columns and two rows.
+	Grid2x2
+	// Grid3x1 shows three instances side by side.
+	Grid3x1
+)
+
+// maxGridTiles is the most instances GridAuto shows at once.
+const maxGridTiles = 9
+
+func (g GridLayout) String() string {
+	switch g {
+	case GridAuto:
+		return "auto"
+	case Grid2x2:
+		return "2x2"
+	case Grid3x1:
+		return "3x1"
+	default:
+		return "off"
+	}
+}
+
+// dims returns the columns and rows of the layout for n instances.
+func (g GridLayout) dims(n int) (cols, rows int) {
+	switch g {
+	case Grid2x2:
+		return 2, 2
+	case Grid3x1:
+		return 3, 1
+	}
+	n = min(max(n, 1), maxGridTiles)
+	cols = int(math.Ceil(math.Sqrt(float64(n))))
+	return cols, (n + cols - 1) / cols
+}
+
+var (
+	tileStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.AdaptiveColor{Light: "#DDDADA", Dark: "#3C3C3C"})
+	focusedTileStyle = tileStyle.BorderForeground(highlightColor)
+	tileTitleStyle   = lipgloss.NewStyle().Bold(true)
+)
+
+// gridTile is an instance shown in the grid and the content of its pane.
+type gridTile struct {
+	instance *session.Instance
+	content  string
+}
+
+// GridPane shows the panes of several instances at once, each in a tile with a status header. The tile of the
+// selected instance is focused.
+type GridPane struct {
+	layout GridLayout
+	width  int
+	height int
+
+	tiles   []gridTile
+	focused *session.Instance
+	// running is the number of instances the grid could show, which the auto layout is fitted to.
+	running int
+}
+
+func NewGridPane() *GridPane {
+	return &GridPane{}
+}
+
+func (g *GridPane) SetSize(width, height int) {
+	g.width = width
+	g.height = height
+}
+
+// Layout returns the layout of the grid, GridOff if the grid isn't shown.
+func (g *GridPane) Layout() GridLayout {
+	return g.layout
+}
+
+// CycleLayout switches to the next layout, going back to GridOff after the last one.
+func (g *GridPane) CycleLayout() {
+	g.layout = (g.layout + 1) % (Grid3x1 + 1)
+}
+
+// TileSize returns the size of the pane in a tile, without its border and header.
+func (g *GridPane) TileSize() (width, height int) {
+	cols, rows := g.layout.dims(g.running)
+	width = g.width/cols - tileStyle.GetHorizontalFrameSize()
+	height = g.height/rows - tileStyle.GetVerticalFrameSize() - 1
+	return max(width, 1), max(height, 1)
+}
+
+// UpdateContent shows the instances that fit in the grid, out of the shown ones, starting with the page that has the
+// selected instance. Instances that aren't running are left out.
+func (g *GridPane) UpdateContent(instances []*session.Instance, selected *session.Instance) error {
+	var running []*session.Instance
+	for _, instance := range instances {
+		if instance.Started() && !instance.Paused() && instance.TmuxAlive() {
+			running = append(running, instance)
+		}
+	}
+	g.focused = selected
+	g.running = len(running)
+
+	cols, rows := g.layout.dims(len(running))
+	page := cols * rows
+	start := 0
+	for i, instance := range running {
+		if instance == selected {
+			start = i / page * page
+		}
+	}
+
+	g.tiles = g.tiles[:0]
+	var errs []error
+	for _, instance := range running[start:min(start+page, len(running))] {
+		content, err := instance.Preview()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not preview %s: %w", instance.Title, err))
+		}
+		g.tiles = append(g.tiles, gridTile{instance: instance, content: content})
+	}
+	return errors.Join(errs...)
+}
+
+func (g *GridPane) String() string {
+	if len(g.tiles) == 0 {
+		return previewPaneStyle.Width(g.width).Align(lipgloss.Center).
+			Render("No running agents to show. Press 'v' to leave the grid.")
+	}
+
+	cols, _ := g.layout.dims(g.running)
+	width, height := g.TileSize()
+	var rows []string
+	for start := 0; start < len(g.tiles); start += cols {
+		var row []string
+		for _, tile := range g.tiles[start:min(start+cols, len(g.tiles))] {
+			row = append(row, g.renderTile(tile, width, height))
+		}
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, row...))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, rows...)
+}
+
+// renderTile renders the header and the pane content of the tile, cut to width and height.
+func (g *GridPane) renderTile(tile gridTile, width, height int) string {
+	status := tile.instance.Status.String()
+	if tile.instance.AutoYes {
+		status += " · auto-yes"
+	}
+	header := tileTitleStyle.Render(truncate(tile.instance.Title, max(width-lipgloss.Width(status)-1, 1))) + " " +
+		statusStyle(tile.instance.Status).Render(status)
+
+	lines := strings.Split(strings.TrimRight(tile.content, "\n"), "\n")
+	// The end of the pane is the most recent output.
+	if len(lines) > height {
+		lines = lines[len(lines)-height:]
+	}
+	for i, line := range lines {
+		lines[i] = ansi.Truncate(line, width, "")
+		// Colors left on at the end of a line would spill into the tile next to it.
+		if strings.Contains(lines[i], "\x1b[") {
+			lines[i] += "\x1b[0m"
+		}
+	}
+	lines = append(lines, make([]string, height-len(lines))...)
+
+	style := tileStyle
+	if tile.instance == g.focused {
+		style = focusedTileStyle
+	}
+	return style.Width(width).Render(header + "\n" + strings.Join(lines, "\n"))
+}
+
+// statusStyle returns the style of the status of an instance in the grid.
+func statusStyle(status session.Status) lipgloss.Style {
+	switch status {
+	case session.Ready:
+		return readyStyle
+	case session.AwaitingApproval, session.RateLimited:
+		return attentionStyle
+	case session.Errored, session.Exited:
+		return erroredStyle
+	default:
+		return pausedStyle
+	}
+}
@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"agent-farmer/session"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var historyHeaderStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#0ea5e9")).Bold(true)
+
+// HistoryPane shows the prompts sent to an instance, most recent first.
+type HistoryPane struct {
+	viewport viewport.Model
+	width    int
+	height   int
+
+	// title is the title of the instance whose history is shown, so switching instances scrolls back to the top.
+	title string
+	// history is the history last rendered, so SetSize can re-render it.
+	history []session.HistoryEntry
+}
+
+func NewHistoryPane() *HistoryPane {
+	return &HistoryPane{
+		viewport: viewport.New(0, 0),
+	}
+}
+
+func (h *HistoryPane) SetSize(width, height int) {
+	h.width = width
+	h.height = height
+	h.viewport.Width = width
+	h.viewport.Height = height
+	h.render()
+}
+
+// SetHistory shows the history of instance. instance may be nil.
+func (h *HistoryPane) SetHistory(instance *session.Instance) {
+	title := ""
+	h.history = nil
+	if instance != nil {
+		title = instance.Title
+		h.history = instance.History
+	}
+	if title != h.title {
+		h.title = title
+		h.viewport.GotoTop()
+	}
+	h.render()
+}
+
+func (h *HistoryPane) render() {
+	if len(h.history) == 0 {
+		h.viewport.SetContent(lipgloss.Place(h.width, h.height, lipgloss.Center, lipgloss.Center,
+			"No prompts sent yet. Press 's' to send one."))
+		return
+	}
+
+	prompt := lipgloss.NewStyle().Width(h.width)
+	var b strings.Builder
+	for n := len(h.history) - 1; n >= 0; n-- {
+		entry := h.history[n]
+		b.WriteString(historyHeaderStyle.Render(fmt.Sprintf("#%d  %s", n+1, entry.SentAt.Format("Jan 2 15:04"))))
+		b.WriteString("\n")
+		b.WriteString(prompt.Render(entry.Prompt))
+		b.WriteString("\n\n")
+	}
+	h.viewport.SetContent(b.String())
+}
+
+func (h *HistoryPane) String() string {
+	return h.viewport.View()
+}
+
+// ScrollUp scrolls the viewport up
+func (h *HistoryPane) ScrollUp() {
+	h.viewport.LineUp(1)
+}
+
+// ScrollDown scrolls the viewport down
+func (h *HistoryPane) ScrollDown() {
+	h.viewport.LineDown(1)
+}
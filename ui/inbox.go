@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"agent-farmer/session"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxInboxPromptLines is the number of lines of an approval prompt shown in the inbox.
+const maxInboxPromptLines = 6
+
+var (
+	inboxStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("62")).
+			Padding(1, 2)
+	inboxItemStyle = lipgloss.NewStyle().
+			Border(lipgloss.NormalBorder(), false, false, false, true).
+			BorderForeground(lipgloss.AdaptiveColor{Light: "#DDDADA", Dark: "#3C3C3C"}).
+			PaddingLeft(1)
+	selectedInboxItemStyle = inboxItemStyle.BorderForeground(highlightColor)
+)
+
+// Inbox lists the instances waiting for their agent's permission prompt to be answered, with what each one asks to
+// approve, so they can be answered without attaching.
+type Inbox struct {
+	items    []*session.Instance
+	selected int
+	width    int
+	height   int
+}
+
+func NewInbox() *Inbox {
+	return &Inbox{}
+}
+
+func (b *Inbox) SetSize(width, height int) {
+	b.width = width
+	b.height = height
+}
+
+// Update lists the instances that are awaiting approval, keeping the selected one selected if it still is.
+func (b *Inbox) Update(instances []*session.Instance) {
+	selected := b.Selected()
+	b.items = b.items[:0]
+	b.selected = 0
+	for _, instance := range instances {
+		if instance.Status != session.AwaitingApproval {
+			continue
+		}
+		if instance == selected {
+			b.selected = len(b.items)
+		}
+		b.items = append(b.items, instance)
+	}
+}
+
+// Selected returns the selected instance, or nil if no instance is waiting.
+func (b *Inbox) Selected() *session.Instance {
+	if b.selected >= len(b.items) {
+		return nil
+	}
+	return b.items[b.selected]
+}
+
+func (b *Inbox) Up() {
+	if b.selected > 0 {
+		b.selected--
+	}
+}
+
+func (b *Inbox) Down() {
+	if b.selected < len(b.items)-1 {
+		b.selected++
+	}
+}
+
+func (b *Inbox) String() string {
+	// lipgloss widths include the padding but not the border.
+	width := max(b.width-inboxStyle.GetHorizontalBorderSize(), 30)
+	header := compareHeaderStyle.Underline(true).Render(fmt.Sprintf("Waiting for approval (%d)", len(b.items)))
+	footer := pausedStyle.Render("y approve • n deny • m deny with message • j/k move • esc close")
+	if len(b.items) == 0 {
+		return inboxStyle.Width(width).Render(header + "\n\n" + "No sessions are waiting for approval.\n\n" + footer)
+	}
+
+	itemWidth := width - inboxStyle.GetHorizontalPadding() - inboxItemStyle.GetHorizontalFrameSize()
+	// Leave room for the header, the footer and the blank lines around them.
+	available := b.height - inboxStyle.GetVerticalFrameSize() - 4
+	start := b.scrollStart()
+	var rendered []string
+	used := 0
+	for i, instance := range b.items[start:] {
+		lines := []string{
+			tileTitleStyle.Render(truncate(instance.Title, itemWidth-len(instance.Program)-1)) + " " +
+				pausedStyle.Render(instance.Program),
+		}
+		prompt := strings.Split(instance.ApprovalPrompt(), "\n")
+		if len(prompt) > maxInboxPromptLines {
+			prompt = append(prompt[:maxInboxPromptLines-1], "...")
+		}
+		for _, line := range prompt {
+			lines = append(lines, truncate(line, itemWidth))
+		}
+
+		style := inboxItemStyle
+		if start+i == b.selected {
+			style = selectedInboxItemStyle
+		}
+		item := style.Width(itemWidth + inboxItemStyle.GetHorizontalPadding()).Render(strings.Join(lines, "\n"))
+		if used > 0 && used+lipgloss.Height(item)+1 > available {
+			break
+		}
+		used += lipgloss.Height(item) + 1
+		rendered = append(rendered, item)
+	}
+	return inboxStyle.Width(width).Render(header + "\n\n" + strings.Join(rendered, "\n\n") + "\n\n" + footer)
+}
+
+// scrollStart returns the first item shown, so the selected one stays in view when the list doesn't fit.
+func (b *Inbox) scrollStart() int {
+	// Every item takes at least its title, a line of prompt and a blank line.
+	perPage := max((b.height-inboxStyle.GetVerticalFrameSize()-4)/(maxInboxPromptLines+2), 1)
+	return max(b.selected-perPage+1, 0)
+}
@@ -3,8 +3,11 @@ package ui
 import (
 	"agent-farmer/log"
 	"agent-farmer/session"
+	"agent-farmer/session/tmux"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -13,6 +16,14 @@ import (
 
 const readyIcon = "● "
 const pausedIcon = "⏸ "
+const pendingIcon = "◌ "
+const approvalIcon = "? "
+const rateLimitedIcon = "◔ "
+const erroredIcon = "✗ "
+const exitedIcon = "■ "
+const queuedIcon = "⋯"
+const expandedIcon = "▾"
+const collapsedIcon = "▸"
 
 var readyStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#51bd73", Dark: "#51bd73"})
@@ -26,6 +37,13 @@ var removedLinesStyle = lipgloss.NewStyle().
 var pausedStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#888888", Dark: "#888888"})
 
+var attentionStyle = lipgloss.NewStyle().
+	Bold(true).
+	Foreground(lipgloss.AdaptiveColor{Light: "#d79921", Dark: "#FFD700"})
+
+var erroredStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#de613e"))
+
 var titleStyle = lipgloss.NewStyle().
 	Padding(1, 1, 0, 1).
 	Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"})
@@ -44,6 +62,22 @@ var selectedDescStyle = lipgloss.NewStyle().
 	Background(lipgloss.Color("#dde4f0")).
 	Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#1a1a1a"})
 
+var queueTitle = lipgloss.NewStyle().
+	Background(lipgloss.AdaptiveColor{Light: "#888888", Dark: "#555555"}).
+	Foreground(lipgloss.Color("230"))
+
+var groupHeaderStyle = lipgloss.NewStyle().
+	Padding(0, 1).
+	Bold(true).
+	Foreground(lipgloss.Color("62"))
+
+var selectedGroupHeaderStyle = groupHeaderStyle.
+	Background(lipgloss.Color("#dde4f0"))
+
+var filterStyle = lipgloss.NewStyle().
+	Padding(0, 1).
+	Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"})
+
 var mainTitle = lipgloss.NewStyle().
 	Background(lipgloss.Color("62")).
 	Foreground(lipgloss.Color("230"))
@@ -52,24 +86,71 @@ var autoYesStyle = lipgloss.NewStyle().
 	Background(lipgloss.Color("#dde4f0")).
 	Foreground(lipgloss.Color("#1a1a1a"))
 
+// GroupBy is how the list groups instances.
+type GroupBy string
+
+const (
+	GroupByNone    GroupBy = ""
+	GroupByProject GroupBy = "project"
+	GroupByRepo    GroupBy = "repo"
+	GroupByTag     GroupBy = "tag"
+	GroupByStatus  GroupBy = "status"
+	GroupByFanOut  GroupBy = "fan-out"
+)
+
+// groupByModes is the order CycleGroupBy goes through.
+var groupByModes = []GroupBy{GroupByNone, GroupByProject, GroupByRepo, GroupByTag, GroupByStatus, GroupByFanOut}
+
+// noGroup is the group of instances without a project, tag or fan-out group.
+const noGroup = "(none)"
+
+// listRow is a line of the list, either a group header or an instance. Instances with several tags have a row in
+// each of their groups.
+type listRow struct {
+	// group is the group of the row. It's empty when the list isn't grouped.
+	group string
+	// instance is nil for group headers.
+	instance *session.Instance
+	// count is the number of instances in the group. Only set for headers.
+	count int
+}
+
 type List struct {
-	items         []*session.Instance
-	selectedIdx   int
+	items []*session.Instance
+	// selected identifies the selected row. Rows are derived from the items on every use, since the status and the
+	// filter change which rows there are.
+	selected      listRow
 	height, width int
 	renderer      *InstanceRenderer
 	autoyes       bool
 
+	// filter narrows the list to instances whose title, branch, tags or project contain it.
+	filter string
+	// filtering is true while the filter is being typed.
+	filtering bool
+	// groupBy is how the instances are grouped.
+	groupBy GroupBy
+	// collapsed are the names of the collapsed groups.
+	collapsed map[string]bool
+
 	// map of repo name to number of instances using it. Used to display the repo name only if there are
 	// multiple repos in play.
 	repos map[string]int
+
+	// queued are the prompts waiting for a free slot. They're shown below the instances but can't be selected.
+	queued []session.QueuedPrompt
+	// starting is the title of the instance being started, which isn't in the list until it's started. It's shown
+	// below the instances but can't be selected.
+	starting string
 }
 
 func NewList(spinner *spinner.Model, autoYes bool) *List {
 	return &List{
-		items:    []*session.Instance{},
-		renderer: &InstanceRenderer{spinner: spinner},
-		repos:    make(map[string]int),
-		autoyes:  autoYes,
+		items:     []*session.Instance{},
+		renderer:  &InstanceRenderer{spinner: spinner},
+		repos:     make(map[string]int),
+		autoyes:   autoYes,
+		collapsed: make(map[string]bool),
 	}
 }
 
@@ -81,14 +162,19 @@ func (l *List) SetSize(width, height int) {
 }
 
 // SetSessionPreviewSize sets the height and width for the tmux sessions. This makes the stdout line have the correct
-// width and height.
-func (l *List) SetSessionPreviewSize(width, height int) (err error) {
+// width and height. With windowSwitcher, a line is left for the preview's window switcher above the panes of
+// instances with windows.
+func (l *List) SetSessionPreviewSize(width, height int, windowSwitcher bool) (err error) {
 	for i, item := range l.items {
 		if !item.Started() || item.Paused() {
 			continue
 		}
 
-		if innerErr := item.SetPreviewSize(width, height); innerErr != nil {
+		itemHeight := height
+		if windowSwitcher && len(item.Windows) > 0 {
+			itemHeight--
+		}
+		if innerErr := item.SetPreviewSize(width, itemHeight); innerErr != nil {
 			err = errors.Join(
 				err, fmt.Errorf("could not set preview size for instance %d: %v", i, innerErr))
 		}
@@ -96,6 +182,19 @@ func (l *List) SetSessionPreviewSize(width, height int) (err error) {
 	return
 }
 
+// VisibleInstances returns the instances shown in the list, in the order they're shown.
+func (l *List) VisibleInstances() []*session.Instance {
+	var instances []*session.Instance
+	seen := make(map[*session.Instance]bool)
+	for _, row := range l.rows() {
+		if row.instance != nil && !seen[row.instance] {
+			seen[row.instance] = true
+			instances = append(instances, row.instance)
+		}
+	}
+	return instances
+}
+
 func (l *List) NumInstances() int {
 	return len(l.items)
 }
@@ -134,6 +233,16 @@ func (r *InstanceRenderer) Render(i *session.Instance, idx int, selected bool, h
 		join = readyStyle.Render(readyIcon)
 	case session.Paused:
 		join = pausedStyle.Render(pausedIcon)
+	case session.Pending:
+		join = pausedStyle.Render(pendingIcon)
+	case session.AwaitingApproval:
+		join = attentionStyle.Render(approvalIcon)
+	case session.RateLimited:
+		join = attentionStyle.Render(rateLimitedIcon)
+	case session.Errored:
+		join = erroredStyle.Render(erroredIcon)
+	case session.Exited:
+		join = erroredStyle.Render(exitedIcon)
 	default:
 	}
 
@@ -223,7 +332,10 @@ func (r *InstanceRenderer) Render(i *session.Instance, idx int, selected bool, h
 }
 
 func (l *List) String() string {
-	const titleText = " Instances "
+	titleText := " Instances "
+	if l.groupBy != GroupByNone {
+		titleText = fmt.Sprintf(" Instances by %s ", l.groupBy)
+	}
 	const autoYesText = " auto-yes "
 
 	// Write the title.
@@ -247,69 +359,211 @@ func (l *List) String() string {
 	}
 
 	b.WriteString("\n")
+	if l.filter != "" || l.filtering {
+		cursor := ""
+		if l.filtering {
+			cursor = "_"
+		}
+		b.WriteString(filterStyle.Render(fmt.Sprintf("/%s%s", l.filter, cursor)))
+		b.WriteString("\n")
+	}
 	b.WriteString("\n")
 
-	// Render the list.
-	for i, item := range l.items {
-		b.WriteString(l.renderer.Render(item, i+1, i == l.selectedIdx, len(l.repos) > 1))
-		if i != len(l.items)-1 {
+	// Render the list. The repo name is redundant when the list is grouped by repo.
+	showRepo := len(l.repos) > 1 && l.groupBy != GroupByRepo
+	rows := l.rows()
+	selectedIdx := l.ensureSelection(rows)
+	num := 0
+	for i, row := range rows {
+		if row.instance == nil {
+			b.WriteString(l.renderer.RenderGroupHeader(row.group, row.count, l.collapsed[row.group], i == selectedIdx))
+		} else {
+			num++
+			b.WriteString(l.renderer.Render(row.instance, num, i == selectedIdx, showRepo))
+		}
+		if i == len(rows)-1 {
+			break
+		}
+		// Headers don't have padding, keep them close to their instances.
+		if row.instance == nil && !l.collapsed[row.group] {
+			b.WriteString("\n")
+		} else {
 			b.WriteString("\n\n")
 		}
 	}
+	if len(rows) == 0 && l.filter != "" {
+		b.WriteString(pausedStyle.Padding(0, 1).Render("No sessions match the filter"))
+	}
+
+	if l.starting != "" {
+		if len(l.items) > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(lipgloss.Place(titleWidth, 1, lipgloss.Left, lipgloss.Bottom, queueTitle.Render(" Starting ")))
+		b.WriteString("\n\n")
+		b.WriteString(l.renderer.RenderStarting(l.starting))
+	}
+	if len(l.queued) > 0 {
+		if len(l.items) > 0 || l.starting != "" {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(lipgloss.Place(
+			titleWidth, 1, lipgloss.Left, lipgloss.Bottom, queueTitle.Render(fmt.Sprintf(" Queued (%d) ", len(l.queued)))))
+		b.WriteString("\n")
+		for _, item := range l.queued {
+			b.WriteString("\n")
+			b.WriteString(l.renderer.RenderQueued(item))
+		}
+	}
 	return lipgloss.Place(l.width, l.height, lipgloss.Left, lipgloss.Top, b.String())
 }
 
-// Down selects the next item in the list.
-func (l *List) Down() {
-	if len(l.items) == 0 {
-		return
+// RenderStarting renders the title of the instance being started as a single line with a spinner.
+func (r *InstanceRenderer) RenderStarting(title string) string {
+	line := []rune(fmt.Sprintf(" %s %s", r.spinner.View(), title))
+	widthAvail := r.width - 2
+	if widthAvail > 3 && len(line) > widthAvail {
+		line = append(line[:widthAvail-3], []rune("...")...)
+	}
+	return pausedStyle.Padding(0, 1).Render(string(line))
+}
+
+// RenderQueued renders a queued prompt as a single line with its title and the start of the prompt.
+func (r *InstanceRenderer) RenderQueued(item session.QueuedPrompt) string {
+	line := []rune(fmt.Sprintf(" %s %s: %s", queuedIcon, item.Title, strings.Join(strings.Fields(item.Prompt), " ")))
+	widthAvail := r.width - 2
+	if widthAvail > 3 && len(line) > widthAvail {
+		line = append(line[:widthAvail-3], []rune("...")...)
+	}
+	return pausedStyle.Padding(0, 1).Render(string(line))
+}
+
+// RenderGroupHeader renders the header of a group with the number of instances in it.
+func (r *InstanceRenderer) RenderGroupHeader(group string, count int, collapsed bool, selected bool) string {
+	icon := expandedIcon
+	if collapsed {
+		icon = collapsedIcon
+	}
+	style := groupHeaderStyle
+	if selected {
+		style = selectedGroupHeaderStyle
 	}
-	if l.selectedIdx < len(l.items)-1 {
-		l.selectedIdx++
+	text := []rune(fmt.Sprintf("%s %s (%d)", icon, group, count))
+	if widthAvail := r.width - 2; widthAvail > 3 && len(text) > widthAvail {
+		text = append(text[:widthAvail-3], []rune("...")...)
 	}
+	return style.Render(lipgloss.Place(r.width-2, 1, lipgloss.Left, lipgloss.Center, string(text)))
 }
 
-// Kill selects the next item in the list.
+// SetQueue sets the queued prompts shown below the instances.
+func (l *List) SetQueue(items []session.QueuedPrompt) {
+	l.queued = items
+}
+
+// SetStarting sets the title of the instance being started, shown below the instances. It's empty if none is.
+func (l *List) SetStarting(title string) {
+	l.starting = title
+}
+
+// Down selects the next row in the list.
+func (l *List) Down() {
+	rows := l.rows()
+	idx := l.ensureSelection(rows)
+	if idx >= 0 && idx < len(rows)-1 {
+		l.selected = rows[idx+1]
+	}
+}
+
+// Kill kills the selected instance. It does nothing if a group header is selected.
 func (l *List) Kill() {
-	if len(l.items) == 0 {
+	if selected := l.GetSelectedInstance(); selected != nil {
+		l.KillInstance(selected)
+	}
+}
+
+// KillInstance kills the given instance and removes it from the list. The selection stays on the same instance if it
+// wasn't the one killed, otherwise it moves to the row that takes its place.
+func (l *List) KillInstance(targetInstance *session.Instance) {
+	idx := -1
+	for i, item := range l.items {
+		if item == targetInstance {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
 		return
 	}
-	targetInstance := l.items[l.selectedIdx]
 
 	// Kill the tmux session
 	if err := targetInstance.Kill(); err != nil {
 		log.ErrorLog.Printf("could not kill instance: %v", err)
 	}
 
-	// If you delete the last one in the list, select the previous one.
-	if l.selectedIdx == len(l.items)-1 {
-		defer l.Up()
+	// Unregister the reponame. Instances that were never started didn't register one.
+	if targetInstance.Started() {
+		repoName, err := targetInstance.RepoName()
+		if err != nil {
+			log.ErrorLog.Printf("could not get repo name: %v", err)
+		} else {
+			l.rmRepo(repoName)
+		}
 	}
 
-	// Unregister the reponame.
-	repoName, err := targetInstance.RepoName()
-	if err != nil {
-		log.ErrorLog.Printf("could not get repo name: %v", err)
-	} else {
-		l.rmRepo(repoName)
+	selectedIdx := l.ensureSelection(l.rows())
+	l.items = append(l.items[:idx], l.items[idx+1:]...)
+	if l.selected.instance != targetInstance {
+		return
 	}
 
-	// Since there's items after this, the selectedIdx can stay the same.
-	l.items = append(l.items[:l.selectedIdx], l.items[l.selectedIdx+1:]...)
+	// Select the row that takes the place of the killed one. Deleting the last row moves the selection up.
+	rows := l.rows()
+	l.selected = listRow{}
+	if len(rows) == 0 {
+		return
+	}
+	if selectedIdx >= len(rows) {
+		selectedIdx = len(rows) - 1
+	}
+	l.selected = rows[selectedIdx]
 }
 
-func (l *List) Attach() (chan struct{}, error) {
-	targetInstance := l.items[l.selectedIdx]
-	return targetInstance.Attach()
+func (l *List) Attach(window string) (chan tmux.AttachResult, error) {
+	targetInstance := l.GetSelectedInstance()
+	if targetInstance == nil {
+		return nil, fmt.Errorf("no session selected")
+	}
+	return targetInstance.AttachWindow(window)
 }
 
-// Up selects the prev item in the list.
-func (l *List) Up() {
-	if len(l.items) == 0 {
-		return
+// SelectNextInstance selects the next instance in the list for which ok is true, or the previous one if forward is
+// false, wrapping around. It returns false and keeps the selection if there's no other such instance.
+func (l *List) SelectNextInstance(forward bool, ok func(*session.Instance) bool) bool {
+	rows := l.rows()
+	idx := l.ensureSelection(rows)
+	if idx < 0 {
+		return false
 	}
-	if l.selectedIdx > 0 {
-		l.selectedIdx--
+	step := 1
+	if !forward {
+		step = -1
+	}
+	for i := (idx + step + len(rows)) % len(rows); i != idx; i = (i + step + len(rows)) % len(rows) {
+		row := rows[i]
+		if row.instance != nil && row.instance != rows[idx].instance && ok(row.instance) {
+			l.selected = row
+			return true
+		}
+	}
+	return false
+}
+
+// Up selects the previous row in the list.
+func (l *List) Up() {
+	rows := l.rows()
+	idx := l.ensureSelection(rows)
+	if idx > 0 {
+		l.selected = rows[idx-1]
 	}
 }
 
@@ -334,34 +588,251 @@ func (l *List) rmRepo(repo string) {
 // AddInstance adds a new instance to the list. It returns a finalizer function that should be called when the instance
 // is started. If the instance was restored from storage or is paused, you can call the finalizer immediately.
 // When creating a new one and entering the name, you want to call the finalizer once the name is done.
+// Pending instances are skipped by the finalizer; call InstanceStarted once they start.
 func (l *List) AddInstance(instance *session.Instance) (finalize func()) {
 	l.items = append(l.items, instance)
 	// The finalizer registers the repo name once the instance is started.
 	return func() {
-		repoName, err := instance.RepoName()
-		if err != nil {
-			log.ErrorLog.Printf("could not get repo name: %v", err)
+		if instance.Pending() {
 			return
 		}
+		l.InstanceStarted(instance)
+	}
+}
 
-		l.addRepo(repoName)
+// InstanceStarted registers the repo name of an instance in the list that has just been started.
+func (l *List) InstanceStarted(instance *session.Instance) {
+	repoName, err := instance.RepoName()
+	if err != nil {
+		log.ErrorLog.Printf("could not get repo name: %v", err)
+		return
 	}
+
+	l.addRepo(repoName)
 }
 
-// GetSelectedInstance returns the currently selected instance
+// GetSelectedInstance returns the currently selected instance. It returns nil if the list is empty or a group header
+// is selected.
 func (l *List) GetSelectedInstance() *session.Instance {
-	if len(l.items) == 0 {
+	rows := l.rows()
+	idx := l.ensureSelection(rows)
+	if idx < 0 {
 		return nil
 	}
-	return l.items[l.selectedIdx]
+	return rows[idx].instance
 }
 
-// SetSelectedInstance sets the selected index. Noop if the index is out of bounds.
+// SetSelectedInstance selects the instance at the given index of GetInstances, expanding its group and clearing the
+// filter if they hide it. Noop if the index is out of bounds.
 func (l *List) SetSelectedInstance(idx int) {
 	if idx >= len(l.items) {
 		return
 	}
-	l.selectedIdx = idx
+	instance := l.items[idx]
+	if !l.matches(instance) {
+		l.filter = ""
+	}
+	groups := l.groupsOf(instance)
+	for _, group := range groups {
+		delete(l.collapsed, group)
+	}
+	l.selected = listRow{group: groups[0], instance: instance}
+}
+
+// SelectedGroup returns the name of the group whose header is selected, or false if no header is selected.
+func (l *List) SelectedGroup() (string, bool) {
+	rows := l.rows()
+	idx := l.ensureSelection(rows)
+	if idx < 0 || rows[idx].instance != nil {
+		return "", false
+	}
+	return rows[idx].group, true
+}
+
+// ToggleCollapsed collapses or expands the group of the selected row and selects its header.
+func (l *List) ToggleCollapsed() {
+	rows := l.rows()
+	idx := l.ensureSelection(rows)
+	if idx < 0 || rows[idx].group == "" {
+		return
+	}
+	group := rows[idx].group
+	l.collapsed[group] = !l.collapsed[group]
+	l.selected = listRow{group: group}
+}
+
+// GroupBy returns how the list is grouped.
+func (l *List) GroupBy() GroupBy {
+	return l.groupBy
+}
+
+// SetGroupBy sets how the list is grouped. Unknown modes ungroup the list.
+func (l *List) SetGroupBy(groupBy GroupBy) {
+	selected := l.GetSelectedInstance()
+	l.groupBy = GroupByNone
+	for _, mode := range groupByModes {
+		if mode == groupBy {
+			l.groupBy = groupBy
+		}
+	}
+	l.collapsed = make(map[string]bool)
+	l.selected = listRow{}
+	if selected != nil {
+		l.selected = listRow{group: l.groupsOf(selected)[0], instance: selected}
+	}
+}
+
+// CycleGroupBy switches to the next grouping mode and returns it.
+func (l *List) CycleGroupBy() GroupBy {
+	next := GroupByNone
+	for i, mode := range groupByModes {
+		if mode == l.groupBy {
+			next = groupByModes[(i+1)%len(groupByModes)]
+		}
+	}
+	l.SetGroupBy(next)
+	return next
+}
+
+// Filter returns the current filter.
+func (l *List) Filter() string {
+	return l.filter
+}
+
+// SetFilter narrows the list to instances whose title, branch, tags or project contain filter, ignoring case.
+// editing shows that the filter is still being typed.
+func (l *List) SetFilter(filter string, editing bool) {
+	l.filter = filter
+	l.filtering = editing
+}
+
+// matches returns true if the instance passes the filter.
+func (l *List) matches(instance *session.Instance) bool {
+	if l.filter == "" {
+		return true
+	}
+	filter := strings.ToLower(l.filter)
+	if strings.Contains(strings.ToLower(instance.Title), filter) ||
+		strings.Contains(strings.ToLower(instance.Branch), filter) ||
+		strings.Contains(strings.ToLower(instance.Project), filter) {
+		return true
+	}
+	for _, tag := range instance.Tags {
+		if strings.Contains(tag, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupsOf returns the groups the instance belongs to under the current grouping. It's [""] if the list isn't
+// grouped.
+func (l *List) groupsOf(instance *session.Instance) []string {
+	switch l.groupBy {
+	case GroupByProject:
+		if instance.Project == "" {
+			return []string{noGroup}
+		}
+		return []string{instance.Project}
+	case GroupByRepo:
+		if instance.Started() {
+			if repoName, err := instance.RepoName(); err == nil {
+				return []string{repoName}
+			}
+		}
+		// Pending instances don't have a worktree yet, the workspace path is in the repo.
+		return []string{filepath.Base(instance.Path)}
+	case GroupByTag:
+		if len(instance.Tags) == 0 {
+			return []string{noGroup}
+		}
+		return instance.Tags
+	case GroupByStatus:
+		return []string{instance.Status.String()}
+	case GroupByFanOut:
+		if instance.Group == "" {
+			return []string{noGroup}
+		}
+		return []string{instance.Group}
+	default:
+		return []string{""}
+	}
+}
+
+// rows returns the visible rows of the list.
+func (l *List) rows() []listRow {
+	var visible []*session.Instance
+	for _, item := range l.items {
+		if l.matches(item) {
+			visible = append(visible, item)
+		}
+	}
+
+	if l.groupBy == GroupByNone {
+		rows := make([]listRow, 0, len(visible))
+		for _, item := range visible {
+			rows = append(rows, listRow{instance: item})
+		}
+		return rows
+	}
+
+	var names []string
+	members := make(map[string][]*session.Instance)
+	statuses := make(map[string]session.Status)
+	for _, item := range visible {
+		for _, group := range l.groupsOf(item) {
+			if _, ok := members[group]; !ok {
+				names = append(names, group)
+			}
+			members[group] = append(members[group], item)
+			statuses[group] = item.Status
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		if l.groupBy == GroupByStatus {
+			return statuses[names[i]] < statuses[names[j]]
+		}
+		// Keep instances without a group at the end.
+		if (names[i] == noGroup) != (names[j] == noGroup) {
+			return names[j] == noGroup
+		}
+		return names[i] < names[j]
+	})
+
+	var rows []listRow
+	for _, name := range names {
+		rows = append(rows, listRow{group: name, count: len(members[name])})
+		if l.collapsed[name] {
+			continue
+		}
+		for _, item := range members[name] {
+			rows = append(rows, listRow{group: name, instance: item})
+		}
+	}
+	return rows
+}
+
+// ensureSelection returns the index of the selected row. If the selected row is gone, e.g. because the filter hides
+// it or its status group changed, it selects the same instance elsewhere, or the first row. It returns -1 if there
+// are no rows.
+func (l *List) ensureSelection(rows []listRow) int {
+	fallback := -1
+	for i, row := range rows {
+		if row.instance == l.selected.instance && row.group == l.selected.group {
+			return i
+		}
+		if fallback == -1 && l.selected.instance != nil && row.instance == l.selected.instance {
+			fallback = i
+		}
+	}
+	if fallback == -1 && len(rows) > 0 {
+		fallback = 0
+	}
+	if fallback == -1 {
+		return -1
+	}
+	l.selected = listRow{group: rows[fallback].group, instance: rows[fallback].instance}
+	return fallback
 }
 
 // GetInstances returns all instances in the list
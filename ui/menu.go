@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"agent-farmer/session"
+	"agent-farmer/session/tmux"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -40,6 +41,8 @@ const (
 	StateEmpty
 	StateNewInstance
 	StatePrompt
+	// StateInteractive is when keys are typed into the selected instance from the preview.
+	StateInteractive
 )
 
 type Menu struct {
@@ -47,7 +50,7 @@ type Menu struct {
 	height, width int
 	state         MenuState
 	instance      *session.Instance
-	isInDiffTab   bool
+	isScrollable  bool
 
 	// Group boundaries for dynamic menu rendering
 	instanceGroupEnd int
@@ -57,16 +60,16 @@ type Menu struct {
 	keyDown keys.KeyName
 }
 
-var defaultMenuOptions = []keys.KeyName{keys.KeyNew, keys.KeyPrompt, keys.KeyHelp, keys.KeyQuit}
+var defaultMenuOptions = []keys.KeyName{keys.KeyNew, keys.KeyPrompt, keys.KeyFanOut, keys.KeyHelp, keys.KeyQuit}
 var newInstanceMenuOptions = []keys.KeyName{keys.KeySubmitName}
 var promptMenuOptions = []keys.KeyName{keys.KeySubmitName}
 
 func NewMenu() *Menu {
 	return &Menu{
-		options:     defaultMenuOptions,
-		state:       StateEmpty,
-		isInDiffTab: false,
-		keyDown:     -1,
+		options:      defaultMenuOptions,
+		state:        StateEmpty,
+		isScrollable: false,
+		keyDown:      -1,
 	}
 }
 
@@ -87,8 +90,8 @@ func (m *Menu) SetState(state MenuState) {
 // SetInstance updates the current instance and refreshes menu options
 func (m *Menu) SetInstance(instance *session.Instance) {
 	m.instance = instance
-	// Only change the state if we're not in a special state (NewInstance or Prompt)
-	if m.state != StateNewInstance && m.state != StatePrompt {
+	// Only change the state if we're not in a special state (NewInstance, Prompt or Interactive)
+	if m.state != StateNewInstance && m.state != StatePrompt && m.state != StateInteractive {
 		if m.instance != nil {
 			m.state = StateDefault
 		} else {
@@ -98,9 +101,9 @@ func (m *Menu) SetInstance(instance *session.Instance) {
 	m.updateOptions()
 }
 
-// SetInDiffTab updates whether we're currently in the diff tab
-func (m *Menu) SetInDiffTab(inDiffTab bool) {
-	m.isInDiffTab = inDiffTab
+// SetScrollable updates whether the active tab can be scrolled
+func (m *Menu) SetScrollable(scrollable bool) {
+	m.isScrollable = scrollable
 	m.updateOptions()
 }
 
@@ -121,28 +124,42 @@ func (m *Menu) updateOptions() {
 		m.options = newInstanceMenuOptions
 	case StatePrompt:
 		m.options = promptMenuOptions
+	case StateInteractive:
+		m.options = nil
 	}
 }
 
 func (m *Menu) addInstanceOptions() {
 	// Instance management group
-	instanceGroup := []keys.KeyName{keys.KeyNew, keys.KeyKill}
+	instanceGroup := []keys.KeyName{keys.KeyNew, keys.KeyNewFromBase, keys.KeyAdopt, keys.KeyKill, keys.KeyTag,
+		keys.KeyProject}
 
 	// Action group
-	actionGroup := []keys.KeyName{keys.KeyEnter, keys.KeyOpenWorktree, keys.KeyRebase, keys.KeySubmit}
-	if m.instance.Status == session.Paused {
+	actionGroup := []keys.KeyName{keys.KeyEnter, keys.KeySendPrompt, keys.KeyOpenWorktree, keys.KeyRebase, keys.KeySubmit}
+	if m.instance.Status == session.Pending {
+		// There's nothing to act on until the instance starts.
+		actionGroup = []keys.KeyName{}
+	} else if m.instance.Status == session.Paused {
 		actionGroup = append(actionGroup, keys.KeyResume)
+	} else if m.instance.Status == session.Exited {
+		actionGroup = append(actionGroup, keys.KeyRestart, keys.KeyCheckout)
 	} else {
-		actionGroup = append(actionGroup, keys.KeyCheckout)
+		actionGroup = append(actionGroup, keys.KeyInteractive, keys.KeyCheckout)
+	}
+	if len(m.instance.Windows) > 0 && m.instance.Status != session.Paused {
+		actionGroup = append(actionGroup, keys.KeyNextWindow)
+	}
+	if m.instance.Group != "" {
+		actionGroup = append(actionGroup, keys.KeyCompare, keys.KeyKeepWinner)
 	}
 
-	// Navigation group (when in diff tab)
-	if m.isInDiffTab {
+	// Navigation group (when in a scrollable tab)
+	if m.isScrollable {
 		actionGroup = append(actionGroup, keys.KeyShiftUp)
 	}
 
 	// System group
-	systemGroup := []keys.KeyName{keys.KeyTab, keys.KeyHelp, keys.KeyQuit}
+	systemGroup := []keys.KeyName{keys.KeyFilter, keys.KeyGroupBy, keys.KeyGrid, keys.KeyInbox, keys.KeyTab, keys.KeyHelp, keys.KeyQuit}
 
 	// Combine all groups and store group boundaries
 	m.options = []keys.KeyName{}
@@ -160,6 +177,16 @@ func (m *Menu) SetSize(width, height int) {
 }
 
 func (m *Menu) String() string {
+	if m.state == StateInteractive {
+		var title string
+		if m.instance != nil {
+			title = m.instance.Title
+		}
+		hint := actionGroupStyle.Render("typing into "+title) + sepStyle.Render(separator) +
+			keyStyle.Render(tmux.DetachKeyName()) + " " + descStyle.Render("stop typing")
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, menuStyle.Render(hint))
+	}
+
 	var s strings.Builder
 
 	// Compute group boundaries dynamically
@@ -179,13 +206,13 @@ func (m *Menu) String() string {
 			{m.actionGroupEnd, len(m.options)},     // System group
 		}
 	} else {
-		// For empty state, treat first two options as action group
+		// For empty state, treat the creation options as action group
 		groups = []struct {
 			start int
 			end   int
 		}{
-			{0, 2},              // Action group (n, N)
-			{2, len(m.options)}, // System group (help, quit)
+			{0, 3},              // Action group (n, N, F)
+			{3, len(m.options)}, // System group (help, quit)
 		}
 	}
 
@@ -206,7 +233,7 @@ func (m *Menu) String() string {
 		var inActionGroup bool
 		switch m.state {
 		case StateEmpty:
-			// For empty state, the action group is the first group (n, N)
+			// For empty state, the action group is the first group (n, N, F)
 			inActionGroup = i >= groups[0].start && i < groups[0].end
 		default:
 			// For instance state, the action group is the second group
@@ -1,6 +1,8 @@
 package overlay
 
 import (
+	"fmt"
+
 	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -15,6 +17,13 @@ type TextInputOverlay struct {
 	Canceled      bool
 	OnSubmit      func()
 	width, height int
+
+	// history holds earlier values to recall, most recent first.
+	history []string
+	// historyIdx is the index of the recalled value in history, or -1 while editing a new value.
+	historyIdx int
+	// draft is the new value, kept while earlier ones are recalled.
+	draft string
 }
 
 // NewTextInputOverlay creates a new text input overlay with the given title and initial value.
@@ -37,6 +46,29 @@ func NewTextInputOverlay(title string, initialValue string) *TextInputOverlay {
 		FocusIndex: 0,
 		Submitted:  false,
 		Canceled:   false,
+		historyIdx: -1,
+	}
+}
+
+// SetHistory sets the earlier values that ctrl+p and ctrl+n recall, most recent first.
+func (t *TextInputOverlay) SetHistory(history []string) {
+	t.history = history
+	t.historyIdx = -1
+}
+
+// recall replaces the value with the history entry at idx, or with the draft if idx is -1.
+func (t *TextInputOverlay) recall(idx int) {
+	if idx < -1 || idx >= len(t.history) {
+		return
+	}
+	if t.historyIdx == -1 {
+		t.draft = t.textarea.Value()
+	}
+	t.historyIdx = idx
+	if idx == -1 {
+		t.textarea.SetValue(t.draft)
+	} else {
+		t.textarea.SetValue(t.history[idx])
 	}
 }
 
@@ -75,6 +107,12 @@ func (t *TextInputOverlay) HandleKeyPress(msg tea.KeyMsg) bool {
 	}
 
 	switch msg.Type {
+	case tea.KeyCtrlP:
+		t.recall(t.historyIdx + 1)
+		return false
+	case tea.KeyCtrlN:
+		t.recall(t.historyIdx - 1)
+		return false
 	case tea.KeyTab:
 		// Toggle focus between input and enter button.
 		t.FocusIndex = (t.FocusIndex + 1) % 2
@@ -158,6 +196,13 @@ func (t *TextInputOverlay) Render() string {
 	// Build the view
 	content := titleStyle.Render(t.Title) + "\n"
 	content += t.textarea.View() + "\n\n"
+	if len(t.history) > 0 {
+		hint := "ctrl+p/ctrl+n: recall earlier prompts"
+		if t.historyIdx >= 0 {
+			hint = fmt.Sprintf("%s (%d/%d)", hint, t.historyIdx+1, len(t.history))
+		}
+		content += buttonStyle.Render(hint) + "\n\n"
+	}
 
 	// Render submit button with appropriate style
 	submitButton := " Submit with Ctrl+Enter "
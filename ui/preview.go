@@ -11,11 +11,22 @@ import (
 var previewPaneStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"})
 
+var (
+	windowTabStyle         = lipgloss.NewStyle().Padding(0, 1).Foreground(lipgloss.AdaptiveColor{Light: "#7F7A7A", Dark: "#9C9494"})
+	selectedWindowTabStyle = lipgloss.NewStyle().Padding(0, 1).Bold(true).
+				Background(highlightColor).Foreground(lipgloss.Color("#FFFFFF"))
+)
+
 type PreviewPane struct {
 	width  int
 	height int
 
 	previewState previewState
+
+	// instance is the instance shown. window is the auxiliary window of it that's shown, empty for the agent's. It
+	// goes back to the agent's when another instance is shown.
+	instance *session.Instance
+	window   string
 }
 
 type previewState struct {
@@ -42,8 +53,35 @@ func (p *PreviewPane) setFallbackState(message string) {
 	}
 }
 
+// NextWindow shows the next window of the instance, the agent's window comes first.
+func (p *PreviewPane) NextWindow() {
+	if p.instance == nil || len(p.instance.Windows) == 0 {
+		return
+	}
+	next := 0
+	for i, window := range p.instance.Windows {
+		if window.Name == p.window {
+			next = i + 1
+		}
+	}
+	if next == len(p.instance.Windows) {
+		p.window = ""
+		return
+	}
+	p.window = p.instance.Windows[next].Name
+}
+
+// Window returns the name of the auxiliary window shown, empty for the agent's window.
+func (p *PreviewPane) Window() string {
+	return p.window
+}
+
 // Updates the preview pane content with the tmux pane content
 func (p *PreviewPane) UpdateContent(instance *session.Instance) error {
+	if instance != p.instance || !p.hasWindow(p.window) {
+		p.instance, p.window = instance, ""
+	}
+
 	switch {
 	case instance == nil:
 		p.setFallbackState("No agents running yet. Spin up a new instance with 'n' to get started!")
@@ -63,12 +101,27 @@ func (p *PreviewPane) UpdateContent(instance *session.Instance) error {
 				)),
 		))
 		return nil
+	case instance.Status == session.Pending:
+		p.setFallbackState(lipgloss.JoinVertical(lipgloss.Center,
+			"Session is pending.",
+			"",
+			"It will start once there's room under the limits in your config."))
+		return nil
+	case instance.Status == session.Exited && !instance.TmuxAlive():
+		p.setFallbackState(lipgloss.JoinVertical(lipgloss.Center,
+			"The agent exited.",
+			"",
+			"Its worktree and branch are still there. Press 'X' to restart it or 'D' to kill the session."))
+		return nil
 	}
 
-	content, err := instance.Preview()
+	content, err := instance.PreviewWindow(p.window)
 	if err != nil {
 		return err
 	}
+	if len(instance.Windows) > 0 {
+		content = p.windowSwitcher() + "\n" + content
+	}
 
 	if len(content) == 0 && !instance.Started() {
 		p.setFallbackState("Please enter a name for the instance.")
@@ -82,6 +135,33 @@ func (p *PreviewPane) UpdateContent(instance *session.Instance) error {
 	return nil
 }
 
+func (p *PreviewPane) hasWindow(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, window := range p.instance.Windows {
+		if window.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// windowSwitcher renders the names of the instance's windows, with the shown one highlighted.
+func (p *PreviewPane) windowSwitcher() string {
+	tab := func(name, label string) string {
+		if name == p.window {
+			return selectedWindowTabStyle.Render(label)
+		}
+		return windowTabStyle.Render(label)
+	}
+	tabs := []string{tab("", "agent")}
+	for _, window := range p.instance.Windows {
+		tabs = append(tabs, tab(window.Name, window.Name))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, tabs...) + windowTabStyle.Render("w to switch")
+}
+
 // Returns the preview pane content as a string.
 func (p *PreviewPane) String() string {
 	if p.width == 0 || p.height == 0 {
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"agent-farmer/session"
+	"fmt"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -33,6 +34,8 @@ var (
 const (
 	PreviewTab = iota
 	DiffTab
+	HistoryTab
+	TranscriptTab
 )
 
 type Tab struct {
@@ -48,19 +51,30 @@ type TabbedWindow struct {
 	activeTab int
 	height    int
 	width     int
+	// interactive is true while keys are typed into the instance in the preview.
+	interactive bool
 
-	preview *PreviewPane
-	diff    *DiffPane
+	preview    *PreviewPane
+	grid       *GridPane
+	diff       *DiffPane
+	history    *HistoryPane
+	transcript *TranscriptPane
 }
 
-func NewTabbedWindow(preview *PreviewPane, diff *DiffPane) *TabbedWindow {
+func NewTabbedWindow(preview *PreviewPane, grid *GridPane, diff *DiffPane, history *HistoryPane,
+	transcript *TranscriptPane) *TabbedWindow {
 	return &TabbedWindow{
 		tabs: []string{
 			"Preview",
 			"Diff",
+			"History",
+			"Transcript",
 		},
-		preview: preview,
-		diff:    diff,
+		preview:    preview,
+		grid:       grid,
+		diff:       diff,
+		history:    history,
+		transcript: transcript,
 	}
 }
 
@@ -82,7 +96,10 @@ func (w *TabbedWindow) SetSize(width, height int) {
 	contentWidth := w.width - windowStyle.GetHorizontalFrameSize()
 
 	w.preview.SetSize(contentWidth, contentHeight)
+	w.grid.SetSize(contentWidth, contentHeight)
 	w.diff.SetSize(contentWidth, contentHeight)
+	w.history.SetSize(contentWidth, contentHeight)
+	w.transcript.SetSize(contentWidth, contentHeight)
 }
 
 func (w *TabbedWindow) GetPreviewSize() (width, height int) {
@@ -93,14 +110,59 @@ func (w *TabbedWindow) Toggle() {
 	w.activeTab = (w.activeTab + 1) % len(w.tabs)
 }
 
-// UpdatePreview updates the content of the preview pane. instance may be nil.
-func (w *TabbedWindow) UpdatePreview(instance *session.Instance) error {
+// UpdatePreview updates the content of the preview pane, or of the grid if it's shown. instance is the selected
+// instance and may be nil, instances are the ones the grid can show.
+func (w *TabbedWindow) UpdatePreview(instance *session.Instance, instances []*session.Instance) error {
 	if w.activeTab != PreviewTab {
 		return nil
 	}
+	if w.grid.Layout() != GridOff {
+		return w.grid.UpdateContent(instances, instance)
+	}
 	return w.preview.UpdateContent(instance)
 }
 
+// SetInteractive marks the preview as typed into, and shows the preview tab while it is.
+func (w *TabbedWindow) SetInteractive(interactive bool) {
+	w.interactive = interactive
+	if interactive {
+		w.activeTab = PreviewTab
+	}
+}
+
+// CycleGridLayout switches the preview to the next grid layout, or back to the selected instance after the last one.
+func (w *TabbedWindow) CycleGridLayout() {
+	w.activeTab = PreviewTab
+	w.grid.CycleLayout()
+}
+
+// GridLayout returns the layout of the grid in the preview, GridOff if it isn't shown.
+func (w *TabbedWindow) GridLayout() GridLayout {
+	return w.grid.Layout()
+}
+
+// GetGridTileSize returns the size of the panes in the grid's tiles.
+func (w *TabbedWindow) GetGridTileSize() (width, height int) {
+	return w.grid.TileSize()
+}
+
+// NextPreviewWindow switches the preview between the agent's window and the auxiliary windows of the instance.
+func (w *TabbedWindow) NextPreviewWindow() {
+	if w.activeTab != PreviewTab || w.grid.Layout() != GridOff {
+		return
+	}
+	w.preview.NextWindow()
+}
+
+// PreviewWindow returns the auxiliary window shown in the preview, empty for the agent's window, in the grid or if
+// another tab is active.
+func (w *TabbedWindow) PreviewWindow() string {
+	if w.activeTab != PreviewTab || w.grid.Layout() != GridOff {
+		return ""
+	}
+	return w.preview.Window()
+}
+
 func (w *TabbedWindow) UpdateDiff(instance *session.Instance) {
 	if w.activeTab != DiffTab {
 		return
@@ -108,22 +170,58 @@ func (w *TabbedWindow) UpdateDiff(instance *session.Instance) {
 	w.diff.SetDiff(instance)
 }
 
+// UpdateHistory updates the content of the history pane. instance may be nil.
+func (w *TabbedWindow) UpdateHistory(instance *session.Instance) {
+	if w.activeTab != HistoryTab {
+		return
+	}
+	w.history.SetHistory(instance)
+}
+
+// UpdateTranscript updates the content of the transcript pane. instance may be nil.
+func (w *TabbedWindow) UpdateTranscript(instance *session.Instance) error {
+	if w.activeTab != TranscriptTab {
+		return nil
+	}
+	return w.transcript.UpdateContent(instance)
+}
+
+// Transcript returns the transcript pane, which is searched from outside the window.
+func (w *TabbedWindow) Transcript() *TranscriptPane {
+	return w.transcript
+}
+
+// IsInTranscriptTab returns true if the transcript tab is currently active
+func (w *TabbedWindow) IsInTranscriptTab() bool {
+	return w.activeTab == TranscriptTab
+}
+
 // Add these new methods for handling scroll events
 func (w *TabbedWindow) ScrollUp() {
-	if w.activeTab == 1 { // Diff tab
+	switch w.activeTab {
+	case DiffTab:
 		w.diff.ScrollUp()
+	case HistoryTab:
+		w.history.ScrollUp()
+	case TranscriptTab:
+		w.transcript.ScrollUp()
 	}
 }
 
 func (w *TabbedWindow) ScrollDown() {
-	if w.activeTab == 1 { // Diff tab
+	switch w.activeTab {
+	case DiffTab:
 		w.diff.ScrollDown()
+	case HistoryTab:
+		w.history.ScrollDown()
+	case TranscriptTab:
+		w.transcript.ScrollDown()
 	}
 }
 
-// IsInDiffTab returns true if the diff tab is currently active
-func (w *TabbedWindow) IsInDiffTab() bool {
-	return w.activeTab == 1
+// IsScrollable returns true if the active tab can be scrolled.
+func (w *TabbedWindow) IsScrollable() bool {
+	return w.activeTab == DiffTab || w.activeTab == HistoryTab || w.activeTab == TranscriptTab
 }
 
 func (w *TabbedWindow) String() string {
@@ -162,15 +260,30 @@ func (w *TabbedWindow) String() string {
 		}
 		style = style.Border(border)
 		style = style.Width(width - 1)
+		if i == PreviewTab && w.grid.Layout() != GridOff {
+			t = fmt.Sprintf("Grid %s", w.grid.Layout())
+		}
+		if i == PreviewTab && w.interactive {
+			t += " · typing"
+		}
 		renderedTabs = append(renderedTabs, style.Render(t))
 	}
 
 	row := lipgloss.JoinHorizontal(lipgloss.Top, renderedTabs...)
 	var content string
-	if w.activeTab == 0 {
-		content = w.preview.String()
-	} else {
+	switch w.activeTab {
+	case PreviewTab:
+		if w.grid.Layout() != GridOff {
+			content = w.grid.String()
+		} else {
+			content = w.preview.String()
+		}
+	case DiffTab:
 		content = w.diff.String()
+	case HistoryTab:
+		content = w.history.String()
+	case TranscriptTab:
+		content = w.transcript.String()
 	}
 	window := windowStyle.Render(
 		lipgloss.Place(
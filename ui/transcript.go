@@ -0,0 +1,272 @@
+package ui
+
+import (
+	"agent-farmer/session"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// transcriptRefreshInterval is how often the transcript of the shown instance is captured again. Capturing the whole
+// scrollback is too slow to do on every preview tick.
+const transcriptRefreshInterval = time.Second
+
+var (
+	searchMatchStyle = lipgloss.NewStyle().
+				Background(lipgloss.Color("#FFD700")).
+				Foreground(lipgloss.Color("#1a1a1a"))
+	currentMatchStyle = lipgloss.NewStyle().
+				Background(lipgloss.Color("#7D56F4")).
+				Foreground(lipgloss.Color("#ffffff"))
+	transcriptStatusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#0ea5e9"))
+)
+
+// TranscriptPane shows the full scrollback of an instance, including what was saved when it was paused, and
+// supports searching it.
+type TranscriptPane struct {
+	viewport viewport.Model
+	width    int
+	height   int
+
+	// title is the title of the instance whose transcript is shown.
+	title       string
+	refreshedAt time.Time
+	content     string
+	// lines is content wrapped to the width of the pane.
+	lines []string
+	// fallback is shown instead of the transcript when there is none.
+	fallback string
+
+	query     string
+	searching bool
+	// matches are the indices of the lines that contain the query.
+	matches []int
+	// current is the index in matches of the match that was jumped to.
+	current int
+}
+
+func NewTranscriptPane() *TranscriptPane {
+	return &TranscriptPane{
+		viewport: viewport.New(0, 0),
+	}
+}
+
+func (t *TranscriptPane) SetSize(width, height int) {
+	t.width = width
+	t.height = height
+	t.viewport.Width = width
+	// The last line is the status line.
+	t.viewport.Height = max(height-1, 0)
+	t.setContent(t.content, false)
+}
+
+// UpdateContent captures the transcript of instance. instance may be nil.
+func (t *TranscriptPane) UpdateContent(instance *session.Instance) error {
+	switch {
+	case instance == nil:
+		t.title = ""
+		t.fallback = "No session selected."
+		t.setContent("", true)
+		return nil
+	case instance.Status == session.Pending:
+		t.title = instance.Title
+		t.fallback = "Session hasn't started yet."
+		t.setContent("", true)
+		return nil
+	case instance.Title == t.title && time.Since(t.refreshedAt) < transcriptRefreshInterval:
+		return nil
+	}
+
+	saved, err := session.LoadTranscript(instance.Title)
+	if err != nil {
+		return err
+	}
+	live, err := instance.Transcript()
+	if err != nil {
+		return err
+	}
+	var parts []string
+	for _, part := range []string{saved, live} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	changed := instance.Title != t.title
+	t.title = instance.Title
+	t.refreshedAt = time.Now()
+	t.fallback = ""
+	if len(parts) == 0 {
+		t.fallback = "Nothing in the transcript yet."
+	}
+	t.setContent(strings.Join(parts, "\n\n"), changed)
+	return nil
+}
+
+// setContent wraps content to the width of the pane. The view follows the end of the transcript unless it was
+// scrolled up, and jumps to the end when reset is true.
+func (t *TranscriptPane) setContent(content string, reset bool) {
+	follow := reset || t.viewport.AtBottom()
+	t.content = content
+	t.lines = nil
+	if content != "" && t.width > 0 {
+		t.lines = strings.Split(ansi.Hardwrap(content, t.width, true), "\n")
+	}
+	t.findMatches()
+	t.render()
+	if follow {
+		t.viewport.GotoBottom()
+	}
+}
+
+// Searching returns true if there is a search query.
+func (t *TranscriptPane) Searching() bool {
+	return t.query != ""
+}
+
+// Query returns the search query.
+func (t *TranscriptPane) Query() string {
+	return t.query
+}
+
+// SetSearch sets the search query and jumps to the first match below the top of the view. editing is true while the
+// query is being typed.
+func (t *TranscriptPane) SetSearch(query string, editing bool) {
+	changed := query != t.query
+	t.query = query
+	t.searching = editing
+	t.findMatches()
+	if changed && len(t.matches) > 0 {
+		t.current = 0
+		for n, line := range t.matches {
+			if line >= t.viewport.YOffset {
+				t.current = n
+				break
+			}
+		}
+		t.scrollToCurrent()
+	}
+	t.render()
+}
+
+// NextMatch jumps to the next match, wrapping around to the first.
+func (t *TranscriptPane) NextMatch() {
+	if len(t.matches) == 0 {
+		return
+	}
+	t.current = (t.current + 1) % len(t.matches)
+	t.scrollToCurrent()
+	t.render()
+}
+
+// PrevMatch jumps to the previous match, wrapping around to the last.
+func (t *TranscriptPane) PrevMatch() {
+	if len(t.matches) == 0 {
+		return
+	}
+	t.current = (t.current - 1 + len(t.matches)) % len(t.matches)
+	t.scrollToCurrent()
+	t.render()
+}
+
+func (t *TranscriptPane) findMatches() {
+	t.matches = nil
+	if t.query == "" {
+		return
+	}
+	query := strings.ToLower(t.query)
+	for n, line := range t.lines {
+		if strings.Contains(strings.ToLower(line), query) {
+			t.matches = append(t.matches, n)
+		}
+	}
+	if t.current >= len(t.matches) {
+		t.current = 0
+	}
+}
+
+func (t *TranscriptPane) scrollToCurrent() {
+	t.viewport.SetYOffset(t.matches[t.current] - t.viewport.Height/2)
+}
+
+func (t *TranscriptPane) render() {
+	if t.fallback != "" {
+		t.viewport.SetContent(lipgloss.Place(t.width, t.viewport.Height, lipgloss.Center, lipgloss.Center, t.fallback))
+		return
+	}
+
+	currentLine := -1
+	if len(t.matches) > 0 {
+		currentLine = t.matches[t.current]
+	}
+	lines := make([]string, len(t.lines))
+	for n, line := range t.lines {
+		style := searchMatchStyle
+		if n == currentLine {
+			style = currentMatchStyle
+		}
+		lines[n] = highlight(line, t.query, style)
+	}
+	t.viewport.SetContent(strings.Join(lines, "\n"))
+}
+
+// highlight renders the case-insensitive occurrences of query in line with style.
+func highlight(line string, query string, style lipgloss.Style) string {
+	if query == "" {
+		return line
+	}
+	lower, lowerQuery := strings.ToLower(line), strings.ToLower(query)
+	if len(lower) != len(line) {
+		// Lowercasing changed the byte offsets, so highlight the whole line if it matches.
+		if strings.Contains(lower, lowerQuery) {
+			return style.Render(line)
+		}
+		return line
+	}
+
+	var b strings.Builder
+	for {
+		idx := strings.Index(lower, lowerQuery)
+		if idx < 0 {
+			b.WriteString(line)
+			return b.String()
+		}
+		end := idx + len(lowerQuery)
+		b.WriteString(line[:idx])
+		b.WriteString(style.Render(line[idx:end]))
+		line, lower = line[end:], lower[end:]
+	}
+}
+
+func (t *TranscriptPane) String() string {
+	var status string
+	switch {
+	case t.searching || t.query != "":
+		status = "/" + t.query
+		if t.searching {
+			status += "_"
+		}
+		if len(t.matches) == 0 {
+			status += "  no matches"
+		} else {
+			status += fmt.Sprintf("  %d/%d  n/N: next/previous, esc: clear", t.current+1, len(t.matches))
+		}
+	case t.fallback == "":
+		status = fmt.Sprintf("%d lines  /: search", len(t.lines))
+	}
+	return t.viewport.View() + "\n" + transcriptStatusStyle.Render(status)
+}
+
+// ScrollUp scrolls the viewport up
+func (t *TranscriptPane) ScrollUp() {
+	t.viewport.LineUp(1)
+}
+
+// ScrollDown scrolls the viewport down
+func (t *TranscriptPane) ScrollDown() {
+	t.viewport.LineDown(1)
+}